@@ -0,0 +1,452 @@
+package furydb
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// Note:
+// Rows are aggregated by hash, rows with same GROUP BY values are put in same group by key of
+// the encoded values, then every aggregate of the group is updated with the row. Only aggregate
+// values and first row of the group are kept, so whole table does not have to fit in memory,
+// only the groups. Without GROUP BY all rows are one group, which is there even if no row is found.
+// Select list, HAVING and ORDER BY are evaluated once per group, column outside of aggregate must be
+// one of GROUP BY expressions.
+
+// aggregate functions by name
+var aggregateFuncs = map[string]bool{
+	"COUNT": true,
+	"SUM":   true,
+	"AVG":   true,
+	"MIN":   true,
+	"MAX":   true,
+}
+
+// Aggregate is aggregate function call, e.g. COUNT(*), SUM(DISTINCT price)
+type Aggregate struct {
+	Func     string         // COUNT, SUM, AVG, MIN, MAX or name of registered aggregate
+	Arg      Expr           // value aggregated, nil for COUNT(*)
+	Distinct bool           // only distinct values are aggregated
+	index    int            // position of the aggregate value in evalContext aggs
+	udf      *userAggregate // registered aggregate, nil for built-in
+}
+
+// String implements Expr
+func (e *Aggregate) String() string {
+	if e.Arg == nil {
+		return e.Func + "(*)"
+	}
+	if e.Distinct {
+		return e.Func + "(DISTINCT " + e.Arg.String() + ")"
+	}
+	return e.Func + "(" + e.Arg.String() + ")"
+}
+
+func (e *Aggregate) bind(s *scope) error {
+	if e.Arg == nil {
+		return nil
+	}
+	return e.Arg.bind(s)
+}
+
+func (e *Aggregate) eval(ctx *evalContext) (*Column, error) {
+	// value is worked out by aggState before the group is evaluated
+	if ctx.aggs == nil || e.index >= len(ctx.aggs) {
+		return nil, ErrAggregateNotAllowed
+	}
+	return ctx.aggs[e.index], nil
+}
+
+// parseAggregate parses aggregate function call after the opening (,
+// e.g. *) or DISTINCT price), udf is registered aggregate or nil
+func (p *Parser) parseAggregate(fn string, udf *userAggregate) (Expr, error) {
+	var err error
+	agg := &Aggregate{Func: fn, udf: udf}
+
+	tok, lit := p.scanIgnoreWhitespace()
+	if tok == ASTERISK {
+		if fn != "COUNT" {
+			return nil, fmt.Errorf("found %q, expected expression", lit)
+		}
+	} else {
+		if tok == DISTINCT {
+			agg.Distinct = true
+		} else {
+			p.unscan()
+		}
+		agg.Arg, err = p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if tok, lit = p.scanIgnoreWhitespace(); tok != RIGHTPAR {
+		return nil, fmt.Errorf("found %q, expected )", lit)
+	}
+	return agg, nil
+}
+
+// collectAggregates gives aggregates used in expression appended to aggs,
+// each aggregate is given its position in aggs
+func collectAggregates(expr Expr, aggs []*Aggregate) ([]*Aggregate, error) {
+	if agg, ok := expr.(*Aggregate); ok {
+		// aggregate of aggregate
+		if agg.Arg != nil {
+			inner, err := collectAggregates(agg.Arg, nil)
+			if err != nil {
+				return nil, err
+			}
+			if len(inner) > 0 {
+				return nil, ErrAggregateNotAllowed
+			}
+		}
+		agg.index = len(aggs)
+		return append(aggs, agg), nil
+	}
+
+	var err error
+	for _, child := range exprChildren(expr) {
+		aggs, err = collectAggregates(child, aggs)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return aggs, nil
+}
+
+// checkGrouped checks that columns of expression are used in aggregate or are GROUP BY expression
+func checkGrouped(expr Expr, groupBy []Expr) error {
+	for _, group := range groupBy {
+		if expr.String() == group.String() {
+			return nil
+		}
+	}
+
+	switch expr.(type) {
+	case *Aggregate:
+		return nil
+	case *ColumnRef:
+		return ErrColumnNotGrouped
+	}
+	for _, child := range exprChildren(expr) {
+		err := checkGrouped(child, groupBy)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// aggregates gives aggregates used by select, nil if select does not aggregate rows
+func (stmt *SelectStatement) aggregates(fields []Expr) ([]*Aggregate, error) {
+	var err error
+	var aggs []*Aggregate
+
+	// aggregate is not allowed where single row is evaluated
+	for _, expr := range append([]Expr{stmt.Where}, stmt.GroupBy...) {
+		if expr == nil {
+			continue
+		}
+		found, err := collectAggregates(expr, nil)
+		if err != nil {
+			return nil, err
+		}
+		if len(found) > 0 {
+			return nil, ErrAggregateNotAllowed
+		}
+	}
+
+	exprs := append([]Expr{}, fields...)
+	if stmt.Having != nil {
+		exprs = append(exprs, stmt.Having)
+	}
+	for _, item := range stmt.OrderBy {
+		exprs = append(exprs, item.Expr)
+	}
+	for _, expr := range exprs {
+		aggs, err = collectAggregates(expr, aggs)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(aggs) == 0 && len(stmt.GroupBy) == 0 && stmt.Having == nil {
+		return nil, nil
+	}
+
+	for _, expr := range exprs {
+		err = checkGrouped(expr, stmt.GroupBy)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return aggs, nil
+}
+
+// aggState is value of an aggregate so far
+type aggState struct {
+	agg   *Aggregate
+	count int64           // values aggregated
+	value *Column         // sum, min or max so far, nil if no value yet
+	seen  map[string]bool // values aggregated by DISTINCT
+	udf   reflect.Value   // value of registered aggregate
+}
+
+// add aggregates value of the row
+func (s *aggState) add(ctx *evalContext) error {
+	if s.agg.Arg == nil {
+		s.count++
+		return nil
+	}
+
+	val, err := s.agg.Arg.eval(ctx)
+	if err != nil {
+		return err
+	}
+	// null is not aggregated
+	if val.DataIsNull {
+		return nil
+	}
+	if s.agg.Distinct {
+		key, err := encodeKey(val)
+		if err != nil {
+			return err
+		}
+		if s.seen[string(key)] {
+			return nil
+		}
+		s.seen[string(key)] = true
+	}
+	if s.agg.udf != nil {
+		s.count++
+		return s.agg.udf.step(s.udf, val)
+	}
+
+	switch s.agg.Func {
+	case "SUM", "AVG":
+		if val.Type != ColumnTypeInt && val.Type != ColumnTypeFloat {
+			return ErrInvalidAggregate
+		}
+		// average is worked out in float, so it cannot overflow
+		if s.agg.Func == "AVG" && val.Type == ColumnTypeInt {
+			val = &Column{Type: ColumnTypeFloat, DataFloat: float64(val.DataInt)}
+		}
+		s.value, err = addNumbers(s.value, val)
+		if err != nil {
+			return err
+		}
+	case "MIN", "MAX":
+		if s.value != nil {
+			cmp, err := compareColumns(val, s.value)
+			if err != nil {
+				return err
+			}
+			if s.agg.Func == "MIN" && cmp >= 0 || s.agg.Func == "MAX" && cmp <= 0 {
+				break
+			}
+		}
+		s.value = val
+	}
+	s.count++
+	return nil
+}
+
+// result gives value of the aggregate, COUNT of no value is 0 and others are null
+// registered aggregate gives its Done result
+func (s *aggState) result() (*Column, error) {
+	if s.agg.udf != nil {
+		return s.agg.udf.done(s.udf)
+	}
+	switch s.agg.Func {
+	case "COUNT":
+		return &Column{Type: ColumnTypeInt, DataInt: s.count}, nil
+	case "AVG":
+		if s.value == nil {
+			return &Column{Type: ColumnTypeFloat, DataIsNull: true}, nil
+		}
+		return &Column{Type: ColumnTypeFloat, DataFloat: s.value.DataFloat / float64(s.count)}, nil
+	}
+	if s.value == nil {
+		return &Column{DataIsNull: true}, nil
+	}
+	return s.value, nil
+}
+
+// addNumbers adds two numbers, sum is int only if both are int, nil a is 0
+func addNumbers(a, b *Column) (*Column, error) {
+	if a == nil {
+		return b, nil
+	}
+	if a.Type == ColumnTypeInt && b.Type == ColumnTypeInt {
+		sum := a.DataInt + b.DataInt
+		if (sum > a.DataInt) != (b.DataInt > 0) {
+			return nil, ErrIntegerOverflow
+		}
+		return &Column{Type: ColumnTypeInt, DataInt: sum}, nil
+	}
+	a, err := coerce(a, ColumnTypeFloat)
+	if err != nil {
+		return nil, err
+	}
+	b, err = coerce(b, ColumnTypeFloat)
+	if err != nil {
+		return nil, err
+	}
+	return &Column{Type: ColumnTypeFloat, DataFloat: a.DataFloat + b.DataFloat}, nil
+}
+
+// rowGroup is rows with same GROUP BY values
+type rowGroup struct {
+	row    *Row // first row of the group, nil if group has no row
+	states []*aggState
+}
+
+// newRowGroup gives group with nothing aggregated yet
+func newRowGroup(row *Row, aggs []*Aggregate) (*rowGroup, error) {
+	g := &rowGroup{row: row}
+	for _, agg := range aggs {
+		state := &aggState{agg: agg}
+		if agg.Distinct {
+			state.seen = map[string]bool{}
+		}
+		if agg.udf != nil {
+			out, err := callFunc(agg.udf.newAgg, nil)
+			if err != nil {
+				return nil, err
+			}
+			state.udf = out[0]
+		}
+		g.states = append(g.states, state)
+	}
+	return g, nil
+}
+
+// groupKey gives key of GROUP BY values of row, rows with same values have same key
+func groupKey(groupBy []Expr, ctx *evalContext) ([]byte, error) {
+	key := []byte{}
+	for _, expr := range groupBy {
+		val, err := expr.eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+		key, err = appendValueKey(key, val)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return key, nil
+}
+
+// appendValueKey appends key of value, same values have same key and nulls are same
+func appendValueKey(key []byte, val *Column) ([]byte, error) {
+	if val.DataIsNull {
+		return append(key, 0), nil
+	}
+	enc, err := encodeKey(val)
+	if err != nil {
+		return nil, err
+	}
+	return append(key, enc...), nil
+}
+
+// groupRows aggregates rows of table that match where condition,
+// gives row of select list values for every group in ORDER BY order
+func (db *Database) groupRows(s *scope, stmt *SelectStatement, fields []Expr, aggs []*Aggregate, args []driver.Value) ([]*Row, error) {
+	groups := map[string]*rowGroup{}
+	var order []*rowGroup // groups in order found
+	err := db.walkSelect(s, stmt.Joins, stmt.Where, args, nil, func(row *Row) error {
+		ctx := &evalContext{row: row, args: args}
+		key, err := groupKey(stmt.GroupBy, ctx)
+		if err != nil {
+			return err
+		}
+		g := groups[string(key)]
+		if g == nil {
+			g, err = newRowGroup(row, aggs)
+			if err != nil {
+				return err
+			}
+			groups[string(key)] = g
+			order = append(order, g)
+		}
+		for _, state := range g.states {
+			err = state.add(ctx)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(stmt.GroupBy) == 0 && len(order) == 0 {
+		g, err := newRowGroup(nil, aggs)
+		if err != nil {
+			return nil, err
+		}
+		order = append(order, g)
+	}
+	if Verbose >= 2 {
+		fmt.Printf("aggregated %s   groups: %d\n", s.sources[0].name, len(order))
+	}
+
+	var entries []sortEntry
+	var rows []*Row
+	for _, g := range order {
+		ctx := &evalContext{row: g.row, args: args, aggs: make([]*Column, len(g.states))}
+		for i, state := range g.states {
+			ctx.aggs[i], err = state.result()
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if stmt.Having != nil {
+			val, err := stmt.Having.eval(ctx)
+			if err != nil {
+				return nil, err
+			}
+			if !isTrue(val) {
+				continue
+			}
+		}
+
+		row, err := projectRow(fields, ctx)
+		if err != nil {
+			return nil, err
+		}
+		if len(stmt.OrderBy) > 0 {
+			key, err := orderKey(stmt.OrderBy, ctx)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, sortEntry{key: key})
+		}
+		rows = append(rows, row)
+	}
+
+	if len(stmt.OrderBy) > 0 {
+		sort.Stable(&groupSorter{entries: entries, rows: rows})
+	}
+	return rows, nil
+}
+
+// groupSorter sorts rows of groups by their sort key
+type groupSorter struct {
+	entries []sortEntry
+	rows    []*Row
+}
+
+func (s *groupSorter) Len() int { return len(s.rows) }
+
+func (s *groupSorter) Less(i, j int) bool {
+	return bytes.Compare(s.entries[i].key, s.entries[j].key) < 0
+}
+
+func (s *groupSorter) Swap(i, j int) {
+	s.entries[i], s.entries[j] = s.entries[j], s.entries[i]
+	s.rows[i], s.rows[j] = s.rows[j], s.rows[i]
+}
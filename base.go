@@ -7,6 +7,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"time"
 )
 
 // version of furydb
@@ -23,10 +24,38 @@ const (
 	Verbose int = 1
 )
 
+// LockTimeout is how long to wait for other connection to finish its transaction
+var LockTimeout = 5 * time.Second
+
 // various errors
 var (
 	ErrTableNotExist            = fmt.Errorf("no such table")
+	ErrTableExist               = fmt.Errorf("table already exists")
 	ErrColumnNotExist           = fmt.Errorf("no such column")
+	ErrColumnExist              = fmt.Errorf("column already exists")
+	ErrConstraintExist          = fmt.Errorf("constraint already exists")
+	ErrMultiplePrimaryKey       = fmt.Errorf("multiple primary keys")
+	ErrInvalidDefault           = fmt.Errorf("invalid default value")
+	ErrDefaultNotAllowed        = fmt.Errorf("DEFAULT can only be value of INSERT or UPDATE")
+	ErrInvalidLimit             = fmt.Errorf("LIMIT, OFFSET and TOP must be non-negative integer")
+	ErrAggregateNotAllowed      = fmt.Errorf("aggregate function not allowed here")
+	ErrColumnNotGrouped         = fmt.Errorf("column must appear in GROUP BY or be used in aggregate function")
+	ErrInvalidAggregate         = fmt.Errorf("invalid aggregate argument type")
+	ErrIntegerOverflow          = fmt.Errorf("integer out of range")
+	ErrListNotAllowed           = fmt.Errorf("list of values not allowed here")
+	ErrColumnAmbiguous          = fmt.Errorf("column reference is ambiguous")
+	ErrTableNameNotUnique       = fmt.Errorf("table name specified more than once")
+	ErrSubqueryRows             = fmt.Errorf("subquery used as value gives more than one row")
+	ErrSubqueryColumns          = fmt.Errorf("subquery must give one column")
+	ErrValueTypeNotNumber       = fmt.Errorf("value type not number")
+	ErrDivisionByZero           = fmt.Errorf("division by zero")
+	ErrInvalidCast              = fmt.Errorf("value cannot be cast to type")
+	ErrInvalidEscape            = fmt.Errorf("LIKE escape must be one character")
+	ErrInvalidPattern           = fmt.Errorf("LIKE pattern must not end with escape character")
+	ErrInvalidArgument          = fmt.Errorf("invalid function argument")
+	ErrInvalidFunc              = fmt.Errorf("invalid function")
+	ErrFuncExist                = fmt.Errorf("function already exists")
+	ErrInvalidForeignKey        = fmt.Errorf("foreign key must reference unique column")
 	ErrFieldValueLengthNotMatch = fmt.Errorf("columns and values length not match")
 	ErrValueTypeNotBool         = fmt.Errorf("value type not bool")
 	ErrValueTypeNotInt          = fmt.Errorf("value type not int")
@@ -40,8 +69,34 @@ var (
 	ErrUnknownColumnType        = fmt.Errorf("unknown column type")
 	ErrInvalidUUID              = fmt.Errorf("invalid uuid")
 	ErrDataTooBig               = fmt.Errorf("data row too big")
+	ErrArgumentCountNotMatch    = fmt.Errorf("arguments and placeholders count not match")
+	ErrDatabaseLocked           = fmt.Errorf("database is locked")
+	ErrTransactionExist         = fmt.Errorf("transaction already started")
+	ErrTransactionNotExist      = fmt.Errorf("no transaction started")
+	ErrIndexExist               = fmt.Errorf("index already exists")
+	ErrIndexNotExist            = fmt.Errorf("no such index")
+	ErrDuplicateKey             = fmt.Errorf("duplicate key value")
+	ErrForeignKeyNotFound       = fmt.Errorf("referenced row not found")
+	ErrForeignKeyReferenced     = fmt.Errorf("row is still referenced")
 )
 
+// ConstraintError tells which constraint is violated
+type ConstraintError struct {
+	Name  string // name of constraint or unique index
+	Table string // table of the constraint
+	Err   error  // kind of violation, e.g. ErrDuplicateKey, ErrForeignKeyNotFound
+}
+
+// Error implements error interface
+func (e *ConstraintError) Error() string {
+	return fmt.Sprintf("%v, violates constraint %q of table %s", e.Err, e.Name, e.Table)
+}
+
+// Unwrap gives kind of violation, so errors.Is(err, ErrDuplicateKey) can be used
+func (e *ConstraintError) Unwrap() error {
+	return e.Err
+}
+
 // Create new blank database
 func Create(folderpath string, name string) (*Database, error) {
 	db := &Database{
@@ -49,6 +104,7 @@ func Create(folderpath string, name string) (*Database, error) {
 		Name:         name,
 		VersionMajor: VersionMajor,
 		VersionMinor: VersionMinor,
+		sem:          make(chan struct{}, 1),
 	}
 
 	return db, nil
@@ -56,15 +112,16 @@ func Create(folderpath string, name string) (*Database, error) {
 
 // Load existing database
 func Load(folderpath string) (*Database, error) {
-	pathSchema := folderpath + "/schema"
-
-	// file open
-	f, err := os.Open(pathSchema)
+	// redo changes that may not be in the files after unclean shutdown
+	err := recoverWAL(folderpath)
 	if err != nil {
 		return nil, err
 	}
+
+	pathSchema := folderpath + "/schema"
+
 	// file read
-	data, err := ioutil.ReadAll(f)
+	data, err := ioutil.ReadFile(pathSchema)
 	if err != nil {
 		return nil, err
 	}
@@ -75,6 +132,9 @@ func Load(folderpath string) (*Database, error) {
 	if err != nil {
 		return nil, err
 	}
+	// database may have been moved
+	db.Folderpath = folderpath
+	db.sem = make(chan struct{}, 1)
 
 	return &db, nil
 }
@@ -83,12 +143,16 @@ func Load(folderpath string) (*Database, error) {
 func (db *Database) Save(folderpath ...string) error {
 	// update to new folderpath
 	if len(folderpath) > 0 && folderpath[0] != "" && folderpath[0] != db.Folderpath {
+		// log belongs to old folder
+		err := db.closeWAL()
+		if err != nil {
+			return err
+		}
 		db.Folderpath = folderpath[0]
 	}
 
 	// save schema. database, table, column
-	pathSchema := path.Join(db.Folderpath, "schema")
-	size, err := writeFile(pathSchema, db)
+	size, err := db.writeFile("schema", db)
 	if err != nil {
 		return err
 	}
@@ -102,49 +166,53 @@ func (db *Database) Save(folderpath ...string) error {
 
 // Close the database
 func (db *Database) Close() error {
-
-	return nil
+	return db.closeWAL()
 }
 
-// writeFile without retyping lots of code, returns written size
-func writeFile(filepath string, dat interface{}) (int, error) {
-	// convert data to bytes
+// encode data to bytes
+func encode(dat interface{}) ([]byte, error) {
 	buf := bytes.Buffer{}
 	enc := gob.NewEncoder(&buf)
 	err := enc.Encode(dat)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
+	return buf.Bytes(), nil
+}
 
+// writeBytes writes data to file and flush it to disk
+func writeBytes(filepath string, data []byte) error {
 	// create dir if not exist
 	dirpath := path.Dir(filepath)
-	_, err = os.Stat(dirpath)
+	_, err := os.Stat(dirpath)
 	if err != nil && os.IsNotExist(err) {
 		err = os.MkdirAll(dirpath, 0755)
 		if err != nil {
-			return 0, err
+			return err
 		}
 	} else if err != nil {
-		return 0, err
+		return err
 	}
 
 	// file open
 	ptr, err := os.Create(filepath)
 	if err != nil {
-		return 0, err
+		return err
 	}
 	// file write
-	size, err := ptr.Write(buf.Bytes())
+	_, err = ptr.Write(data)
 	if err != nil {
-		return 0, err
+		ptr.Close()
+		return err
 	}
-	// file close
-	err = ptr.Close()
+	// file flush
+	err = ptr.Sync()
 	if err != nil {
-		return 0, err
+		ptr.Close()
+		return err
 	}
-
-	return size, err
+	// file close
+	return ptr.Close()
 }
 
 // isExistTable get table by name
@@ -156,3 +224,18 @@ func (db *Database) findTable(tableName string) (bool, *Table) {
 	}
 	return false, nil
 }
+
+// findColumn get column by name
+func (t *Table) findColumn(columnName string) *Column {
+	for _, col := range t.Columns {
+		if col.Name == columnName {
+			return col
+		}
+	}
+	return nil
+}
+
+// isKey tells if constraint is a key, which can span multiple columns
+func (cstr *Constraint) isKey() bool {
+	return cstr.IsPrimaryKey || cstr.IsUnique || cstr.IsForeignKey
+}
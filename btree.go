@@ -0,0 +1,393 @@
+package furydb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// Note:
+// B+tree index is kept in paged file, page 0 holds page number of root node.
+// Keys are bytes compared with bytes.Compare, so same key is never added twice,
+// index of non unique values make keys unique by adding row id to them.
+// Leaf nodes are linked to next and previous leaf for range scans.
+// Removing key does not merge nodes, empty leaf is skipped by scan.
+// Node layout
+//   [0]     kind, 1 leaf or 2 internal
+//   [1:3]   number of keys
+//   [3:11]  next leaf
+//   [11:19] previous leaf
+//   [19:]   internal node first child, then each key with child it leads to
+//           leaf node each key
+//           key is uvarint length + bytes, child is 8 bytes page number
+
+const (
+	btreeLeaf       byte = 1
+	btreeInternal   byte = 2
+	btreeHeaderSize      = 19
+	btreeNone            = -1   // no page
+	maxIndexKeySize      = 1024 // largest key, so node split leaves fitting nodes
+)
+
+// btree is index in file relative to database folder
+type btree struct {
+	db   *Database
+	path string
+}
+
+// btreeNode is decoded node page
+type btreeNode struct {
+	num      int64 // page number
+	leaf     bool
+	next     int64
+	prev     int64
+	keys     [][]byte
+	children []int64 // internal node only, one more than keys
+}
+
+// decodeBTreeNode converts page to node
+func decodeBTreeNode(num int64, page []byte) (*btreeNode, error) {
+	node := &btreeNode{
+		num:  num,
+		leaf: page[0] == btreeLeaf,
+		next: int64(binary.LittleEndian.Uint64(page[3:])),
+		prev: int64(binary.LittleEndian.Uint64(page[11:])),
+	}
+	if page[0] != btreeLeaf && page[0] != btreeInternal {
+		return nil, fmt.Errorf("index page %d corrupted", num)
+	}
+
+	n := int(binary.LittleEndian.Uint16(page[1:]))
+	pos := btreeHeaderSize
+	if !node.leaf {
+		node.children = append(node.children, int64(binary.LittleEndian.Uint64(page[pos:])))
+		pos += 8
+	}
+	for i := 0; i < n; i++ {
+		size, m := binary.Uvarint(page[pos:])
+		if m <= 0 || pos+m+int(size) > pageSize {
+			return nil, fmt.Errorf("index page %d corrupted", num)
+		}
+		pos += m
+		node.keys = append(node.keys, append([]byte{}, page[pos:pos+int(size)]...))
+		pos += int(size)
+		if !node.leaf {
+			node.children = append(node.children, int64(binary.LittleEndian.Uint64(page[pos:])))
+			pos += 8
+		}
+	}
+	return node, nil
+}
+
+// size gives encoded size of node
+func (node *btreeNode) size() int {
+	size := btreeHeaderSize + len(node.children)*8
+	for _, key := range node.keys {
+		size += len(appendUvarint(nil, uint64(len(key)))) + len(key)
+	}
+	return size
+}
+
+// encode converts node to page, node must fit in page
+func (node *btreeNode) encode() ([]byte, error) {
+	if node.size() > pageSize {
+		return nil, fmt.Errorf("index page %d overflow", node.num)
+	}
+	page := make([]byte, pageSize)
+	page[0] = btreeInternal
+	if node.leaf {
+		page[0] = btreeLeaf
+	}
+	binary.LittleEndian.PutUint16(page[1:], uint16(len(node.keys)))
+	binary.LittleEndian.PutUint64(page[3:], uint64(node.next))
+	binary.LittleEndian.PutUint64(page[11:], uint64(node.prev))
+
+	buf := page[:btreeHeaderSize]
+	tmp := make([]byte, 8)
+	if !node.leaf && len(node.children) > 0 {
+		binary.LittleEndian.PutUint64(tmp, uint64(node.children[0]))
+		buf = append(buf, tmp...)
+	}
+	for i, key := range node.keys {
+		buf = appendUvarint(buf, uint64(len(key)))
+		buf = append(buf, key...)
+		if !node.leaf {
+			binary.LittleEndian.PutUint64(tmp, uint64(node.children[i+1]))
+			buf = append(buf, tmp...)
+		}
+	}
+	return page, nil
+}
+
+// readNode reads node page
+func (t *btree) readNode(num int64) (*btreeNode, error) {
+	page, err := t.db.readPage(t.path, num)
+	if err != nil {
+		return nil, err
+	}
+	return decodeBTreeNode(num, page)
+}
+
+// writeNode writes node page
+func (t *btree) writeNode(node *btreeNode) error {
+	page, err := node.encode()
+	if err != nil {
+		return err
+	}
+	return t.db.writePage(t.path, node.num, page)
+}
+
+// newNode gives node stored in new page at end of file
+func (t *btree) newNode(leaf bool) (*btreeNode, error) {
+	num, err := t.db.numPages(t.path)
+	if err != nil {
+		return nil, err
+	}
+	node := &btreeNode{num: num, leaf: leaf, next: btreeNone, prev: btreeNone}
+	// reserve the page
+	return node, t.writeNode(node)
+}
+
+// root gives page number of root node, btreeNone for empty tree that has no page yet
+func (t *btree) root() (int64, error) {
+	num, err := t.db.numPages(t.path)
+	if err != nil {
+		return 0, err
+	}
+	if num == 0 {
+		return btreeNone, nil
+	}
+
+	page, err := t.db.readPage(t.path, 0)
+	if err != nil {
+		return 0, err
+	}
+	return int64(binary.LittleEndian.Uint64(page)), nil
+}
+
+// setRoot sets page number of root node
+func (t *btree) setRoot(num int64) error {
+	page := make([]byte, pageSize)
+	binary.LittleEndian.PutUint64(page, uint64(num))
+	return t.db.writePage(t.path, 0, page)
+}
+
+// childIndex gives which child of internal node key belongs to
+func (node *btreeNode) childIndex(key []byte) int {
+	return sort.Search(len(node.keys), func(i int) bool {
+		return bytes.Compare(node.keys[i], key) > 0
+	})
+}
+
+// keyIndex gives position of first key in leaf node that is not less than key
+func (node *btreeNode) keyIndex(key []byte) int {
+	return sort.Search(len(node.keys), func(i int) bool {
+		return bytes.Compare(node.keys[i], key) >= 0
+	})
+}
+
+// insert adds key to tree, nothing happens if key already exists
+func (t *btree) insert(key []byte) error {
+	if len(key) > maxIndexKeySize {
+		return ErrDataTooBig
+	}
+	root, err := t.root()
+	if err != nil {
+		return err
+	}
+	if root == btreeNone {
+		// first key, tree is made with leaf as root
+		err = t.setRoot(1)
+		if err != nil {
+			return err
+		}
+		node, err := t.newNode(true)
+		if err != nil {
+			return err
+		}
+		root = node.num
+	}
+	sep, right, err := t.insertNode(root, key)
+	if err != nil || right == nil {
+		return err
+	}
+
+	// root was split, tree grows by one level
+	node, err := t.newNode(false)
+	if err != nil {
+		return err
+	}
+	node.keys = [][]byte{sep}
+	node.children = []int64{root, right.num}
+	err = t.writeNode(node)
+	if err != nil {
+		return err
+	}
+	return t.setRoot(node.num)
+}
+
+// insertNode adds key to subtree, gives separator key and new right node if node was split
+func (t *btree) insertNode(num int64, key []byte) ([]byte, *btreeNode, error) {
+	node, err := t.readNode(num)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if node.leaf {
+		i := node.keyIndex(key)
+		if i < len(node.keys) && bytes.Equal(node.keys[i], key) {
+			return nil, nil, nil
+		}
+		node.keys = append(node.keys, nil)
+		copy(node.keys[i+1:], node.keys[i:])
+		node.keys[i] = key
+	} else {
+		i := node.childIndex(key)
+		sep, right, err := t.insertNode(node.children[i], key)
+		if err != nil || right == nil {
+			return nil, nil, err
+		}
+		node.keys = append(node.keys, nil)
+		copy(node.keys[i+1:], node.keys[i:])
+		node.keys[i] = sep
+		node.children = append(node.children, 0)
+		copy(node.children[i+2:], node.children[i+1:])
+		node.children[i+1] = right.num
+	}
+
+	if node.size() <= pageSize {
+		return nil, nil, t.writeNode(node)
+	}
+	return t.split(node)
+}
+
+// split moves upper half of node to new node, gives separator key and the new node
+func (t *btree) split(node *btreeNode) ([]byte, *btreeNode, error) {
+	right, err := t.newNode(node.leaf)
+	if err != nil {
+		return nil, nil, err
+	}
+	mid := node.splitIndex()
+
+	var sep []byte
+	if node.leaf {
+		sep = node.keys[mid]
+		right.keys = append(right.keys, node.keys[mid:]...)
+		node.keys = node.keys[:mid]
+
+		// link leaves
+		right.next = node.next
+		right.prev = node.num
+		if node.next != btreeNone {
+			next, err := t.readNode(node.next)
+			if err != nil {
+				return nil, nil, err
+			}
+			next.prev = right.num
+			err = t.writeNode(next)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		node.next = right.num
+	} else {
+		// separator moves up
+		sep = node.keys[mid]
+		right.keys = append(right.keys, node.keys[mid+1:]...)
+		right.children = append(right.children, node.children[mid+1:]...)
+		node.keys = node.keys[:mid]
+		node.children = node.children[:mid+1]
+	}
+
+	err = t.writeNode(node)
+	if err != nil {
+		return nil, nil, err
+	}
+	return sep, right, t.writeNode(right)
+}
+
+// splitIndex gives position of key that splits node into halves of about same encoded size
+func (node *btreeNode) splitIndex() int {
+	half := node.size() / 2
+	size := btreeHeaderSize
+	mid := 0
+	for mid < len(node.keys)-1 {
+		size += len(appendUvarint(nil, uint64(len(node.keys[mid])))) + len(node.keys[mid])
+		if !node.leaf {
+			size += 8
+		}
+		if size > half {
+			break
+		}
+		mid++
+	}
+	if mid == 0 {
+		mid = 1
+	}
+	return mid
+}
+
+// remove removes key from tree, nothing happens if key does not exist
+func (t *btree) remove(key []byte) error {
+	num, err := t.root()
+	if err != nil || num == btreeNone {
+		return err
+	}
+	for {
+		node, err := t.readNode(num)
+		if err != nil {
+			return err
+		}
+		if !node.leaf {
+			num = node.children[node.childIndex(key)]
+			continue
+		}
+
+		i := node.keyIndex(key)
+		if i >= len(node.keys) || !bytes.Equal(node.keys[i], key) {
+			return nil
+		}
+		node.keys = append(node.keys[:i], node.keys[i+1:]...)
+		return t.writeNode(node)
+	}
+}
+
+// scan calls fn for keys in order, starting from first key not less than from.
+// Scan stops when fn gives false
+func (t *btree) scan(from []byte, fn func(key []byte) (bool, error)) error {
+	num, err := t.root()
+	if err != nil || num == btreeNone {
+		return err
+	}
+
+	// find leaf
+	node, err := t.readNode(num)
+	if err != nil {
+		return err
+	}
+	for !node.leaf {
+		node, err = t.readNode(node.children[node.childIndex(from)])
+		if err != nil {
+			return err
+		}
+	}
+
+	i := node.keyIndex(from)
+	for {
+		for ; i < len(node.keys); i++ {
+			ok, err := fn(node.keys[i])
+			if err != nil || !ok {
+				return err
+			}
+		}
+		if node.next == btreeNone {
+			return nil
+		}
+		node, err = t.readNode(node.next)
+		if err != nil {
+			return err
+		}
+		i = 0
+	}
+}
@@ -0,0 +1,490 @@
+package furydb
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Note:
+// Arithmetic of two ints gives int, checked for overflow, any float makes it float.
+// String used with number is converted to the number type, same as in comparison.
+// Operation with null gives null, || too, use COALESCE to replace null.
+// CAST allows more conversions than are done implicitly, e.g. float to int is rounded,
+// any value can be cast to string.
+
+// evalArithmetic evaluates + - * / % of two values
+func evalArithmetic(op OperatorType, lhs, rhs *Column) (*Column, error) {
+	if lhs.DataIsNull || rhs.DataIsNull {
+		return &Column{DataIsNull: true}, nil
+	}
+
+	// string is converted to type of the other value
+	var err error
+	if lhs.Type == ColumnTypeString && isNumber(rhs) {
+		lhs, err = coerce(lhs, rhs.Type)
+	} else if rhs.Type == ColumnTypeString && isNumber(lhs) {
+		rhs, err = coerce(rhs, lhs.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !isNumber(lhs) || !isNumber(rhs) {
+		return nil, ErrValueTypeNotNumber
+	}
+
+	if lhs.Type == ColumnTypeInt && rhs.Type == ColumnTypeInt {
+		return intArithmetic(op, lhs.DataInt, rhs.DataInt)
+	}
+	a, b := lhs.DataFloat, rhs.DataFloat
+	if lhs.Type == ColumnTypeInt {
+		a = float64(lhs.DataInt)
+	}
+	if rhs.Type == ColumnTypeInt {
+		b = float64(rhs.DataInt)
+	}
+
+	var f float64
+	switch op {
+	case OperatorTypeAdd:
+		f = a + b
+	case OperatorTypeSubtract:
+		f = a - b
+	case OperatorTypeMultiply:
+		f = a * b
+	case OperatorTypeDivide, OperatorTypeModulo:
+		if b == 0 {
+			return nil, ErrDivisionByZero
+		}
+		if op == OperatorTypeDivide {
+			f = a / b
+		} else {
+			f = math.Mod(a, b)
+		}
+	}
+	return &Column{Type: ColumnTypeFloat, DataFloat: f}, nil
+}
+
+// intArithmetic evaluates + - * / % of two ints, division is truncated toward zero
+func intArithmetic(op OperatorType, a, b int64) (*Column, error) {
+	var n int64
+	switch op {
+	case OperatorTypeAdd:
+		n = a + b
+		if (n > a) != (b > 0) {
+			return nil, ErrIntegerOverflow
+		}
+	case OperatorTypeSubtract:
+		n = a - b
+		if (n < a) != (b > 0) {
+			return nil, ErrIntegerOverflow
+		}
+	case OperatorTypeMultiply:
+		n = a * b
+		if a != 0 && (n/a != b || a == -1 && b == math.MinInt64) {
+			return nil, ErrIntegerOverflow
+		}
+	case OperatorTypeDivide, OperatorTypeModulo:
+		if b == 0 {
+			return nil, ErrDivisionByZero
+		}
+		if b == -1 {
+			// MinInt64 / -1 does not fit
+			if op == OperatorTypeModulo {
+				break
+			}
+			if a == math.MinInt64 {
+				return nil, ErrIntegerOverflow
+			}
+			n = -a
+			break
+		}
+		if op == OperatorTypeDivide {
+			n = a / b
+		} else {
+			n = a % b
+		}
+	}
+	return &Column{Type: ColumnTypeInt, DataInt: n}, nil
+}
+
+// isNumber tells if value is int or float
+func isNumber(val *Column) bool {
+	return val.Type == ColumnTypeInt || val.Type == ColumnTypeFloat
+}
+
+// evalConcat joins two values as strings
+func evalConcat(lhs, rhs *Column) (*Column, error) {
+	if lhs.DataIsNull || rhs.DataIsNull {
+		return &Column{Type: ColumnTypeString, DataIsNull: true}, nil
+	}
+	a, err := castValue(lhs, ColumnTypeString)
+	if err != nil {
+		return nil, err
+	}
+	b, err := castValue(rhs, ColumnTypeString)
+	if err != nil {
+		return nil, err
+	}
+	return &Column{Type: ColumnTypeString, DataString: a.DataString + b.DataString}, nil
+}
+
+// NegExpr is negated number, e.g. -price
+type NegExpr struct {
+	Expr Expr
+}
+
+// String implements Expr
+func (e *NegExpr) String() string {
+	return "-" + e.Expr.String()
+}
+
+func (e *NegExpr) bind(s *scope) error {
+	return e.Expr.bind(s)
+}
+
+func (e *NegExpr) eval(ctx *evalContext) (*Column, error) {
+	val, err := e.Expr.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return evalArithmetic(OperatorTypeSubtract, &Column{Type: ColumnTypeInt}, val)
+}
+
+// CaseExpr is CASE expression, either with conditions, e.g. CASE WHEN qty > 10 THEN 'many' ELSE 'few' END,
+// or with value compared to each WHEN, e.g. CASE kind WHEN 'cat' THEN 1 WHEN 'dog' THEN 2 END
+type CaseExpr struct {
+	Value Expr // value compared to each WHEN, nil if WHEN are conditions
+	Whens []*CaseWhen
+	Else  Expr // value if no WHEN matches, nil gives null
+}
+
+// CaseWhen is WHEN of CASE expression
+type CaseWhen struct {
+	When Expr
+	Then Expr
+}
+
+// String implements Expr
+func (e *CaseExpr) String() string {
+	var b strings.Builder
+	b.WriteString("CASE")
+	if e.Value != nil {
+		b.WriteString(" " + e.Value.String())
+	}
+	for _, w := range e.Whens {
+		b.WriteString(" WHEN " + w.When.String() + " THEN " + w.Then.String())
+	}
+	if e.Else != nil {
+		b.WriteString(" ELSE " + e.Else.String())
+	}
+	b.WriteString(" END")
+	return b.String()
+}
+
+func (e *CaseExpr) bind(s *scope) error {
+	for _, expr := range exprChildren(e) {
+		err := expr.bind(s)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *CaseExpr) eval(ctx *evalContext) (*Column, error) {
+	var val *Column
+	var err error
+	if e.Value != nil {
+		val, err = e.Value.eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, w := range e.Whens {
+		cond, err := w.When.eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		match := false
+		if e.Value != nil {
+			// null never equals
+			if !val.DataIsNull && !cond.DataIsNull {
+				cmp, err := compareColumns(val, cond)
+				if err != nil {
+					return nil, err
+				}
+				match = cmp == 0
+			}
+		} else {
+			if !cond.DataIsNull && cond.Type != ColumnTypeBool {
+				return nil, ErrValueTypeNotBool
+			}
+			match = isTrue(cond)
+		}
+		if match {
+			return w.Then.eval(ctx)
+		}
+	}
+
+	if e.Else == nil {
+		return &Column{DataIsNull: true}, nil
+	}
+	return e.Else.eval(ctx)
+}
+
+// parseCase parses CASE expression after CASE, e.g. WHEN a > 1 THEN 'x' ELSE 'y' END
+func (p *Parser) parseCase() (Expr, error) {
+	var err error
+	expr := &CaseExpr{}
+
+	// optional value compared to each WHEN
+	if tok, _ := p.scanIgnoreWhitespace(); tok != WHEN {
+		p.unscan()
+		expr.Value, err = p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		p.unscan()
+	}
+
+	for {
+		tok, lit := p.scanIgnoreWhitespace()
+		if tok != WHEN {
+			if len(expr.Whens) == 0 {
+				return nil, fmt.Errorf("found %q, expected WHEN", lit)
+			}
+			p.unscan()
+			break
+		}
+		w := &CaseWhen{}
+		w.When, err = p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if tok, lit = p.scanIgnoreWhitespace(); tok != THEN {
+			return nil, fmt.Errorf("found %q, expected THEN", lit)
+		}
+		w.Then, err = p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		expr.Whens = append(expr.Whens, w)
+	}
+
+	// optional ELSE
+	if tok, _ := p.scanIgnoreWhitespace(); tok == ELSE {
+		expr.Else, err = p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		p.unscan()
+	}
+
+	if tok, lit := p.scanIgnoreWhitespace(); tok != END {
+		return nil, fmt.Errorf("found %q, expected END", lit)
+	}
+	return expr, nil
+}
+
+// CastExpr converts value to column type, e.g. CAST(price AS INT)
+type CastExpr struct {
+	Expr     Expr
+	Type     ColumnType
+	TypeName string // type as written
+}
+
+// String implements Expr
+func (e *CastExpr) String() string {
+	return "CAST(" + e.Expr.String() + " AS " + e.TypeName + ")"
+}
+
+func (e *CastExpr) bind(s *scope) error {
+	return e.Expr.bind(s)
+}
+
+func (e *CastExpr) eval(ctx *evalContext) (*Column, error) {
+	val, err := e.Expr.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return castValue(val, e.Type)
+}
+
+// parseCast parses CAST after CAST, e.g. (price AS INT)
+func (p *Parser) parseCast() (Expr, error) {
+	var err error
+	expr := &CastExpr{}
+
+	if tok, lit := p.scanIgnoreWhitespace(); tok != LEFTPAR {
+		return nil, fmt.Errorf("found %q, expected (", lit)
+	}
+	expr.Expr, err = p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if tok, lit := p.scanIgnoreWhitespace(); tok != AS {
+		return nil, fmt.Errorf("found %q, expected AS", lit)
+	}
+
+	tok, lit := p.scanIgnoreWhitespace()
+	if tok != IDENT {
+		return nil, fmt.Errorf("found %q, expected type", lit)
+	}
+	expr.Type, err = parseColumnType(lit)
+	if err != nil {
+		return nil, err
+	}
+	expr.TypeName = strings.ToUpper(lit)
+
+	// type size is ignored, e.g. VARCHAR(255)
+	if tok, _ = p.scanIgnoreWhitespace(); tok == LEFTPAR {
+		if tok, lit = p.scanIgnoreWhitespace(); tok != NUMBER {
+			return nil, fmt.Errorf("found %q, expected type size", lit)
+		}
+		tok, lit = p.scanIgnoreWhitespace()
+		if tok != RIGHTPAR {
+			return nil, fmt.Errorf("found %q, expected )", lit)
+		}
+		tok, lit = p.scanIgnoreWhitespace()
+	}
+	if tok != RIGHTPAR {
+		return nil, fmt.Errorf("found %q, expected )", lit)
+	}
+	return expr, nil
+}
+
+// castValue converts value to column type, null stays null
+func castValue(val *Column, typ ColumnType) (*Column, error) {
+	if val.DataIsNull {
+		return &Column{Type: typ, DataIsNull: true}, nil
+	}
+	if val.Type == typ {
+		return val, nil
+	}
+
+	res := &Column{Type: typ}
+	switch {
+	case typ == ColumnTypeString:
+		switch val.Type {
+		case ColumnTypeBool:
+			res.DataString = strconv.FormatBool(val.DataBool)
+		case ColumnTypeInt:
+			res.DataString = strconv.FormatInt(val.DataInt, 10)
+		case ColumnTypeFloat:
+			res.DataString = strconv.FormatFloat(val.DataFloat, 'g', -1, 64)
+		case ColumnTypeTime:
+			res.DataString = val.DataTime.Format(time.RFC3339Nano)
+		case ColumnTypeBytes:
+			res.DataString = string(val.DataBytes)
+		case ColumnTypeUUID:
+			res.DataString = UUIDBinToStr(val.DataUUID)
+		default:
+			return nil, ErrInvalidCast
+		}
+	case val.Type == ColumnTypeString:
+		err := parseValue(res, strings.TrimSpace(val.DataString))
+		if err != nil && typ == ColumnTypeBytes {
+			res.DataBytes = []byte(val.DataString)
+		} else if err != nil {
+			return nil, err
+		}
+	case typ == ColumnTypeInt && val.Type == ColumnTypeFloat:
+		f := math.Round(val.DataFloat)
+		if math.IsNaN(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+			return nil, ErrIntegerOverflow
+		}
+		res.DataInt = int64(f)
+	case typ == ColumnTypeInt && val.Type == ColumnTypeBool:
+		if val.DataBool {
+			res.DataInt = 1
+		}
+	case typ == ColumnTypeFloat && val.Type == ColumnTypeInt:
+		res.DataFloat = float64(val.DataInt)
+	case typ == ColumnTypeBool && val.Type == ColumnTypeInt:
+		res.DataBool = val.DataInt != 0
+	case typ == ColumnTypeBytes && val.Type == ColumnTypeUUID:
+		res.DataBytes = append([]byte{}, val.DataUUID[:]...)
+	case typ == ColumnTypeUUID && val.Type == ColumnTypeBytes:
+		if len(val.DataBytes) != len(res.DataUUID) {
+			return nil, ErrInvalidUUID
+		}
+		copy(res.DataUUID[:], val.DataBytes)
+	default:
+		return nil, ErrInvalidCast
+	}
+	return res, nil
+}
+
+// CoalesceExpr gives first value that is not null, e.g. COALESCE(nickname, name, 'unknown')
+type CoalesceExpr struct {
+	Args []Expr
+}
+
+// String implements Expr
+func (e *CoalesceExpr) String() string {
+	return "COALESCE" + (&ListExpr{Items: e.Args}).String()
+}
+
+func (e *CoalesceExpr) bind(s *scope) error {
+	return (&ListExpr{Items: e.Args}).bind(s)
+}
+
+func (e *CoalesceExpr) eval(ctx *evalContext) (*Column, error) {
+	var val *Column
+	for _, arg := range e.Args {
+		var err error
+		val, err = arg.eval(ctx)
+		if err != nil || !val.DataIsNull {
+			return val, err
+		}
+	}
+	return val, nil
+}
+
+// NullIfExpr gives null if both values are equal, otherwise the first value, e.g. NULLIF(qty, 0)
+type NullIfExpr struct {
+	LHS Expr
+	RHS Expr
+}
+
+// String implements Expr
+func (e *NullIfExpr) String() string {
+	return "NULLIF(" + e.LHS.String() + ", " + e.RHS.String() + ")"
+}
+
+func (e *NullIfExpr) bind(s *scope) error {
+	err := e.LHS.bind(s)
+	if err != nil {
+		return err
+	}
+	return e.RHS.bind(s)
+}
+
+func (e *NullIfExpr) eval(ctx *evalContext) (*Column, error) {
+	lhs, err := e.LHS.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rhs, err := e.RHS.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if lhs.DataIsNull || rhs.DataIsNull {
+		return lhs, nil
+	}
+	cmp, err := compareColumns(lhs, rhs)
+	if err != nil {
+		return nil, err
+	}
+	if cmp == 0 {
+		return &Column{Type: lhs.Type, DataIsNull: true}, nil
+	}
+	return lhs, nil
+}
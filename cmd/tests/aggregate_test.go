@@ -0,0 +1,156 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/comomac/furydb"
+)
+
+// queryRows runs query and returns all rows, columns of a row are joined by |
+func queryRows(tdb *sql.DB, query string, args ...interface{}) ([]string, error) {
+	rows, err := tdb.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	res := []string{}
+	for rows.Next() {
+		vals := make([]interface{}, len(columns))
+		ptrs := make([]interface{}, len(columns))
+		for i := range vals {
+			ptrs[i] = &vals[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		strs := make([]string, len(vals))
+		for i, val := range vals {
+			switch v := val.(type) {
+			case nil:
+				strs[i] = "NULL"
+			case time.Time:
+				strs[i] = v.Format("2006-01-02")
+			case []byte:
+				strs[i] = string(v)
+			default:
+				strs[i] = fmt.Sprint(v)
+			}
+		}
+		res = append(res, strings.Join(strs, "|"))
+	}
+	return res, rows.Err()
+}
+
+// TestAggregate aggregate functions with GROUP BY and HAVING
+func TestAggregate(t *testing.T) {
+	tdb := openTestDB(t, "tmp-aggregate")
+	defer tdb.Close()
+
+	execAll(t, tdb,
+		`CREATE TABLE sales (id INT PRIMARY KEY, region STRING, item STRING, qty INT, price FLOAT, sold TIME)`,
+		`INSERT INTO sales (id, region, item, qty, price, sold) VALUES (1, 'north', 'apple', 3, 1.5, '2020-01-03')`,
+		`INSERT INTO sales (id, region, item, qty, price, sold) VALUES (2, 'north', 'pear', 5, 2, '2020-01-01')`,
+		`INSERT INTO sales (id, region, item, qty, price, sold) VALUES (3, 'south', 'apple', 2, 1.5, '2020-02-01')`,
+		`INSERT INTO sales (id, region, item, qty, price, sold) VALUES (4, 'south', 'apple', 7, 1, '2019-12-31')`,
+		`INSERT INTO sales (id, region, item, qty) VALUES (5, 'east', 'fig', 1)`,
+		`INSERT INTO sales (id, region, item) VALUES (6, NULL, 'fig')`,
+	)
+
+	tests := map[string]string{
+		"SELECT (COUNT(*)) FROM sales":                                               "6",
+		"SELECT (count(*), COUNT(qty), COUNT(price), COUNT(region)) FROM sales":      "6|5|4|5",
+		"SELECT (COUNT(DISTINCT item), COUNT(DISTINCT region)) FROM sales":           "3|3",
+		"SELECT (SUM(qty), SUM(price), AVG(qty), AVG(price)) FROM sales":             "18|6|3.6|1.5",
+		"SELECT (SUM(DISTINCT qty), AVG(DISTINCT price)) FROM sales":                 "18|1.5",
+		"SELECT (MIN(qty), MAX(qty), MIN(item), MAX(item)) FROM sales":               "1|7|apple|pear",
+		"SELECT (MIN(sold), MAX(sold)) FROM sales":                                   "2019-12-31|2020-02-01",
+		"SELECT (COUNT(*), SUM(qty), MIN(qty), AVG(price)) FROM sales WHERE id > 10": "0|NULL|NULL|NULL",
+		"SELECT (COUNT(*)) FROM sales WHERE item = 'apple'":                          "3",
+		"SELECT (region, COUNT(*), SUM(qty)) FROM sales GROUP BY region ORDER BY region": "NULL|1|NULL " +
+			"east|1|1 north|2|8 south|2|9",
+		"SELECT (region, item, COUNT(*)) FROM sales GROUP BY region, item ORDER BY region DESC, item": "south|apple|2 " +
+			"north|apple|1 north|pear|1 east|fig|1 NULL|fig|1",
+		"SELECT (item, SUM(qty)) FROM sales GROUP BY item HAVING SUM(qty) > 1 ORDER BY SUM(qty) DESC": "apple|12 pear|5",
+		"SELECT (item) FROM sales GROUP BY item HAVING COUNT(*) = 2 AND MAX(qty) < 5":                 "fig",
+		"SELECT (item) FROM sales GROUP BY item HAVING COUNT(*) >= 2 ORDER BY item":                   "apple fig",
+		"SELECT (item, MAX(price)) FROM sales WHERE qty > 1 GROUP BY item ORDER BY item LIMIT 1":      "apple|1.5",
+		"SELECT (item) FROM sales GROUP BY item ORDER BY COUNT(*) DESC, item LIMIT 2 OFFSET 1":        "fig pear",
+		"SELECT (qty > 2, COUNT(*)) FROM sales GROUP BY qty > 2 ORDER BY qty > 2":                     "NULL|1 false|2 true|3",
+		"SELECT (COUNT(*)) FROM sales GROUP BY region HAVING region = 'north'":                        "2",
+		"SELECT (COUNT(*)) FROM sales WHERE id > 10 GROUP BY region":                                  "",
+		"SELECT (MAX(qty)) FROM sales HAVING COUNT(*) > 100":                                          "",
+	}
+	for query, want := range tests {
+		rows, err := queryRows(tdb, query)
+		if err != nil {
+			t.Error(fmt.Errorf("%s: %v", query, err))
+			continue
+		}
+		if strings.Join(rows, " ") != want {
+			t.Error(fmt.Errorf("%s: expected %s, got %v", query, want, rows))
+		}
+	}
+
+	// columns are named after aggregate function
+	rows, err := tdb.Query("SELECT (region, COUNT(*), max(qty)) FROM sales GROUP BY region")
+	if err != nil {
+		t.Fatal(err)
+	}
+	columns, err := rows.Columns()
+	if err != nil || strings.Join(columns, ",") != "region,count,max" {
+		t.Error(fmt.Errorf("invalid columns %v %v", columns, err))
+	}
+	if err = rows.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// int sum overflow
+	execAll(t, tdb, `INSERT INTO sales (id, qty) VALUES (7, 9223372036854775807)`)
+	if _, err = queryRows(tdb, "SELECT (SUM(qty)) FROM sales"); err != furydb.ErrIntegerOverflow {
+		t.Error(fmt.Errorf("expected %v, got %v", furydb.ErrIntegerOverflow, err))
+	}
+
+	errs := map[string]error{
+		"SELECT (SUM(item)) FROM sales":                              furydb.ErrInvalidAggregate,
+		"SELECT (AVG(sold)) FROM sales":                              furydb.ErrInvalidAggregate,
+		"SELECT (item, COUNT(*)) FROM sales":                         furydb.ErrColumnNotGrouped,
+		"SELECT (item) FROM sales GROUP BY region":                   furydb.ErrColumnNotGrouped,
+		"SELECT * FROM sales GROUP BY region":                        furydb.ErrColumnNotGrouped,
+		"SELECT (COUNT(*)) FROM sales GROUP BY region ORDER BY item": furydb.ErrColumnNotGrouped,
+		"SELECT (region) FROM sales WHERE COUNT(*) > 1":              furydb.ErrAggregateNotAllowed,
+		"SELECT (COUNT(*)) FROM sales GROUP BY COUNT(*)":             furydb.ErrAggregateNotAllowed,
+		"SELECT (MAX(COUNT(*))) FROM sales":                          furydb.ErrAggregateNotAllowed,
+		"SELECT (COUNT(nope)) FROM sales":                            furydb.ErrColumnNotExist,
+	}
+	for query, want := range errs {
+		if _, err = queryRows(tdb, query); err != want {
+			t.Error(fmt.Errorf("%s: expected %v, got %v", query, want, err))
+		}
+	}
+	if _, err = tdb.Exec("UPDATE sales SET qty = COUNT(*) WHERE id = 1"); err != furydb.ErrAggregateNotAllowed {
+		t.Error(fmt.Errorf("expected %v, got %v", furydb.ErrAggregateNotAllowed, err))
+	}
+
+	bad := []string{
+		"SELECT (SUM(*)) FROM sales",
+		"SELECT (COUNT(qty) FROM sales",
+		"SELECT (nope(qty)) FROM sales",
+		"SELECT (COUNT(*)) FROM sales GROUP region",
+		"SELECT (COUNT(*)) FROM sales GROUP BY",
+		"SELECT (COUNT(*)) FROM sales ORDER BY id GROUP BY region",
+	}
+	for _, query := range bad {
+		if _, err = queryRows(tdb, query); err == nil {
+			t.Error(fmt.Errorf("%s: expected error", query))
+		}
+	}
+}
@@ -3,9 +3,13 @@ package main
 import (
 	"database/sql"
 	"fmt"
+	"os"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/comomac/furydb"
+	"github.com/davecgh/go-spew/spew"
 )
 
 // holder so tests can use same connection without reconnect to db
@@ -17,6 +21,12 @@ var (
 // TestCreate db, written this before the parser is made
 func TestCreate(t *testing.T) {
 	var err error
+	// start from clean state
+	err = os.RemoveAll("tmp-db")
+	if err != nil {
+		t.Error(err)
+	}
+
 	fdb, err = furydb.Create("tmp-db", "testme")
 	if err != nil {
 		t.Error(err)
@@ -172,7 +182,181 @@ func TestSqlDriverTableCreate(t *testing.T) {
 		t.Error(fmt.Errorf("db not loaded"))
 		return
 	}
-	// todo finish me
+
+	query := `
+	CREATE TABLE orders (
+		id UUID,
+		user_id UUID,
+		total FLOAT,
+		quantity INT,
+		note STRING,
+		paid BOOL,
+		receipt BYTES,
+		created_at TIME
+	);
+	`
+
+	// run create query
+	_, err := db.Exec(query)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	// table already exists
+	_, err = db.Exec(query)
+	if err != furydb.ErrTableExist {
+		t.Error(fmt.Errorf("expected table exists error, got %v", err))
+	}
+
+	// unknown column type
+	_, err = db.Exec("CREATE TABLE bad (id SERIAL)")
+	if err != furydb.ErrUnknownColumnType {
+		t.Error(fmt.Errorf("expected unknown column type error, got %v", err))
+	}
+
+	// schema should be saved
+	fdb2, err := furydb.Load("tmp-db")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	var table *furydb.Table
+	for _, tbl := range fdb2.Tables {
+		if tbl.Name == "orders" {
+			table = tbl
+		}
+	}
+	if table == nil {
+		t.Error(fmt.Errorf("table not saved"))
+		return
+	}
+	types := []furydb.ColumnType{
+		furydb.ColumnTypeUUID,
+		furydb.ColumnTypeUUID,
+		furydb.ColumnTypeFloat,
+		furydb.ColumnTypeInt,
+		furydb.ColumnTypeString,
+		furydb.ColumnTypeBool,
+		furydb.ColumnTypeBytes,
+		furydb.ColumnTypeTime,
+	}
+	if len(table.Columns) != len(types) {
+		t.Error(fmt.Errorf("invalid column len"))
+		return
+	}
+	for i, col := range table.Columns {
+		if col.Type != types[i] {
+			t.Error(fmt.Errorf("invalid column type for %s", col.Name))
+		}
+	}
+
+	// table data dir should exist
+	if _, err = os.Stat("tmp-db/orders"); err != nil {
+		t.Error(err)
+	}
+
+	// new table is usable straight away
+	query = `
+	INSERT INTO orders (id,user_id,total,quantity,note)
+	VALUES ('2a4b1ad0-9d8c-4b4e-8d59-6fa3a27d1c0e','0583e443-015a-0b3e-0f19-6bce4dfdd638',12.5,3,'first order');
+	`
+	_, err = db.Exec(query)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+// TestSqlDriverTableCreateConstraints
+func TestSqlDriverTableCreateConstraints(t *testing.T) {
+	if db == nil {
+		t.Error(fmt.Errorf("db not loaded"))
+		return
+	}
+
+	query := `
+	-- user sessions
+	CREATE TABLE sessions (
+		id UUID PRIMARY KEY DEFAULT gen_uuid_v4(),
+		user_id UUID NOT NULL REFERENCES users,
+		token VARCHAR(64) CONSTRAINT "cstr-token" UNIQUE NOT NULL,
+		hits INT DEFAULT 0,
+		score FLOAT DEFAULT -1.5,
+		label STRING NULL DEFAULT 'it''s',
+		active BOOL DEFAULT true,
+		created_at TIME DEFAULT now()
+	);
+	CREATE TABLE memberships (
+		user_id UUID,
+		session_id UUID,
+		CONSTRAINT "cstr-pk" PRIMARY KEY (user_id, session_id),
+		FOREIGN KEY (session_id) REFERENCES sessions (id)
+	)
+	`
+	queries := strings.Split(query, ";")
+	for _, q := range queries[:2] {
+		_, err := db.Exec(q)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	// invalid constraints
+	badQueries := map[string]error{
+		"CREATE TABLE bad (a INT PRIMARY KEY, b INT PRIMARY KEY)":                           furydb.ErrMultiplePrimaryKey,
+		"CREATE TABLE bad (a INT PRIMARY KEY, b INT, PRIMARY KEY (b))":                      furydb.ErrMultiplePrimaryKey,
+		"CREATE TABLE bad (a INT UNIQUE, b INT, CONSTRAINT \"cstr-unique-a\" UNIQUE (b))":   furydb.ErrConstraintExist,
+		"CREATE TABLE bad (a INT CONSTRAINT x PRIMARY KEY, b INT CONSTRAINT y PRIMARY KEY)": furydb.ErrMultiplePrimaryKey,
+		"CREATE TABLE bad (a INT, PRIMARY KEY (b))":                                         furydb.ErrColumnNotExist,
+		"CREATE TABLE bad (a INT REFERENCES nope)":                                          furydb.ErrTableNotExist,
+		"CREATE TABLE bad (a INT REFERENCES users (id))":                                    furydb.ErrValueTypeNotMatch,
+		"CREATE TABLE bad (a STRING REFERENCES users (password))":                           furydb.ErrInvalidForeignKey,
+		"CREATE TABLE bad (a INT DEFAULT 'x')":                                              furydb.ErrValueTypeNotInt,
+		"CREATE TABLE bad (a INT DEFAULT now())":                                            furydb.ErrInvalidDefault,
+	}
+	for q, expected := range badQueries {
+		_, err := db.Exec(q)
+		if err != expected {
+			t.Error(fmt.Errorf("%s: expected %v, got %v", q, expected, err))
+		}
+	}
+
+	fdb2, err := furydb.Load("tmp-db")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	constraints := map[string][]*furydb.Constraint{}
+	for _, tbl := range fdb2.Tables {
+		constraints[tbl.Name] = tbl.Constraints
+	}
+
+	expected := []*furydb.Constraint{
+		{Name: "cstr-pk", ColumnName: "id", Type: furydb.ColumnTypeUUID, IsPrimaryKey: true, IsUnique: true, IsNotNull: true},
+		{Name: "cstr-id", ColumnName: "id", Type: furydb.ColumnTypeUUID, UseDefaultData: true, DefaultDataUUID: "gen_uuid_v4()"},
+		{Name: "cstr-user_id", ColumnName: "user_id", Type: furydb.ColumnTypeUUID, IsNotNull: true},
+		{Name: "cstr-fk-user_id", ColumnName: "user_id", Type: furydb.ColumnTypeUUID, IsForeignKey: true, ForeignTable: "users", ForeignColumn: "id"},
+		{Name: "cstr-token", ColumnName: "token", Type: furydb.ColumnTypeString, IsUnique: true},
+		{Name: "cstr-token", ColumnName: "token", Type: furydb.ColumnTypeString, IsNotNull: true},
+		{Name: "cstr-hits", ColumnName: "hits", Type: furydb.ColumnTypeInt, UseDefaultData: true},
+		{Name: "cstr-score", ColumnName: "score", Type: furydb.ColumnTypeFloat, UseDefaultData: true, DefaultDataFloat: -1.5},
+		{Name: "cstr-label", ColumnName: "label", Type: furydb.ColumnTypeString, UseDefaultData: true, DefaultDataString: "it's"},
+		{Name: "cstr-active", ColumnName: "active", Type: furydb.ColumnTypeBool, UseDefaultData: true, DefaultDataBool: true},
+		{Name: "cstr-created_at", ColumnName: "created_at", Type: furydb.ColumnTypeTime, UseDefaultData: true, DefaultDataTime: "now()"},
+	}
+	if !reflect.DeepEqual(constraints["sessions"], expected) {
+		t.Error(fmt.Errorf("invalid sessions constraints %s", spew.Sdump(constraints["sessions"])))
+	}
+
+	expected = []*furydb.Constraint{
+		{Name: "cstr-pk", ColumnName: "user_id", Type: furydb.ColumnTypeUUID, IsPrimaryKey: true, IsUnique: true, IsNotNull: true},
+		{Name: "cstr-pk", ColumnName: "session_id", Type: furydb.ColumnTypeUUID, IsPrimaryKey: true, IsUnique: true, IsNotNull: true},
+		{Name: "cstr-fk-session_id", ColumnName: "session_id", Type: furydb.ColumnTypeUUID, IsForeignKey: true, ForeignTable: "sessions", ForeignColumn: "id"},
+	}
+	if !reflect.DeepEqual(constraints["memberships"], expected) {
+		t.Error(fmt.Errorf("invalid memberships constraints %s", spew.Sdump(constraints["memberships"])))
+	}
 }
 
 // TestSqlDriverInsert
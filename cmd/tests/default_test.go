@@ -0,0 +1,171 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/comomac/furydb"
+)
+
+// TestDefault omitted columns and DEFAULT values get default of the column
+func TestDefault(t *testing.T) {
+	tdb := openTestDB(t, "tmp-default")
+	defer tdb.Close()
+
+	execAll(t, tdb,
+		`CREATE TABLE sessions (
+			id UUID PRIMARY KEY DEFAULT gen_uuid_v4(),
+			name STRING,
+			hits INT DEFAULT 7,
+			score FLOAT DEFAULT -1.5,
+			label STRING DEFAULT 'it''s',
+			active BOOL DEFAULT true,
+			data BYTES DEFAULT '\xff00',
+			since TIME DEFAULT '2020-01-02',
+			owner UUID DEFAULT '0583e443-015a-0b3e-0f19-6bce4dfdd638',
+			created_at TIME DEFAULT now()
+		)`,
+	)
+
+	before := time.Now().Add(-time.Second)
+	execAll(t, tdb,
+		`INSERT INTO sessions (name) VALUES ('a')`,
+		`INSERT INTO sessions (name) VALUES ('b')`,
+		`INSERT INTO sessions (name, hits, label) VALUES ('c', DEFAULT, 'x')`,
+		`INSERT INTO sessions (name, hits, active) VALUES ('d', 1, false)`,
+	)
+	after := time.Now().Add(time.Second)
+
+	rows, err := tdb.Query("SELECT (id, name, hits, score, label, active, data, since, owner, created_at) FROM sessions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := map[string]bool{}
+	for rows.Next() {
+		var (
+			id, name, label, owner string
+			hits                   int
+			score                  float64
+			active                 bool
+			data                   []byte
+			since, createdAt       time.Time
+		)
+		err = rows.Scan(&id, &name, &hits, &score, &label, &active, &data, &since, &owner, &createdAt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[id] = true
+
+		wantHits, wantLabel, wantActive := 7, "it's", true
+		switch name {
+		case "c":
+			wantLabel = "x"
+		case "d":
+			wantHits, wantActive = 1, false
+		}
+		if hits != wantHits || label != wantLabel || active != wantActive || score != -1.5 {
+			t.Error(fmt.Errorf("%s: invalid values %d %q %v %v", name, hits, label, active, score))
+		}
+		if string(data) != "\xff\x00" || !since.Equal(time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)) {
+			t.Error(fmt.Errorf("%s: invalid values %x %v", name, data, since))
+		}
+		if owner != "0583e443-015a-0b3e-0f19-6bce4dfdd638" {
+			t.Error(fmt.Errorf("%s: invalid owner %s", name, owner))
+		}
+		if createdAt.Before(before) || createdAt.After(after) {
+			t.Error(fmt.Errorf("%s: invalid created_at %v", name, createdAt))
+		}
+	}
+	if err = rows.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 4 {
+		t.Error(fmt.Errorf("expected 4 generated ids, got %d", len(ids)))
+	}
+
+	// DEFAULT in update
+	execAll(t, tdb, "UPDATE sessions SET hits = DEFAULT, label = DEFAULT WHERE name = 'c' OR name = 'd'")
+	vals, err := queryStrings(tdb, "SELECT (name) FROM sessions WHERE hits = 7 AND label = 'it''s'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameStrings(vals, []string{"a", "b", "c", "d"}) {
+		t.Error(fmt.Errorf("invalid names %v", vals))
+	}
+
+	// DEFAULT is not a value elsewhere
+	if _, err = tdb.Exec("SELECT (name) FROM sessions WHERE hits = DEFAULT"); err != furydb.ErrDefaultNotAllowed {
+		t.Error(fmt.Errorf("expected %v, got %v", furydb.ErrDefaultNotAllowed, err))
+	}
+
+	// uuid primary key without default is generated, other primary key must be given
+	execAll(t, tdb,
+		`CREATE TABLE tokens (id UUID PRIMARY KEY, name STRING)`,
+		`INSERT INTO tokens (name) VALUES ('a')`,
+		`INSERT INTO tokens (id, name) VALUES (DEFAULT, 'b')`,
+		`CREATE TABLE counters (id INT PRIMARY KEY, name STRING)`,
+	)
+	vals, err = queryStrings(tdb, "SELECT id FROM tokens WHERE id IS NOT NULL")
+	if err != nil || len(vals) != 2 || vals[0] == vals[1] || len(vals[0]) != 36 {
+		t.Error(fmt.Errorf("expected 2 generated ids, got %v %v", vals, err))
+	}
+	if _, err = tdb.Exec("INSERT INTO counters (name) VALUES ('a')"); !errors.Is(err, furydb.ErrColumnNotNullable) {
+		t.Error(fmt.Errorf("expected %v, got %v", furydb.ErrColumnNotNullable, err))
+	}
+}
+
+// TestDefaultSchema defaults of schema made in go code, function can be given in DefaultDataUUID
+func TestDefaultSchema(t *testing.T) {
+	folder := "tmp-default2"
+	err := os.RemoveAll(folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fdb, err := furydb.Create(folder, "defaults")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fdb.Tables = []*furydb.Table{
+		{
+			Name: "users",
+			Columns: []*furydb.Column{
+				{Name: "id", Type: furydb.ColumnTypeUUID},
+				{Name: "email", Type: furydb.ColumnTypeString},
+				{Name: "created_at", Type: furydb.ColumnTypeTime},
+			},
+			Constraints: []*furydb.Constraint{
+				{Name: "cstr-pk", ColumnName: "id", IsPrimaryKey: true, IsUnique: true, DefaultDataUUID: "gen_uuid_v4()"},
+				{Name: "cstr-created_at", ColumnName: "created_at", DefaultDataUUID: "now()"},
+			},
+		},
+	}
+	if err = fdb.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if err = fdb.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tdb, err := sql.Open("fury", folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tdb.Close()
+	execAll(t, tdb,
+		"INSERT INTO users (email) VALUES ('ann@test.com')",
+		"INSERT INTO users (email) VALUES ('bob@test.com')",
+	)
+
+	var id, createdAt string
+	err = tdb.QueryRow("SELECT (id, created_at) FROM users WHERE email = 'bob@test.com'").Scan(&id, &createdAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(id) != 36 || createdAt == "" {
+		t.Error(fmt.Errorf("invalid defaults %q %q", id, createdAt))
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+// TestDelete remove rows that match where
+func TestDelete(t *testing.T) {
+	tdb := openTestDB(t, "tmp-delete")
+	defer tdb.Close()
+
+	execAll(t, tdb,
+		`CREATE TABLE notes (id UUID PRIMARY KEY, body STRING, stars INT)`,
+		`INSERT INTO notes (id,body,stars) VALUES ('00000000-0000-0000-0000-000000000001','one',1);`,
+		`INSERT INTO notes (id,body,stars) VALUES ('00000000-0000-0000-0000-000000000002','two',2);`,
+		`INSERT INTO notes (id,body,stars) VALUES ('00000000-0000-0000-0000-000000000003','three',3);`,
+	)
+
+	res, err := tdb.Exec("DELETE FROM notes WHERE stars >= 2 AND body <> 'three';")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := res.RowsAffected(); n != 1 {
+		t.Error(fmt.Errorf("expected 1 row affected, got %d", n))
+	}
+	bodies, err := queryStrings(tdb, "SELECT (body) FROM notes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameStrings(bodies, []string{"one", "three"}) {
+		t.Error(fmt.Errorf("expected one and three, got %v", bodies))
+	}
+
+	// deleted rows are not updated
+	res, err = tdb.Exec("UPDATE notes SET stars = 5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := res.RowsAffected(); n != 2 {
+		t.Error(fmt.Errorf("expected 2 rows affected, got %d", n))
+	}
+
+	// deleted rows are not deleted again
+	res, err = tdb.Exec("DELETE FROM notes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := res.RowsAffected(); n != 2 {
+		t.Error(fmt.Errorf("expected 2 rows affected, got %d", n))
+	}
+	bodies, err = queryStrings(tdb, "SELECT (body) FROM notes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bodies) != 0 {
+		t.Error(fmt.Errorf("expected no rows, got %v", bodies))
+	}
+
+	// same key can be inserted again
+	execAll(t, tdb, `INSERT INTO notes (id,body,stars) VALUES ('00000000-0000-0000-0000-000000000002','again',2);`)
+	bodies, err = queryStrings(tdb, "SELECT (body) FROM notes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameStrings(bodies, []string{"again"}) {
+		t.Error(fmt.Errorf("expected again, got %v", bodies))
+	}
+
+	// invalid deletes
+	for _, q := range []string{"DELETE FROM nope", "DELETE notes", "DELETE FROM notes WHERE nope = 1"} {
+		if _, err := tdb.Exec(q); err == nil {
+			t.Error(fmt.Errorf("%s: expected error", q))
+		}
+	}
+}
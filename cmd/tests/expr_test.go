@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/comomac/furydb"
+)
+
+// TestExpressions arithmetic, ||, CASE, CAST, COALESCE and NULLIF
+func TestExpressions(t *testing.T) {
+	tdb := openTestDB(t, "tmp-expr")
+	defer tdb.Close()
+
+	execAll(t, tdb,
+		`CREATE TABLE items (id INT PRIMARY KEY, name STRING NOT NULL, qty INT, price FLOAT, kind STRING, added TIME)`,
+		`INSERT INTO items (id, name, qty, price, kind, added) VALUES (1, 'apple', 3, 1.5, 'fruit', '2020-01-02')`,
+		`INSERT INTO items (id, name, qty, price, kind) VALUES (2, 'pear', 10, 2, 'fruit')`,
+		`INSERT INTO items (id, name, price, kind) VALUES (3, 'kale', 4.25, 'veg')`,
+		`INSERT INTO items (id, name, qty) VALUES (4, 'salt', 0)`,
+	)
+
+	tests := map[string]string{
+		"SELECT 1 + 2 * 3, (1 + 2) * 3, 7 / 2, 7 % 3, -7 / 2, 7.0 / 2 FROM items WHERE id = 1": "7|9|3|1|-3|3.5",
+		"SELECT qty * price, qty - 1, -qty, price + 1, 2 - -qty FROM items WHERE id = 1":       "4.5|2|-3|2.5|5",
+		"SELECT id-1, id - 1 FROM items WHERE id = 2":                                          "1|1",
+		"SELECT qty + 1, qty || 'x', -qty FROM items WHERE id = 3":                             "NULL|NULL|NULL",
+		"SELECT name || ' x' || qty, name || price FROM items WHERE id = 1":                    "apple x3|apple1.5",
+		"SELECT '2' + qty, qty * '2' FROM items WHERE id = 1":                                  "5|6",
+		"SELECT name FROM items WHERE qty * 2 > 5 ORDER BY id":                                 "apple pear",
+		"SELECT name FROM items WHERE qty * price > 0 ORDER BY qty * price DESC":               "pear apple",
+		"SELECT name, CASE WHEN qty > 5 THEN 'many' WHEN qty > 0 THEN 'some' ELSE 'none' END FROM items ORDER BY id": "apple|some " +
+			"pear|many kale|none salt|none",
+		"SELECT CASE kind WHEN 'fruit' THEN 1 WHEN 'veg' THEN 2 END AS k FROM items ORDER BY id":                            "1 1 2 NULL",
+		"SELECT CAST(price AS INT), CAST(qty AS STRING), CAST('12' AS INT), CAST(qty AS FLOAT) / 2 FROM items WHERE id = 1": "2|3|12|1.5",
+		"SELECT CAST(added AS VARCHAR(20)), CAST('2020-01-05' AS TIME) FROM items WHERE id = 1":                             "2020-01-02T00:00:00Z|2020-01-05",
+		"SELECT CAST(1 AS BOOL), CAST(TRUE AS INT), CAST(' 5 ' AS INT), CAST(NULL AS INT) FROM items WHERE id = 1":          "true|1|5|NULL",
+		"SELECT COALESCE(qty, -1), COALESCE(kind, name) FROM items ORDER BY id":                                             "3|fruit 10|fruit -1|veg 0|salt",
+		"SELECT NULLIF(qty, 0), NULLIF(qty, 3), 10 / NULLIF(qty, 0) FROM items WHERE id = 4":                                "NULL|0|NULL",
+		"SELECT SUM(qty * price), MAX(qty) - MIN(qty) FROM items":                                                           "24.5|10",
+		"SELECT kind, SUM(qty) + 1 FROM items WHERE kind = 'fruit' GROUP BY kind":                                           "fruit|14",
+		"SELECT qty % 4 AS r, COUNT(*) FROM items WHERE qty >= 0 GROUP BY qty % 4 ORDER BY r":                               "0|1 2|1 3|1",
+		"SELECT name FROM items WHERE qty <> 0 AND 10 / qty > 1 ORDER BY id":                                                "apple",
+		"SELECT name FROM items WHERE qty = 0 OR 10 / qty > 2 ORDER BY id":                                                  "apple salt",
+		"SELECT qty <> 0 AND 10 / qty > 1, FALSE AND 1 / 0 > 1, TRUE OR 1 / 0 > 1 FROM items WHERE id = 4":                  "false|false|true",
+	}
+	for query, want := range tests {
+		rows, err := queryRows(tdb, query)
+		if err != nil {
+			t.Error(fmt.Errorf("%s: %v", query, err))
+			continue
+		}
+		if strings.Join(rows, " ") != want {
+			t.Error(fmt.Errorf("%s: expected %s, got %v", query, want, rows))
+		}
+	}
+
+	// expressions in SET and VALUES
+	execAll(t, tdb,
+		`UPDATE items SET qty = qty + 5, name = name || '!' WHERE id = 1`,
+		`INSERT INTO items (id, name, qty, price) VALUES (2 * 3, 'fig' || 's', 4 - 5, CAST('2.5' AS FLOAT))`,
+	)
+	rows, err := queryRows(tdb, "SELECT id, name, qty, price FROM items WHERE id = 1 OR id = 6 ORDER BY id")
+	if err != nil || strings.Join(rows, " ") != "1|apple!|8|1.5 6|figs|-1|2.5" {
+		t.Error(fmt.Errorf("expected updated and inserted rows, got %v %v", rows, err))
+	}
+	rows, err = queryRows(tdb, "SELECT name FROM items WHERE id = ? + 1", 5)
+	if err != nil || strings.Join(rows, " ") != "figs" {
+		t.Error(fmt.Errorf("expected figs, got %v %v", rows, err))
+	}
+
+	errs := map[string]error{
+		"SELECT 1 / 0 FROM items":                                       furydb.ErrDivisionByZero,
+		"SELECT 1.5 % 0 FROM items":                                     furydb.ErrDivisionByZero,
+		"SELECT name + 1 FROM items WHERE id = 1":                       furydb.ErrValueTypeNotInt,
+		"SELECT added + 1 FROM items WHERE id = 1":                      furydb.ErrValueTypeNotNumber,
+		"SELECT 9223372036854775807 + 1 FROM items WHERE id = 1":        furydb.ErrIntegerOverflow,
+		"SELECT -9223372036854775808 / -1 FROM items WHERE id = 1":      furydb.ErrIntegerOverflow,
+		"SELECT CAST(name AS INT) FROM items WHERE id = 1":              furydb.ErrValueTypeNotInt,
+		"SELECT CAST(price AS TIME) FROM items WHERE id = 1":            furydb.ErrInvalidCast,
+		"SELECT CASE WHEN qty THEN 1 END FROM items WHERE id = 1":       furydb.ErrValueTypeNotBool,
+		"SELECT name FROM items WHERE id = 1 AND COALESCE(nope, 1) = 1": furydb.ErrColumnNotExist,
+	}
+	for query, want := range errs {
+		if _, err = queryRows(tdb, query); err != want {
+			t.Error(fmt.Errorf("%s: expected %v, got %v", query, want, err))
+		}
+	}
+
+	bad := []string{
+		"SELECT CASE END FROM items",
+		"SELECT CASE WHEN 1 THEN 2 FROM items",
+		"SELECT CAST(1 INT) FROM items",
+		"SELECT CAST(1 AS NOPE) FROM items",
+		"SELECT COALESCE() FROM items",
+		"SELECT NULLIF(1) FROM items",
+		"SELECT 1 + FROM items",
+		"SELECT name | 'x' FROM items",
+	}
+	for _, query := range bad {
+		if _, err = queryRows(tdb, query); err == nil {
+			t.Error(fmt.Errorf("%s: expected error", query))
+		}
+	}
+}
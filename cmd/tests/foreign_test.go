@@ -0,0 +1,172 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/comomac/furydb"
+)
+
+// TestForeignKey referencing rows are checked, and referenced rows apply ON DELETE and ON UPDATE action
+func TestForeignKey(t *testing.T) {
+	tdb := openTestDB(t, "tmp-foreign")
+	defer tdb.Close()
+
+	execAll(t, tdb,
+		`CREATE TABLE users (id INT PRIMARY KEY, name STRING)`,
+		`CREATE TABLE posts (id INT PRIMARY KEY, user_id INT REFERENCES users (id) ON DELETE CASCADE ON UPDATE CASCADE)`,
+		`CREATE TABLE comments (id INT PRIMARY KEY, post_id INT, user_id INT REFERENCES users,
+			CONSTRAINT comment_post FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE SET NULL)`,
+		`CREATE TABLE profiles (id INT PRIMARY KEY, user_id INT DEFAULT 0 REFERENCES users ON DELETE SET DEFAULT ON UPDATE RESTRICT)`,
+		`CREATE TABLE employees (id INT PRIMARY KEY, manager_id INT REFERENCES employees (id) ON DELETE CASCADE ON UPDATE SET NULL)`,
+		`INSERT INTO users (id, name) VALUES (0, 'nobody')`,
+		`INSERT INTO users (id, name) VALUES (1, 'ann')`,
+		`INSERT INTO users (id, name) VALUES (2, 'bob')`,
+		`INSERT INTO users (id, name) VALUES (3, 'cid')`,
+		`INSERT INTO posts (id, user_id) VALUES (10, 1)`,
+		`INSERT INTO posts (id, user_id) VALUES (11, 1)`,
+		`INSERT INTO posts (id, user_id) VALUES (12, 2)`,
+		`INSERT INTO comments (id, post_id, user_id) VALUES (100, 10, 2)`,
+		`INSERT INTO comments (id, post_id, user_id) VALUES (101, 12, 3)`,
+		`INSERT INTO comments (id, post_id, user_id) VALUES (102, 11, 3)`,
+		`INSERT INTO profiles (id, user_id) VALUES (1, 1)`,
+		`INSERT INTO profiles (id, user_id) VALUES (3, 3)`,
+		`INSERT INTO employees (id, manager_id) VALUES (1, 1)`,
+		`INSERT INTO employees (id, manager_id) VALUES (2, 1)`,
+		`INSERT INTO employees (id, manager_id) VALUES (3, 2)`,
+		`INSERT INTO employees (id) VALUES (4)`,
+	)
+
+	// referencing rows
+	tests := []struct {
+		query string
+		cstr  string
+		err   error
+	}{
+		{"INSERT INTO posts (id, user_id) VALUES (13, 99)", "cstr-fk-user_id", furydb.ErrForeignKeyNotFound},
+		{"INSERT INTO posts (id) VALUES (13)", "", nil},
+		{"UPDATE posts SET user_id = 99 WHERE id = 13", "cstr-fk-user_id", furydb.ErrForeignKeyNotFound},
+		{"UPDATE posts SET user_id = 3 WHERE id = 13", "", nil},
+		{"INSERT INTO comments (id, post_id) VALUES (103, 99)", "comment_post", furydb.ErrForeignKeyNotFound},
+		{"INSERT INTO employees (id, manager_id) VALUES (5, 5)", "", nil},
+		// restrict
+		{"DELETE FROM users WHERE id = 2", "cstr-fk-user_id", furydb.ErrForeignKeyReferenced},
+		{"UPDATE users SET id = 30 WHERE id = 3", "cstr-fk-user_id", furydb.ErrForeignKeyReferenced},
+		{"UPDATE users SET name = 'bo' WHERE id = 2", "", nil},
+	}
+	for _, test := range tests {
+		_, err := tdb.Exec(test.query)
+		if test.err == nil {
+			if err != nil {
+				t.Error(fmt.Errorf("%s: %v", test.query, err))
+			}
+			continue
+		}
+		var cerr *furydb.ConstraintError
+		if !errors.As(err, &cerr) || cerr.Name != test.cstr || !errors.Is(err, test.err) {
+			t.Error(fmt.Errorf("%s: expected %v of %s, got %v", test.query, test.err, test.cstr, err))
+		}
+	}
+
+	// check gives error if query does not give the values
+	check := func(query string, want ...string) {
+		vals, err := queryStrings(tdb, query)
+		if err != nil {
+			t.Fatal(fmt.Errorf("%s: %v", query, err))
+		}
+		if !sameStrings(vals, want) {
+			t.Error(fmt.Errorf("%s: expected %v, got %v", query, want, vals))
+		}
+	}
+
+	// rejected delete removed nothing
+	check("SELECT (id) FROM posts WHERE user_id = 2", "12")
+	check("SELECT (id) FROM users", "0", "1", "2", "3")
+
+	// on delete set null
+	execAll(t, tdb, "DELETE FROM posts WHERE id = 12")
+	check("SELECT (id) FROM comments WHERE post_id = 12")
+	check("SELECT (id) FROM comments", "100", "101", "102")
+
+	// on update cascade
+	execAll(t, tdb,
+		"DELETE FROM comments WHERE user_id = 2",
+		"UPDATE users SET id = 20 WHERE id = 2",
+		"INSERT INTO posts (id, user_id) VALUES (14, 20)",
+	)
+	check("SELECT (id) FROM posts WHERE user_id = 20", "14")
+
+	// on delete cascade, followed by set null of comments and set default of profiles
+	execAll(t, tdb, "DELETE FROM users WHERE id = 1")
+	check("SELECT (id) FROM posts", "13", "14")
+	check("SELECT (id) FROM comments", "101", "102")
+	check("SELECT (id) FROM comments WHERE post_id = 11")
+	check("SELECT (user_id) FROM profiles WHERE id = 1", "0")
+	check("SELECT (user_id) FROM profiles WHERE id = 3", "3")
+
+	// self reference cascade
+	execAll(t, tdb, "DELETE FROM employees WHERE id = 1")
+	check("SELECT (id) FROM employees", "4", "5")
+	execAll(t, tdb, "UPDATE employees SET id = 50 WHERE id = 5")
+	check("SELECT (id) FROM employees", "4", "50")
+	check("SELECT (id) FROM employees WHERE manager_id = 5")
+	check("SELECT (id) FROM employees WHERE manager_id = 50")
+
+	// whole table with self reference
+	res, err := tdb.Exec("DELETE FROM employees")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := res.RowsAffected(); n != 2 {
+		t.Error(fmt.Errorf("expected 2 rows deleted, got %d", n))
+	}
+
+	// referenced column must be unique by itself
+	execAll(t, tdb,
+		`CREATE TABLE pairs (id INT PRIMARY KEY, a INT, b INT, c INT UNIQUE, UNIQUE (a, b))`,
+		`CREATE TABLE pair_c (id INT PRIMARY KEY, c INT REFERENCES pairs (c))`,
+		`CREATE TABLE keys2 (a INT, b INT, PRIMARY KEY (a, b))`,
+	)
+	for _, query := range []string{
+		`CREATE TABLE pair_a (id INT PRIMARY KEY, a INT REFERENCES pairs (a))`,
+		`CREATE TABLE pair_b (id INT PRIMARY KEY, b INT REFERENCES pairs (b))`,
+		`CREATE TABLE keys2_a (id INT PRIMARY KEY, a INT REFERENCES keys2 (a))`,
+		`CREATE TABLE keys2_pk (id INT PRIMARY KEY, a INT REFERENCES keys2)`,
+	} {
+		if _, err = tdb.Exec(query); err != furydb.ErrInvalidForeignKey {
+			t.Error(fmt.Errorf("%s: expected %v, got %v", query, furydb.ErrInvalidForeignKey, err))
+		}
+	}
+
+	// foreign key of all columns of composite key, columns given or taken from primary key
+	execAll(t, tdb,
+		`CREATE TABLE keys2_ab (id INT PRIMARY KEY, a INT, b INT, FOREIGN KEY (a, b) REFERENCES keys2 (a, b))`,
+		`CREATE TABLE keys2_ba (id INT PRIMARY KEY, a INT, b INT, CONSTRAINT ba FOREIGN KEY (b, a) REFERENCES keys2 (b, a))`,
+		`CREATE TABLE keys2_def (id INT PRIMARY KEY, a INT, b INT, FOREIGN KEY (a, b) REFERENCES keys2)`,
+		`CREATE TABLE pairs_ab (id INT PRIMARY KEY, a INT, b INT, FOREIGN KEY (a, b) REFERENCES pairs (a, b))`,
+		`INSERT INTO keys2 (a, b) VALUES (1, 2)`,
+		`INSERT INTO keys2_ab (id, a, b) VALUES (1, 1, 2)`,
+		`INSERT INTO keys2_def (id, a, b) VALUES (1, 1, 2)`,
+		`INSERT INTO keys2_ab (id, a) VALUES (2, 1)`,
+	)
+	for _, query := range []string{
+		"INSERT INTO keys2_ab (id, a, b) VALUES (3, 2, 1)",
+		"INSERT INTO keys2_def (id, a, b) VALUES (3, 1, 3)",
+		"INSERT INTO pairs_ab (id, a, b) VALUES (1, 1, 2)",
+		"UPDATE keys2_ab SET b = 3 WHERE id = 1",
+		"DELETE FROM keys2 WHERE a = 1",
+	} {
+		if _, err = tdb.Exec(query); !errors.Is(err, furydb.ErrForeignKeyNotFound) && !errors.Is(err, furydb.ErrForeignKeyReferenced) {
+			t.Error(fmt.Errorf("%s: expected foreign key error, got %v", query, err))
+		}
+	}
+	for _, query := range []string{
+		`CREATE TABLE keys2_a2 (id INT PRIMARY KEY, a INT, FOREIGN KEY (a, a) REFERENCES keys2 (a, a))`,
+		`CREATE TABLE keys2_ac (id INT PRIMARY KEY, a INT, c INT, FOREIGN KEY (a, c) REFERENCES pairs (a, c))`,
+	} {
+		if _, err = tdb.Exec(query); err == nil {
+			t.Error(fmt.Errorf("%s: expected error", query))
+		}
+	}
+}
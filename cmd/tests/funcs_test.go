@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/comomac/furydb"
+)
+
+// TestScalarFuncs string, math, date and uuid functions
+func TestScalarFuncs(t *testing.T) {
+	tdb := openTestDB(t, "tmp-funcs")
+	defer tdb.Close()
+
+	execAll(t, tdb,
+		`CREATE TABLE people (id INT PRIMARY KEY, name STRING, score FLOAT, born TIME, uid UUID DEFAULT gen_random_uuid())`,
+		`INSERT INTO people (id, name, score, born) VALUES (1, '  Ada Lovelace ', 91.256, '2020-05-17 13:45:30')`,
+		`INSERT INTO people (id, name, score, born) VALUES (2, 'Émile', -3.5, '2021-12-31')`,
+		`INSERT INTO people (id) VALUES (3)`,
+	)
+
+	tests := map[string]string{
+		"SELECT LOWER(name), UPPER(name), LENGTH(name), CHAR_LENGTH('ab') FROM people WHERE id = 2":                                                 "émile|ÉMILE|5|2",
+		"SELECT TRIM(name), LTRIM(name), RTRIM(name), TRIM('xxaxx', 'x') FROM people WHERE id = 1":                                                  "Ada Lovelace|Ada Lovelace |  Ada Lovelace|a",
+		"SELECT SUBSTR('hello', 2), SUBSTR('hello', 2, 3), SUBSTRING('hello', 0, 3), SUBSTR('hello', 9) FROM people WHERE id = 1":                   "ello|ell|he|",
+		"SELECT SUBSTR(name, 2, 3), REVERSE(name), STRPOS(name, 'mi'), STRPOS(name, 'x') FROM people WHERE id = 2":                                  "mil|elimÉ|2|0",
+		"SELECT REPLACE('a-b-c', '-', '+'), REPLACE('abc', '', 'x'), REPEAT('ab', 3), REPEAT('ab', -1) FROM people WHERE id = 1":                    "a+b+c|abc|ababab|",
+		"SELECT LPAD('7', 3, '0'), RPAD('ab', 5, 'xy'), LPAD('hello', 2), RPAD('a', 3) || '|' FROM people WHERE id = 1":                             "007|abxyx|he|a  |",
+		"SELECT CONCAT(name, '#', id, NULL, score) FROM people ORDER BY id":                                                                         "  Ada Lovelace #191.256 Émile#2-3.5 #3",
+		"SELECT ABS(-4), ABS(score), SIGN(score), SIGN(0) FROM people WHERE id = 2":                                                                 "4|3.5|-1|0",
+		"SELECT ROUND(score), ROUND(score, 2), ROUND(1255, -1), ROUND(-1245, -2), ROUND(7) FROM people WHERE id = 1":                                "91|91.26|1260|-1200|7",
+		"SELECT ROUND(score), FLOOR(score), CEIL(score), CEILING(5) FROM people WHERE id = 2":                                                       "-4|-4|-3|5",
+		"SELECT MOD(7, 3), MOD(-7.5, 2), SQRT(16), POWER(2, 10), SQRT('2.25') FROM people WHERE id = 1":                                             "1|-1.5|4|1024|1.5",
+		"SELECT DATE_TRUNC('month', born), CAST(DATE_TRUNC('hour', born) AS STRING), DATE_TRUNC('week', born) FROM people WHERE id = 1":             "2020-05-01|2020-05-17T13:00:00Z|2020-05-11",
+		"SELECT DATE_TRUNC('year', born), DATE_TRUNC('quarter', born) FROM people WHERE id = 2":                                                     "2021-01-01|2021-10-01",
+		"SELECT EXTRACT(YEAR FROM born), EXTRACT(month FROM born), DATE_PART('day', born), DATE_PART('dow', born) FROM people WHERE id = 1":         "2020|5|17|0",
+		"SELECT DATE_PART('hour', born), DATE_PART('minute', born), DATE_PART('second', born), DATE_PART('quarter', born) FROM people WHERE id = 1": "13|45|30|2",
+		"SELECT DATE_ADD(born, 1, 'day'), DATE_ADD(born, -2, 'month'), CAST(DATE_ADD(born, 90, 'minute') AS STRING) FROM people WHERE id = 2":       "2022-01-01|2021-10-31|2021-12-31T01:30:00Z",
+		"SELECT id FROM people WHERE EXTRACT(year FROM born) = 2021":                                                                                "2",
+		"SELECT LOWER(name), ABS(score), DATE_PART('year', born), LENGTH(NULL) FROM people WHERE id = 3":                                            "NULL|NULL|NULL|NULL",
+		"SELECT UPPER(TRIM(name)) AS n FROM people WHERE LENGTH(TRIM(name)) > 5 ORDER BY LOWER(name)":                                               "ADA LOVELACE",
+		"SELECT lower('X'), Abs(-1) FROM people WHERE id = 1":                                                                                       "x|1",
+	}
+	for query, want := range tests {
+		rows, err := queryRows(tdb, query)
+		if err != nil {
+			t.Error(fmt.Errorf("%s: %v", query, err))
+			continue
+		}
+		if strings.Join(rows, " ") != want {
+			t.Error(fmt.Errorf("%s: expected %s, got %v", query, want, rows))
+		}
+	}
+
+	// functions giving new value every time
+	var now time.Time
+	var random float64
+	var uid, uid2 string
+	err := tdb.QueryRow("SELECT NOW(), RANDOM(), GEN_RANDOM_UUID(), uid FROM people WHERE id = 3").Scan(&now, &random, &uid, &uid2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(now) > time.Minute || random < 0 || random >= 1 || len(uid) != 36 || len(uid2) != 36 || uid == uid2 {
+		t.Error(fmt.Errorf("invalid values %v %v %v %v", now, random, uid, uid2))
+	}
+	execAll(t, tdb, `UPDATE people SET name = UPPER(SUBSTR(name, 1, 1)) || 'x', born = DATE_ADD(born, 1, 'year') WHERE id = 2`)
+	rows, err := queryRows(tdb, "SELECT name, born FROM people WHERE id = 2")
+	if err != nil || strings.Join(rows, " ") != "Éx|2022-12-31" {
+		t.Error(fmt.Errorf("expected updated row, got %v %v", rows, err))
+	}
+
+	errs := map[string]error{
+		"SELECT LOWER(id) FROM people":                              furydb.ErrValueTypeNotString,
+		"SELECT ABS(name) FROM people WHERE id = 1":                 furydb.ErrValueTypeNotNumber,
+		"SELECT ABS(born) FROM people":                              furydb.ErrValueTypeNotNumber,
+		"SELECT DATE_PART('year', score) FROM people":               furydb.ErrValueTypeNotTime,
+		"SELECT DATE_PART('year', 'nope') FROM people":              furydb.ErrValueTypeNotTime,
+		"SELECT SUBSTR(name, 'x') FROM people WHERE id = 1":         furydb.ErrValueTypeNotInt,
+		"SELECT SUBSTR(name, 1, -1) FROM people WHERE id = 1":       furydb.ErrInvalidArgument,
+		"SELECT SQRT(-1) FROM people WHERE id = 1":                  furydb.ErrInvalidArgument,
+		"SELECT DATE_TRUNC('nope', born) FROM people WHERE id = 1":  furydb.ErrInvalidArgument,
+		"SELECT DATE_ADD(born, 1, 'nope') FROM people WHERE id = 1": furydb.ErrInvalidArgument,
+		"SELECT ABS(-9223372036854775808) FROM people WHERE id = 1": furydb.ErrIntegerOverflow,
+		"SELECT REPEAT('x', 100000) FROM people WHERE id = 1":       furydb.ErrDataTooBig,
+		"SELECT LOWER(nope) FROM people":                            furydb.ErrColumnNotExist,
+	}
+	for query, want := range errs {
+		if _, err = queryRows(tdb, query); err != want {
+			t.Error(fmt.Errorf("%s: expected %v, got %v", query, want, err))
+		}
+	}
+
+	bad := []string{
+		"SELECT NOPE(1) FROM people",
+		"SELECT LOWER() FROM people",
+		"SELECT LOWER('a', 'b') FROM people",
+		"SELECT SUBSTR('a') FROM people",
+		"SELECT NOW(1) FROM people",
+		"SELECT EXTRACT(YEAR born) FROM people",
+		"SELECT EXTRACT('year' FROM born) FROM people",
+		"CREATE TABLE t1 (id INT DEFAULT random())",
+		"CREATE TABLE t2 (t TIME DEFAULT gen_random_uuid())",
+	}
+	for _, query := range bad {
+		if _, err = tdb.Exec(query); err == nil {
+			t.Error(fmt.Errorf("%s: expected error", query))
+		}
+	}
+}
@@ -4,4 +4,7 @@ go 1.15
 
 replace github.com/comomac/furydb => ../../
 
-require github.com/comomac/furydb v0.0.0-00010101000000-000000000000
+require (
+	github.com/comomac/furydb v0.0.0-00010101000000-000000000000
+	github.com/davecgh/go-spew v1.1.1
+)
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestHeapStorage rows are kept in pages of single heap file
+func TestHeapStorage(t *testing.T) {
+	tdb := openTestDB(t, "tmp-heap")
+	defer tdb.Close()
+
+	execAll(t, tdb, `CREATE TABLE notes (num INT, body STRING)`)
+
+	// enough rows to span many pages
+	tx, err := tdb.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stmt, err := tx.Prepare("INSERT INTO notes (num, body) VALUES (?, ?)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3000; i++ {
+		if _, err = stmt.Exec(i, fmt.Sprintf("note %d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stmt.Close()
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := ioutil.ReadDir("tmp-heap/notes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, file := range files {
+		names = append(names, file.Name())
+	}
+	if !sameStrings(names, []string{"fsm", "heap"}) {
+		t.Error(fmt.Errorf("invalid table files %v", names))
+	}
+	info, err := os.Stat("tmp-heap/notes/heap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size()%8192 != 0 || info.Size() < 2*8192 {
+		t.Error(fmt.Errorf("invalid heap size %d", info.Size()))
+	}
+	// free space map of few pages fits in one page
+	fsmInfo, err := os.Stat("tmp-heap/notes/fsm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fsmInfo.Size() != 8192 {
+		t.Error(fmt.Errorf("invalid free space map size %d", fsmInfo.Size()))
+	}
+
+	nums, err := queryStrings(tdb, "SELECT (body) FROM notes WHERE num >= 2998")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameStrings(nums, []string{"note 2998", "note 2999"}) {
+		t.Error(fmt.Errorf("invalid bodies %v", nums))
+	}
+
+	// space of deleted rows is reused
+	res, err := tdb.Exec("DELETE FROM notes WHERE num < 1500")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := res.RowsAffected(); n != 1500 {
+		t.Error(fmt.Errorf("expected 1500 rows deleted, got %d", n))
+	}
+	for i := 0; i < 100; i++ {
+		if _, err = tdb.Exec("INSERT INTO notes (num, body) VALUES (?, 'again')", 5000+i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	info2, err := os.Stat("tmp-heap/notes/heap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info2.Size() != info.Size() {
+		t.Error(fmt.Errorf("heap grew from %d to %d", info.Size(), info2.Size()))
+	}
+
+	// row larger than its free space moves to another page
+	long := strings.Repeat("x", 4000)
+	if _, err = tdb.Exec("UPDATE notes SET body = ? WHERE num = 2000 OR num = 2001 OR num = 2002", long); err != nil {
+		t.Fatal(err)
+	}
+	bodies, err := queryStrings(tdb, "SELECT (body) FROM notes WHERE num = 2000 OR num = 2001 OR num = 2002")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameStrings(bodies, []string{long, long, long}) {
+		t.Error(fmt.Errorf("invalid long bodies, got %d rows", len(bodies)))
+	}
+	nums, err = queryStrings(tdb, "SELECT (num) FROM notes WHERE num >= 1500")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nums) != 1600 {
+		t.Error(fmt.Errorf("expected 1600 rows, got %d", len(nums)))
+	}
+
+	// row bigger than page
+	if _, err = tdb.Exec("INSERT INTO notes (num, body) VALUES (1, ?)", strings.Repeat("x", 9000)); err == nil {
+		t.Error(fmt.Errorf("expected data too big error"))
+	}
+}
+
+// TestHeapCorruptRow row that cannot be decoded gives error instead of being skipped
+func TestHeapCorruptRow(t *testing.T) {
+	tdb := openTestDB(t, "tmp-heap-corrupt")
+	execAll(t, tdb,
+		`CREATE TABLE notes (num INT, body STRING)`,
+		`INSERT INTO notes (num, body) VALUES (1, 'first')`,
+	)
+	if err := tdb.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// column count of the only row is more than its data
+	dat, err := ioutil.ReadFile("tmp-heap-corrupt/notes/heap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	offset := int(binary.LittleEndian.Uint16(dat[4:]))
+	dat[offset] = 0x7f
+	if err = ioutil.WriteFile("tmp-heap-corrupt/notes/heap", dat, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tdb, err = sql.Open("fury", "tmp-heap-corrupt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tdb.Close()
+	for _, query := range []string{"SELECT * FROM notes", "UPDATE notes SET num = 2", "DELETE FROM notes"} {
+		if _, err = queryRows(tdb, query); err == nil || !strings.Contains(err.Error(), "corrupted") {
+			t.Error(fmt.Errorf("%s: expected corrupted row error, got %v", query, err))
+		}
+	}
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/comomac/furydb"
+)
+
+// keyCol matches key column in condition
+var keyCol = regexp.MustCompile(`\bk\b`)
+
+// TestPrimaryKeyIndex rows found by primary key match rows found by full scan
+func TestPrimaryKeyIndex(t *testing.T) {
+	tdb := openTestDB(t, "tmp-index")
+	defer tdb.Close()
+
+	// every key column has same value in copy column without index
+	execAll(t, tdb,
+		`CREATE TABLE ints (k INT PRIMARY KEY, v INT)`,
+		`CREATE TABLE floats (k FLOAT PRIMARY KEY, v FLOAT)`,
+		`CREATE TABLE strs (k STRING PRIMARY KEY, v STRING)`,
+		`CREATE TABLE times (k TIME PRIMARY KEY, v TIME)`,
+		`CREATE TABLE uuids (k UUID PRIMARY KEY, v UUID)`,
+	)
+
+	// enough rows for tree of several levels
+	tx, err := tdb.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := -1000; i < 1000; i++ {
+		values := map[string]interface{}{
+			"ints":   i,
+			"floats": float64(i) / 4,
+			"strs":   fmt.Sprintf("key %05d %s", i+1000, strings.Repeat("x", 100)),
+			"times":  base.Add(time.Duration(i) * time.Minute),
+			"uuids":  fmt.Sprintf("00000000-0000-0000-0000-%012x", i+1000),
+		}
+		for table, value := range values {
+			_, err = tx.Exec(fmt.Sprintf("INSERT INTO %s (k, v) VALUES (?, ?)", table), value, value)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat("tmp-index/strs/pk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() < 10*8192 {
+		t.Error(fmt.Errorf("index too small %d", info.Size()))
+	}
+
+	t1 := base.Add(-5 * time.Minute).Format(time.RFC3339)
+	t2 := base.Add(5 * time.Minute).Format(time.RFC3339)
+	conds := map[string][]string{
+		"ints": {
+			"k = 5", "k = -1000", "k = 999", "k = 1000", "k > 990", "k >= 990", "k < -990", "k <= -990",
+			"k > -3 AND k < 3", "k >= -3 AND k <= 3 AND k <> 0", "-3 < k AND 3 >= k", "k > 3 AND k < -3",
+			"k = 2.5", "k < 2.5 AND k > -2.5", "k > 5 OR k < -995", "k >= 10 AND k >= 20 AND k < 30 AND k <= 25",
+		},
+		"floats": {"k = 0.25", "k = 0", "k > 249.5", "k < -249.5", "k >= -1 AND k <= 1", "k = 3"},
+		"strs": {
+			"k = 'key 01000 " + strings.Repeat("x", 100) + "'",
+			"k > 'key 01990'", "k >= 'key 00010' AND k < 'key 00020'", "k < 'key'",
+		},
+		"times": {"k = '" + t1 + "'", "k > '" + t1 + "' AND k <= '" + t2 + "'", "k < '2019-12-31T23:00:00Z'"},
+		"uuids": {
+			"k = '00000000-0000-0000-0000-0000000003e8'",
+			"k > '00000000-0000-0000-0000-0000000007c0'",
+			"k >= '00000000-0000-0000-0000-000000000010' AND k < '00000000-0000-0000-0000-000000000020'",
+		},
+	}
+	for table, list := range conds {
+		for _, cond := range list {
+			byIndex, err := queryStrings(tdb, fmt.Sprintf("SELECT (k) FROM %s WHERE %s", table, cond))
+			if err != nil {
+				t.Fatal(fmt.Errorf("%s %s: %v", table, cond, err))
+			}
+			byScan, err := queryStrings(tdb, fmt.Sprintf("SELECT (v) FROM %s WHERE %s", table, keyCol.ReplaceAllString(cond, "v")))
+			if err != nil {
+				t.Fatal(fmt.Errorf("%s %s: %v", table, cond, err))
+			}
+			if !sameStrings(byIndex, byScan) {
+				t.Error(fmt.Errorf("%s WHERE %s: index gives %d rows, scan gives %d", table, cond, len(byIndex), len(byScan)))
+			}
+		}
+	}
+
+	// placeholders
+	keys, err := queryStrings(tdb, "SELECT (v) FROM ints WHERE k >= ? AND k < ?", 10, 13)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameStrings(keys, []string{"10", "11", "12"}) {
+		t.Error(fmt.Errorf("invalid keys %v", keys))
+	}
+
+	// index follows changed and removed keys
+	execAll(t, tdb,
+		"UPDATE ints SET k = 5000 WHERE k = 5",
+		"DELETE FROM ints WHERE k >= 6 AND k < 10",
+	)
+	tests := map[string][]string{
+		"k = 5":                {},
+		"k = 5000":             {"5"},
+		"k >= 4 AND k < 11":    {"4", "10"},
+		"k > 4000":             {"5"},
+		"k >= 4 AND k <= 5000": nil,
+	}
+	for cond, want := range tests {
+		vals, err := queryStrings(tdb, "SELECT (v) FROM ints WHERE "+cond)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want != nil && !sameStrings(vals, want) {
+			t.Error(fmt.Errorf("WHERE %s: invalid values %v", cond, vals))
+		}
+		if want == nil && len(vals) != 992 {
+			t.Error(fmt.Errorf("WHERE %s: expected 992 rows, got %d", cond, len(vals)))
+		}
+	}
+}
+
+// TestSecondaryIndex create, use and drop index
+func TestSecondaryIndex(t *testing.T) {
+	folder := "tmp-index2"
+	tdb := openTestDB(t, folder)
+
+	execAll(t, tdb,
+		`CREATE TABLE users (id INT PRIMARY KEY, email STRING, first_name STRING, last_name STRING)`,
+		`INSERT INTO users (id, email, first_name, last_name) VALUES (1, 'ann@test.com', 'Ann', 'Lee')`,
+		`INSERT INTO users (id, email, first_name, last_name) VALUES (2, 'bob@test.com', 'Bob', 'Lee')`,
+		`INSERT INTO users (id, first_name, last_name) VALUES (3, 'Cid', 'Kim')`,
+	)
+
+	// index of existing rows
+	execAll(t, tdb,
+		`CREATE UNIQUE INDEX users_email ON users (email)`,
+		`CREATE INDEX users_name ON users (last_name, first_name);`,
+	)
+	for _, name := range []string{"index-users_email", "index-users_name"} {
+		if _, err := os.Stat(path.Join(folder, "users", name)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// unique index
+	tests := map[string]error{
+		"INSERT INTO users (id, email) VALUES (4, 'ann@test.com')": furydb.ErrDuplicateKey,
+		"UPDATE users SET email = 'bob@test.com' WHERE id = 1":     furydb.ErrDuplicateKey,
+		"UPDATE users SET email = 'ann@test.com' WHERE id = 1":     nil,
+		"INSERT INTO users (id, first_name) VALUES (5, 'Dee')":     nil,
+		"INSERT INTO users (id, email) VALUES (6, 'dan@test.com')": nil,
+		"CREATE INDEX users_email ON users (first_name)":           furydb.ErrIndexExist,
+		"CREATE INDEX users_x ON users (nope)":                     furydb.ErrColumnNotExist,
+		"CREATE INDEX users_x ON nope (email)":                     furydb.ErrTableNotExist,
+		"CREATE UNIQUE INDEX users_last ON users (last_name)":      furydb.ErrDuplicateKey,
+		"DROP INDEX nope": furydb.ErrIndexNotExist,
+		"INSERT INTO users (id, email, last_name) VALUES (7, 'ed', 'Lee')": nil,
+	}
+	for query, want := range tests {
+		_, err := tdb.Exec(query)
+		if !errors.Is(err, want) || (want == nil && err != nil) {
+			t.Error(fmt.Errorf("%s: expected %v, got %v", query, want, err))
+		}
+	}
+
+	lookups := map[string][]string{
+		"email = 'ann@test.com'":                     {"1"},
+		"email = 'dan@test.com' OR id = 2":           {"2", "6"},
+		"email > 'b' AND email < 'e'":                {"2", "6"},
+		"last_name = 'Lee'":                          {"1", "2", "7"},
+		"last_name = 'Lee' AND first_name = 'Bob'":   {"2"},
+		"last_name >= 'Kim' AND first_name <> 'Bob'": {"1", "3"},
+	}
+	for cond, want := range lookups {
+		ids, err := queryStrings(tdb, "SELECT (id) FROM users WHERE "+cond)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !sameStrings(ids, want) {
+			t.Error(fmt.Errorf("WHERE %s: invalid ids %v", cond, ids))
+		}
+	}
+
+	// index kept after reopen
+	err := tdb.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tdb, err = sql.Open("fury", folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tdb.Close()
+	if _, err = tdb.Exec("INSERT INTO users (id, email) VALUES (8, 'bob@test.com')"); !errors.Is(err, furydb.ErrDuplicateKey) {
+		t.Error(fmt.Errorf("expected duplicate key after reopen, got %v", err))
+	}
+
+	// dropped index no longer checked
+	execAll(t, tdb, "DROP INDEX users_email")
+	if _, err = os.Stat(path.Join(folder, "users", "index-users_email")); !os.IsNotExist(err) {
+		t.Error(fmt.Errorf("index file not removed"))
+	}
+	execAll(t, tdb, "INSERT INTO users (id, email) VALUES (8, 'bob@test.com')")
+	ids, err := queryStrings(tdb, "SELECT (id) FROM users WHERE email = 'bob@test.com'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameStrings(ids, []string{"2", "8"}) {
+		t.Error(fmt.Errorf("invalid ids %v", ids))
+	}
+
+	// index dropped and created again in one transaction
+	tx, err := tdb.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, query := range []string{
+		"CREATE INDEX users_email ON users (email)",
+		"DROP INDEX users_email",
+		"CREATE INDEX users_email ON users (email)",
+	} {
+		if _, err = tx.Exec(query); err != nil {
+			t.Fatal(fmt.Errorf("%s: %v", query, err))
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	ids, err = queryStrings(tdb, "SELECT (id) FROM users WHERE email = 'bob@test.com'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameStrings(ids, []string{"2", "8"}) {
+		t.Error(fmt.Errorf("invalid ids after recreate %v", ids))
+	}
+}
+
+// TestLargeIndexKeys nodes of large keys are split so both halves fit in page
+func TestLargeIndexKeys(t *testing.T) {
+	tdb := openTestDB(t, "tmp-index-large")
+	defer tdb.Close()
+
+	execAll(t, tdb, `CREATE TABLE t (s STRING PRIMARY KEY)`)
+	pad := strings.Repeat("x", 1008)
+	for i := 1; i <= 7; i++ {
+		execAll(t, tdb, fmt.Sprintf("INSERT INTO t (s) VALUES ('b%d%s')", i, pad))
+	}
+	for i := 1; i <= 8; i++ {
+		execAll(t, tdb, fmt.Sprintf("INSERT INTO t (s) VALUES ('z%d')", i))
+	}
+	execAll(t, tdb, fmt.Sprintf("INSERT INTO t (s) VALUES ('a0%s')", pad))
+
+	rows, err := queryRows(tdb, "SELECT COUNT(*) FROM t WHERE s > 'a'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(rows, " ") != "16" {
+		t.Error(fmt.Errorf("expected 16 rows, got %v", rows))
+	}
+}
+
+// TestEmptyIndexRead reading index of empty table does not make index file
+func TestEmptyIndexRead(t *testing.T) {
+	tdb := openTestDB(t, "tmp-index-empty")
+	defer tdb.Close()
+
+	execAll(t, tdb, `CREATE TABLE t (k INT PRIMARY KEY, v INT)`)
+	ks, err := queryStrings(tdb, "SELECT (k) FROM t WHERE k = 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ks) != 0 {
+		t.Error(fmt.Errorf("expected no rows, got %v", ks))
+	}
+	if _, err = os.Stat("tmp-index-empty/t/pk"); !os.IsNotExist(err) {
+		t.Error(fmt.Errorf("expected no index file, got %v", err))
+	}
+
+	execAll(t, tdb, "INSERT INTO t (k, v) VALUES (1, 2)")
+	ks, err = queryStrings(tdb, "SELECT (k) FROM t WHERE k = 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameStrings(ks, []string{"1"}) {
+		t.Error(fmt.Errorf("invalid keys %v", ks))
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/comomac/furydb"
+)
+
+// TestJoin inner, outer and cross joins with table aliases
+func TestJoin(t *testing.T) {
+	tdb := openTestDB(t, "tmp-join")
+	defer tdb.Close()
+
+	execAll(t, tdb,
+		`CREATE TABLE teams (id INT PRIMARY KEY, name STRING NOT NULL)`,
+		`CREATE TABLE users (id INT PRIMARY KEY, name STRING NOT NULL, team INT)`,
+		`CREATE TABLE orders (id INT PRIMARY KEY, user_id INT, amount INT)`,
+		`CREATE INDEX orders_user ON orders (user_id)`,
+		`INSERT INTO teams (id, name) VALUES (1, 'red')`,
+		`INSERT INTO teams (id, name) VALUES (2, 'blue')`,
+		`INSERT INTO users (id, name, team) VALUES (1, 'ann', 1)`,
+		`INSERT INTO users (id, name, team) VALUES (2, 'bob', 1)`,
+		`INSERT INTO users (id, name) VALUES (3, 'cy')`,
+		`INSERT INTO users (id, name, team) VALUES (4, 'dee', 9)`,
+		`INSERT INTO orders (id, user_id, amount) VALUES (10, 1, 5)`,
+		`INSERT INTO orders (id, user_id, amount) VALUES (11, 1, 7)`,
+		`INSERT INTO orders (id, user_id, amount) VALUES (12, 2, 3)`,
+		`INSERT INTO orders (id, amount) VALUES (13, 1)`,
+	)
+
+	tests := map[string]string{
+		"SELECT u.name, t.name FROM users u JOIN teams t ON t.id = u.team ORDER BY u.id":                "ann|red bob|red",
+		"SELECT u.name, t.name FROM users AS u INNER JOIN teams AS t ON u.team = t.id ORDER BY u.id":    "ann|red bob|red",
+		"SELECT u.name, t.name FROM users u LEFT JOIN teams t ON t.id = u.team ORDER BY u.id":           "ann|red bob|red cy|NULL dee|NULL",
+		"SELECT u.name, t.name FROM users u LEFT OUTER JOIN teams t ON t.id = u.team ORDER BY u.id":     "ann|red bob|red cy|NULL dee|NULL",
+		"SELECT u.name, t.name FROM users u RIGHT JOIN teams t ON t.id = u.team ORDER BY t.id, u.id":    "ann|red bob|red NULL|blue",
+		"SELECT t.name FROM users u RIGHT OUTER JOIN teams t ON t.id = u.team WHERE t.id = 2":           "blue",
+		"SELECT COUNT(*) FROM users CROSS JOIN teams":                                                   "8",
+		"SELECT COUNT(*) FROM users, teams":                                                             "8",
+		"SELECT users.name, teams.name FROM users, teams WHERE teams.id = 2 AND users.id < 3":           "ann|blue bob|blue",
+		"SELECT users.name FROM users JOIN teams ON teams.id = users.team ORDER BY users.id":            "ann bob",
+		"SELECT u.name, o.amount FROM users u JOIN orders o ON o.user_id = u.id ORDER BY o.amount":      "bob|3 ann|5 ann|7",
+		"SELECT o.id FROM users u JOIN orders o ON u.id = o.user_id WHERE u.name = 'ann' ORDER BY o.id": "10 11",
+		"SELECT u.name, o.id FROM users u LEFT JOIN orders o ON o.user_id = u.id WHERE o.amount > 4":    "ann|10 ann|11",
+		"SELECT u.name, o.id FROM users u LEFT JOIN orders o ON o.user_id = u.id AND o.amount > 5 ORDER BY u.id": "ann|11 " +
+			"bob|NULL cy|NULL dee|NULL",
+		"SELECT u.name, o.id FROM users u JOIN orders o ON o.amount < u.id ORDER BY o.id, u.id": "dee|12 bob|13 cy|13 dee|13",
+		"SELECT a.name, b.name FROM users a JOIN users b ON a.team = b.team AND a.id < b.id":    "ann|bob",
+		"SELECT t.name, o.amount FROM teams t JOIN users u ON u.team = t.id JOIN orders o ON o.user_id = u.id " +
+			"ORDER BY o.amount DESC": "red|7 red|5 red|3",
+		"SELECT u.name, COUNT(o.id), SUM(o.amount) FROM users u LEFT JOIN orders o ON o.user_id = u.id " +
+			"GROUP BY u.name ORDER BY u.name": "ann|2|12 bob|1|3 cy|0|NULL dee|0|NULL",
+		"SELECT u.name, o.id FROM users u JOIN orders o ON o.user_id = u.id ORDER BY o.id LIMIT 2 OFFSET 1": "ann|11 bob|12",
+		"SELECT o.id FROM orders o JOIN users u ON u.id = o.user_id LIMIT 1":                                "10",
+		"SELECT DISTINCT t.name FROM teams t JOIN users u ON u.team = t.id":                                 "red",
+		"SELECT amount FROM users u JOIN orders o ON o.user_id = u.id WHERE name = 'bob'":                   "3",
+		"SELECT * FROM teams t JOIN users u ON u.team = t.id WHERE u.id = 1":                                "1|red|1|ann|1",
+		"SELECT u.name FROM users u WHERE u.id = 3":                                                         "cy",
+	}
+	for query, want := range tests {
+		rows, err := queryRows(tdb, query)
+		if err != nil {
+			t.Error(fmt.Errorf("%s: %v", query, err))
+			continue
+		}
+		if strings.Join(rows, " ") != want {
+			t.Error(fmt.Errorf("%s: expected %s, got %v", query, want, rows))
+		}
+	}
+
+	// outer joined table can be null
+	res, err := tdb.Query("SELECT u.name, t.name FROM users u LEFT JOIN teams t ON t.id = u.team")
+	if err != nil {
+		t.Fatal(err)
+	}
+	types, err := res.ColumnTypes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []bool{false, true} {
+		if nullable, ok := types[i].Nullable(); !ok || nullable != want {
+			t.Error(fmt.Errorf("column %d: expected nullable %v, got %v %v", i, want, nullable, ok))
+		}
+	}
+	if err = res.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	errs := map[string]error{
+		"SELECT name FROM users u JOIN teams t ON t.id = u.team":                                      furydb.ErrColumnAmbiguous,
+		"SELECT u.name FROM users u JOIN teams t ON id = u.team":                                      furydb.ErrColumnAmbiguous,
+		"SELECT u.name FROM users u JOIN users u ON u.id = u.id":                                      furydb.ErrTableNameNotUnique,
+		"SELECT users.name FROM users u":                                                              furydb.ErrColumnNotExist,
+		"SELECT u.id FROM users u JOIN teams t ON t.id = o.user_id JOIN orders o ON o.user_id = u.id": furydb.ErrColumnNotExist,
+		"SELECT * FROM users JOIN nope ON nope.id = users.id":                                         furydb.ErrTableNotExist,
+	}
+	for query, want := range errs {
+		if _, err = queryRows(tdb, query); err != want {
+			t.Error(fmt.Errorf("%s: expected %v, got %v", query, want, err))
+		}
+	}
+
+	bad := []string{
+		"SELECT * FROM users JOIN teams",
+		"SELECT * FROM users JOIN",
+		"SELECT * FROM users LEFT teams ON teams.id = users.team",
+		"SELECT * FROM users CROSS JOIN teams ON teams.id = users.team",
+		"SELECT * FROM users INNER OUTER JOIN teams ON teams.id = users.team",
+		"SELECT * FROM users AS",
+	}
+	for _, query := range bad {
+		if _, err = queryRows(tdb, query); err == nil {
+			t.Error(fmt.Errorf("%s: expected error", query))
+		}
+	}
+}
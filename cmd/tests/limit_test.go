@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/comomac/furydb"
+)
+
+// TestLimit LIMIT, OFFSET and TOP give part of the rows
+func TestLimit(t *testing.T) {
+	tdb := openTestDB(t, "tmp-limit")
+	defer tdb.Close()
+
+	execAll(t, tdb, `CREATE TABLE items (id INT PRIMARY KEY, name STRING, qty INT)`)
+	for i, name := range []string{"a", "b", "c", "d", "e", "f", "g"} {
+		_, err := tdb.Exec("INSERT INTO items (id, name, qty) VALUES (?, ?, ?)", i+1, name, (i*3)%7)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := map[string]string{
+		"SELECT (name) FROM items ORDER BY id LIMIT 3":                     "a b c",
+		"SELECT (name) FROM items ORDER BY id LIMIT 3 OFFSET 2":            "c d e",
+		"SELECT (name) FROM items ORDER BY id OFFSET 5":                    "f g",
+		"SELECT (name) FROM items ORDER BY id LIMIT 10 OFFSET 6":           "g",
+		"SELECT (name) FROM items ORDER BY id LIMIT 2 OFFSET 7":            "",
+		"SELECT (name) FROM items ORDER BY id DESC LIMIT 2":                "g f",
+		"SELECT (name) FROM items ORDER BY qty LIMIT 3":                    "a f d",
+		"SELECT (name) FROM items ORDER BY qty DESC LIMIT 2 OFFSET 1;":     "e g",
+		"SELECT (name) FROM items WHERE id > 2 ORDER BY id LIMIT 2":        "c d",
+		"SELECT (name) FROM items WHERE qty > 2 ORDER BY name LIMIT 2":     "b c",
+		"SELECT TOP 2 (name) FROM items ORDER BY id":                       "a b",
+		"SELECT TOP 2 (name) FROM items ORDER BY id OFFSET 1":              "b c",
+		"SELECT TOP 0 (name) FROM items":                                   "",
+		"SELECT (name) FROM items LIMIT 0":                                 "",
+		"SELECT (name) FROM items WHERE name = 'nope' ORDER BY id LIMIT 1": "",
+	}
+	for query, want := range tests {
+		names, err := queryStrings(tdb, query)
+		if err != nil {
+			t.Error(fmt.Errorf("%s: %v", query, err))
+			continue
+		}
+		if strings.Join(names, " ") != want {
+			t.Error(fmt.Errorf("%s: expected %s, got %v", query, want, names))
+		}
+	}
+
+	// without order, count is kept
+	for query, want := range map[string]int{
+		"SELECT (name) FROM items LIMIT 4":                        4,
+		"SELECT * FROM items LIMIT 4 OFFSET 5":                    2,
+		"SELECT TOP 1 * FROM items WHERE qty = 3":                 1,
+		"SELECT (name) FROM items WHERE id >= 3 LIMIT 100":        5,
+		"SELECT (name) FROM items WHERE id >= 3 LIMIT 2 OFFSET 1": 2,
+	} {
+		rows, err := tdb.Query(query)
+		if err != nil {
+			t.Fatal(fmt.Errorf("%s: %v", query, err))
+		}
+		count := 0
+		for rows.Next() {
+			count++
+		}
+		if err = rows.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if count != want {
+			t.Error(fmt.Errorf("%s: expected %d rows, got %d", query, want, count))
+		}
+	}
+
+	// placeholders, null is no limit
+	names, err := queryStrings(tdb, "SELECT (name) FROM items ORDER BY id LIMIT ? OFFSET ?", 2, 3)
+	if err != nil || strings.Join(names, " ") != "d e" {
+		t.Error(fmt.Errorf("expected d e, got %v %v", names, err))
+	}
+	names, err = queryStrings(tdb, "SELECT TOP $1 (name) FROM items ORDER BY qty DESC", 1)
+	if err != nil || strings.Join(names, " ") != "c" {
+		t.Error(fmt.Errorf("expected c, got %v %v", names, err))
+	}
+	names, err = queryStrings(tdb, "SELECT (name) FROM items ORDER BY id LIMIT ? OFFSET ?", nil, 4)
+	if err != nil || strings.Join(names, " ") != "e f g" {
+		t.Error(fmt.Errorf("expected e f g, got %v %v", names, err))
+	}
+	for _, args := range [][]interface{}{{-1, 0}, {1, -1}, {"1", 0}, {1.5, 0}} {
+		_, err = queryStrings(tdb, "SELECT (name) FROM items LIMIT ? OFFSET ?", args...)
+		if err != furydb.ErrInvalidLimit {
+			t.Error(fmt.Errorf("%v: expected %v, got %v", args, furydb.ErrInvalidLimit, err))
+		}
+	}
+
+	bad := []string{
+		"SELECT (name) FROM items LIMIT",
+		"SELECT (name) FROM items LIMIT -1",
+		"SELECT (name) FROM items LIMIT 1.5",
+		"SELECT (name) FROM items LIMIT 'a'",
+		"SELECT (name) FROM items OFFSET 1 LIMIT 1",
+		"SELECT (name) FROM items LIMIT 1 ORDER BY id",
+		"SELECT TOP 1 (name) FROM items LIMIT 1",
+		"SELECT TOP (name) FROM items",
+	}
+	for _, query := range bad {
+		if _, err := queryStrings(tdb, query); err == nil {
+			t.Error(fmt.Errorf("%s: expected error", query))
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/comomac/furydb"
+)
+
+// TestNull nulls are stored and returned as nil, and not null columns reject them
+func TestNull(t *testing.T) {
+	folder := "tmp-null"
+	tdb := openTestDB(t, folder)
+
+	execAll(t, tdb,
+		`CREATE TABLE vals (id INT PRIMARY KEY, name STRING NOT NULL,
+			b BOOL, i INT, f FLOAT, s STRING, tm TIME, bs BYTES, u UUID)`,
+		`INSERT INTO vals (id, name, b, i, f, s, tm, bs, u) VALUES (1, 'literal', NULL, NULL, NULL, NULL, NULL, NULL, NULL)`,
+		`INSERT INTO vals (id, name) VALUES (2, 'omitted')`,
+		`INSERT INTO vals (id, name, b, i, f, s, tm, bs, u)
+			VALUES (4, 'values', true, 5, 1.5, 'x', '2020-01-02', '\x0102', '0583e443-015a-0b3e-0f19-6bce4dfdd638')`,
+	)
+	uid, err := furydb.UUIDStrToBin("0583e443-015a-0b3e-0f19-6bce4dfdd638")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tdb.Exec("INSERT INTO vals (id, name, b, i, f, s, tm, bs, u) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		3, "params", nil, sql.NullInt64{}, nil, sql.NullString{}, sql.NullTime{}, furydb.NullBytes{}, furydb.NullUUID{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tdb.Exec("INSERT INTO vals (id, name, bs, u) VALUES (?, ?, ?, ?)",
+		5, "valid params", furydb.NullBytes{Bytes: []byte{1, 2}, Valid: true}, furydb.NullUUID{UUID: uid, Valid: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// nulls kept after reopen
+	if err = tdb.Close(); err != nil {
+		t.Fatal(err)
+	}
+	tdb, err = sql.Open("fury", folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tdb.Close()
+
+	rows, err := tdb.Query("SELECT (id, b, i, f, s, tm, bs, u) FROM vals")
+	if err != nil {
+		t.Fatal(err)
+	}
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, typ := range types {
+		nullable, ok := typ.Nullable()
+		if !ok || nullable != (i > 0) {
+			t.Error(fmt.Errorf("%s: invalid nullable %v %v", typ.Name(), nullable, ok))
+		}
+	}
+	count := 0
+	for rows.Next() {
+		var (
+			id int
+			b  sql.NullBool
+			i  sql.NullInt64
+			f  sql.NullFloat64
+			s  sql.NullString
+			tm sql.NullTime
+			by furydb.NullBytes
+			u  furydb.NullUUID
+		)
+		err = rows.Scan(&id, &b, &i, &f, &s, &tm, &by, &u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		count++
+
+		switch id {
+		case 4:
+			if !b.Valid || !b.Bool || i.Int64 != 5 || f.Float64 != 1.5 || s.String != "x" || !tm.Valid {
+				t.Error(fmt.Errorf("%d: invalid values %v %v %v %v %v", id, b, i, f, s, tm))
+			}
+			fallthrough
+		case 5:
+			if !by.Valid || string(by.Bytes) != "\x01\x02" || !u.Valid || u.UUID != uid {
+				t.Error(fmt.Errorf("%d: invalid values %v %v", id, by, u))
+			}
+		default:
+			if b.Valid || i.Valid || f.Valid || s.Valid || tm.Valid || by.Valid || u.Valid {
+				t.Error(fmt.Errorf("%d: expected all null, got %v %v %v %v %v %v %v", id, b, i, f, s, tm, by, u))
+			}
+		}
+	}
+	if err = rows.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if count != 5 {
+		t.Error(fmt.Errorf("expected 5 rows, got %d", count))
+	}
+
+	// nil can be scanned to interface
+	var v interface{}
+	if err = tdb.QueryRow("SELECT (s) FROM vals WHERE id = 1").Scan(&v); err != nil || v != nil {
+		t.Error(fmt.Errorf("expected nil, got %v %v", v, err))
+	}
+
+	// not null
+	tests := map[string]string{
+		"INSERT INTO vals (id) VALUES (6)":                     "cstr-name",
+		"INSERT INTO vals (id, name) VALUES (6, NULL)":         "cstr-name",
+		"INSERT INTO vals (name) VALUES ('no id')":             "cstr-pk",
+		"UPDATE vals SET name = NULL WHERE id = 1":             "cstr-name",
+		"UPDATE vals SET id = NULL WHERE id = 1":               "cstr-pk",
+		"INSERT INTO vals (id, name, s) VALUES (6, 'a', NULL)": "",
+		"UPDATE vals SET s = NULL WHERE id = 4":                "",
+	}
+	for query, cstr := range tests {
+		_, err = tdb.Exec(query)
+		if cstr == "" {
+			if err != nil {
+				t.Error(fmt.Errorf("%s: %v", query, err))
+			}
+			continue
+		}
+		var cerr *furydb.ConstraintError
+		if !errors.As(err, &cerr) || cerr.Name != cstr || !errors.Is(err, furydb.ErrColumnNotNullable) {
+			t.Error(fmt.Errorf("%s: expected not null violation of %s, got %v", query, cstr, err))
+		}
+	}
+
+	var s sql.NullString
+	if err = tdb.QueryRow("SELECT (s) FROM vals WHERE id = 4").Scan(&s); err != nil || s.Valid {
+		t.Error(fmt.Errorf("expected null, got %v %v", s, err))
+	}
+	if err = tdb.QueryRow("SELECT (tm) FROM vals WHERE id = 4").Scan(&v); err != nil || !v.(time.Time).Equal(time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Error(fmt.Errorf("invalid time %v %v", v, err))
+	}
+}
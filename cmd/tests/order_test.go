@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/comomac/furydb"
+)
+
+// TestOrderBy rows are given in order of ORDER BY
+func TestOrderBy(t *testing.T) {
+	tdb := openTestDB(t, "tmp-order")
+	defer tdb.Close()
+
+	execAll(t, tdb,
+		`CREATE TABLE items (id INT PRIMARY KEY, name STRING NOT NULL, active BOOL, qty INT, price FLOAT,
+			tag STRING, seen TIME, dat BYTES, uid UUID)`,
+		`CREATE INDEX items_qty ON items (qty)`,
+		`INSERT INTO items (id, name, active, qty, price, tag, seen, dat, uid)
+			VALUES (3, 'c', true, 5, 2.5, 'x', '2020-01-03', '\x02', '00000000-0000-0000-0000-000000000003')`,
+		`INSERT INTO items (id, name, active, qty, price, tag, seen, dat, uid)
+			VALUES (1, 'a', false, -5, -1.5, 'y', '2019-12-31', '\x0100', '00000000-0000-0000-0000-000000000002')`,
+		`INSERT INTO items (id, name) VALUES (4, 'd')`,
+		`INSERT INTO items (id, name, active, qty, price, tag, seen, dat, uid)
+			VALUES (2, 'b', true, 5, 0, 'x', '2020-01-01', '\x01', '00000000-0000-0000-0000-000000000001')`,
+		`INSERT INTO items (id, name, active, qty, price, tag, seen, dat, uid)
+			VALUES (5, 'e', false, 100, -0.5, '', '2020-01-02 10:00:00', '', '00000000-0000-0000-0000-000000000010')`,
+	)
+
+	tests := map[string]string{
+		"id":                        "a b c d e",
+		"id DESC":                   "e d c b a",
+		"active":                    "d a e c b",
+		"active DESC, id DESC":      "c b e a d",
+		"qty":                       "d a c b e",
+		"qty ASC":                   "d a c b e",
+		"qty NULLS LAST":            "a c b e d",
+		"qty DESC":                  "e c b a d",
+		"qty DESC NULLS FIRST":      "d e c b a",
+		"qty, price":                "d a b c e",
+		"qty DESC, price DESC":      "e c b a d",
+		"qty, name DESC":            "d a c b e",
+		"price":                     "d a e b c",
+		"price DESC":                "c b e a d",
+		"tag, id":                   "d e b c a",
+		"tag DESC, id DESC":         "a c b e d",
+		"seen":                      "d a b e c",
+		"seen desc":                 "c e b a d",
+		"dat":                       "d e b a c",
+		"dat DESC":                  "c a b e d",
+		"uid":                       "d b a c e",
+		"uid DESC nulls first":      "d e c a b",
+		"name = 'c', id":            "a b d e c",
+		"qty = 5 DESC, id":          "b c a e d",
+		"tag NULLS LAST, qty, name": "e b c a d",
+	}
+	for order, want := range tests {
+		names, err := queryStrings(tdb, "SELECT (name) FROM items ORDER BY "+order)
+		if err != nil {
+			t.Fatal(fmt.Errorf("ORDER BY %s: %v", order, err))
+		}
+		if strings.Join(names, " ") != want {
+			t.Error(fmt.Errorf("ORDER BY %s: expected %s, got %v", order, want, names))
+		}
+	}
+
+	// with where, either by index or by scan
+	wheres := map[string]string{
+		"SELECT (name) FROM items WHERE id >= 2 ORDER BY id DESC;":        "e d c b",
+		"SELECT (name) FROM items WHERE id >= 2 ORDER BY id":              "b c d e",
+		"SELECT (name) FROM items WHERE qty > 0 ORDER BY qty, id DESC":    "c b e",
+		"SELECT (name) FROM items WHERE qty > 0 ORDER BY qty":             "c b e",
+		"SELECT (name) FROM items WHERE id < 3 OR qty = 100 ORDER BY qty": "a b e",
+		"SELECT (id) FROM items WHERE tag = 'x' ORDER BY price":           "2 3",
+	}
+	for query, want := range wheres {
+		names, err := queryStrings(tdb, query)
+		if err != nil {
+			t.Fatal(fmt.Errorf("%s: %v", query, err))
+		}
+		if strings.Join(names, " ") != want {
+			t.Error(fmt.Errorf("%s: expected %s, got %v", query, want, names))
+		}
+	}
+
+	bad := []string{
+		"SELECT (name) FROM items ORDER id",
+		"SELECT (name) FROM items ORDER BY nope",
+		"SELECT (name) FROM items ORDER BY id NULLS",
+		"SELECT (name) FROM items ORDER BY id NULLS MIDDLE",
+	}
+	for _, query := range bad {
+		if _, err := queryStrings(tdb, query); err == nil {
+			t.Error(fmt.Errorf("%s: expected error", query))
+		}
+	}
+}
+
+// TestOrderBySpill rows that do not fit in sort memory are sorted with temp files
+func TestOrderBySpill(t *testing.T) {
+	tdb := openTestDB(t, "tmp-order2")
+	defer tdb.Close()
+
+	oldMemory := furydb.SortMemory
+	furydb.SortMemory = 4096
+	defer func() {
+		furydb.SortMemory = oldMemory
+	}()
+
+	execAll(t, tdb, `CREATE TABLE nums (id INT PRIMARY KEY, v INT, name STRING)`)
+	tx, err := tdb.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 2000
+	for i := 0; i < n; i++ {
+		// v has duplicates, so order of same v is checked too
+		_, err = tx.Exec("INSERT INTO nums (id, v, name) VALUES (?, ?, ?)", i, (i*7919)%97, fmt.Sprintf("name %04d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	runs := func() int {
+		files, err := filepath.Glob(filepath.Join(os.TempDir(), "furydb-sort-*"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(files)
+	}
+	before := runs()
+
+	rows, err := tdb.Query("SELECT (id, v) FROM nums ORDER BY v DESC, name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runs() <= before {
+		t.Error(fmt.Errorf("expected sort runs in temp dir"))
+	}
+	count := 0
+	lastV, lastID := 1<<30, -1
+	for rows.Next() {
+		var id, v int
+		if err = rows.Scan(&id, &v); err != nil {
+			t.Fatal(err)
+		}
+		if v > lastV || (v == lastV && id <= lastID) {
+			t.Fatal(fmt.Errorf("row %d %d is after %d %d", id, v, lastID, lastV))
+		}
+		lastV, lastID = v, id
+		count++
+	}
+	if err = rows.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if count != n {
+		t.Error(fmt.Errorf("expected %d rows, got %d", n, count))
+	}
+	if runs() != before {
+		t.Error(fmt.Errorf("sort runs not removed"))
+	}
+
+	// closed before all rows are read
+	rows, err = tdb.Query("SELECT (id) FROM nums ORDER BY name DESC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var id int
+	if !rows.Next() {
+		t.Fatal(rows.Err())
+	}
+	if err = rows.Scan(&id); err != nil || id != n-1 {
+		t.Error(fmt.Errorf("expected %d, got %d %v", n-1, id, err))
+	}
+	if err = rows.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if runs() != before {
+		t.Error(fmt.Errorf("sort runs not removed"))
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/comomac/furydb"
+)
+
+// TestPredicates LIKE, ILIKE, IN list, BETWEEN and IS NULL
+func TestPredicates(t *testing.T) {
+	tdb := openTestDB(t, "tmp-predicate")
+	defer tdb.Close()
+
+	execAll(t, tdb,
+		`CREATE TABLE files (id INT PRIMARY KEY, name STRING, size INT, note STRING)`,
+		`INSERT INTO files (id, name, size, note) VALUES (1, 'readme.md', 120, '100% done')`,
+		`INSERT INTO files (id, name, size, note) VALUES (2, 'main.go', 3000, 'a_b')`,
+		`INSERT INTO files (id, name, size) VALUES (3, 'Main_test.go', 45)`,
+		`INSERT INTO files (id, name, size, note) VALUES (4, 'LICENSE', NULL, 'MIT')`,
+		`INSERT INTO files (id, name, size, note) VALUES (5, 'ünï.txt', 7, '')`,
+	)
+
+	tests := map[string]string{
+		"name LIKE 'main%'":                 "2",
+		"name LIKE '%.go'":                  "2 3",
+		"name LIKE '%a%n%'":                 "2 3",
+		"name LIKE 'ma_n.go'":               "2",
+		"name LIKE '____.go'":               "2",
+		"name LIKE 'readme.md'":             "1",
+		"name LIKE '%'":                     "1 2 3 4 5",
+		"name LIKE ''":                      "",
+		"name NOT LIKE '%.go'":              "1 4 5",
+		"name ILIKE 'MAIN%'":                "2 3",
+		"name ILIKE 'ÜNÏ%'":                 "5",
+		"name NOT ILIKE '%E%'":              "2 5",
+		"note LIKE '%!%%' ESCAPE '!'":       "1",
+		"note LIKE '%\\_%' ESCAPE '\\'":     "2",
+		"note LIKE '%_%'":                   "1 2 4",
+		"note LIKE 'a_b' ESCAPE ''":         "2",
+		"size LIKE '1%'":                    "1",
+		"name LIKE 'm' || '%'":              "2",
+		"id IN (1, 3, 5)":                   "1 3 5",
+		"id NOT IN (1, 3, 5)":               "2 4",
+		"name IN ('LICENSE', 'main.go')":    "2 4",
+		"size IN (size, 1)":                 "1 2 3 5",
+		"id IN (1, NULL)":                   "1",
+		"id NOT IN (1, NULL)":               "",
+		"size + 1 IN (46, 8)":               "3 5",
+		"size BETWEEN 45 AND 120":           "1 3",
+		"size NOT BETWEEN 45 AND 120":       "2 5",
+		"size BETWEEN 10 AND 1":             "",
+		"name BETWEEN 'a' AND 'n'":          "2",
+		"id BETWEEN 2 AND 4 AND size > 100": "2",
+		"size IS NULL":                      "4",
+		"size IS NOT NULL":                  "1 2 3 5",
+		"note IS NULL OR note = ''":         "3 5",
+		"NOT note IS NULL":                  "1 2 4 5",
+		"size * 2 IS NULL":                  "4",
+	}
+	for cond, want := range tests {
+		ids, err := queryStrings(tdb, "SELECT id FROM files WHERE "+cond+" ORDER BY id")
+		if err != nil {
+			t.Error(fmt.Errorf("%s: %v", cond, err))
+			continue
+		}
+		if strings.Join(ids, " ") != want {
+			t.Error(fmt.Errorf("%s: expected %s, got %v", cond, want, ids))
+		}
+	}
+
+	// predicates as values and with placeholders
+	rows, err := queryRows(tdb, "SELECT name LIKE 'r%', size IN (1, 2), size BETWEEN 1 AND 200, note IS NULL FROM files WHERE id = 1")
+	if err != nil || strings.Join(rows, " ") != "true|false|true|false" {
+		t.Error(fmt.Errorf("expected predicate values, got %v %v", rows, err))
+	}
+	rows, err = queryRows(tdb, "SELECT name LIKE NULL, size IN (1, 2), size BETWEEN 1 AND 200 FROM files WHERE id = 4")
+	if err != nil || strings.Join(rows, " ") != "NULL|NULL|NULL" {
+		t.Error(fmt.Errorf("expected null values, got %v %v", rows, err))
+	}
+	ids, err := queryStrings(tdb, "SELECT id FROM files WHERE name LIKE ? AND size BETWEEN ? AND ? AND id IN (?, ?)", "%.go", 0, 100, 2, 3)
+	if err != nil || strings.Join(ids, " ") != "3" {
+		t.Error(fmt.Errorf("expected 3, got %v %v", ids, err))
+	}
+	execAll(t, tdb, `UPDATE files SET note = 'go' WHERE name LIKE '%.go' AND note IS NULL`)
+	ids, err = queryStrings(tdb, "SELECT id FROM files WHERE note = 'go'")
+	if err != nil || strings.Join(ids, " ") != "3" {
+		t.Error(fmt.Errorf("expected 3, got %v %v", ids, err))
+	}
+
+	errs := map[string]error{
+		"name LIKE 'a' ESCAPE 'ab'": furydb.ErrInvalidEscape,
+		"name LIKE 'a!' ESCAPE '!'": furydb.ErrInvalidPattern,
+		"name LIKE 'a' ESCAPE 1":    furydb.ErrValueTypeNotString,
+		"id IN (1, 'x')":            furydb.ErrValueTypeNotInt,
+		"nope IS NULL":              furydb.ErrColumnNotExist,
+	}
+	for cond, want := range errs {
+		if _, err = queryStrings(tdb, "SELECT id FROM files WHERE "+cond); err != want {
+			t.Error(fmt.Errorf("%s: expected %v, got %v", cond, want, err))
+		}
+	}
+
+	bad := []string{
+		"name NOT = 'a'",
+		"id IN ()",
+		"id IN 1",
+		"size BETWEEN 1",
+		"size BETWEEN 1 OR 2",
+		"size IS 1",
+		"size IS NOT",
+		"name LIKE",
+	}
+	for _, cond := range bad {
+		if _, err = queryStrings(tdb, "SELECT id FROM files WHERE "+cond); err == nil {
+			t.Error(fmt.Errorf("%s: expected error", cond))
+		}
+	}
+}
+
+// TestLikeIndex rows found by LIKE prefix on index match rows found by full scan
+func TestLikeIndex(t *testing.T) {
+	tdb := openTestDB(t, "tmp-predicate2")
+	defer tdb.Close()
+
+	// k is primary key, i has index, v has no index
+	execAll(t, tdb,
+		`CREATE TABLE words (k STRING PRIMARY KEY, i STRING, v STRING)`,
+		`CREATE INDEX words_i ON words (i)`,
+	)
+	tx, err := tdb.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 500; i++ {
+		word := fmt.Sprintf("w%d_%s%%", i, strings.Repeat("ab", i%7))
+		_, err = tx.Exec("INSERT INTO words (k, i, v) VALUES (?, ?, ?)", word, word, word)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	conds := []string{
+		"k LIKE 'w1%'", "k LIKE 'w12_%'", "k LIKE 'w3' || '%'", "k LIKE 'w49_ab%'", "k LIKE 'w5\\_%' ESCAPE '\\'",
+		"k LIKE 'w100!_%!%' ESCAPE '!'", "k LIKE 'x%'", "k LIKE '%ab'", "k LIKE 'w2%' AND k > 'w25'",
+		"k LIKE 'w2%' AND k <= 'w25'", "k LIKE 'w2%' AND k < 'w3'", "k >= 'w1' AND k LIKE 'w19%'",
+		"k BETWEEN 'w1' AND 'w2'", "k NOT LIKE 'w1%'", "k ILIKE 'W1%'", "k LIKE 'w1%' OR k LIKE 'w2%'",
+	}
+	for _, cond := range conds {
+		byScan, err := queryStrings(tdb, "SELECT v FROM words WHERE "+keyCol.ReplaceAllString(cond, "v"))
+		if err != nil {
+			t.Fatal(fmt.Errorf("%s: %v", cond, err))
+		}
+		for _, col := range []string{"k", "i"} {
+			byIndex, err := queryStrings(tdb, "SELECT v FROM words WHERE "+keyCol.ReplaceAllString(cond, col))
+			if err != nil {
+				t.Fatal(fmt.Errorf("%s: %v", cond, err))
+			}
+			if !sameStrings(byIndex, byScan) {
+				t.Error(fmt.Errorf("%s on %s: index gives %d rows, scan gives %d", cond, col, len(byIndex), len(byScan)))
+			}
+		}
+	}
+
+	// index order is kept
+	rows, err := queryStrings(tdb, "SELECT k FROM words WHERE k LIKE 'w10%' ORDER BY k DESC LIMIT 3")
+	if err != nil || strings.Join(rows, " ") != "w10_ababab% w109_abababab% w108_ababab%" {
+		t.Error(fmt.Errorf("expected last w10 keys, got %v %v", rows, err))
+	}
+}
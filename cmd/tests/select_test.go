@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/comomac/furydb"
+)
+
+// TestSelectList select list without parentheses, aliases, qualified columns and DISTINCT
+func TestSelectList(t *testing.T) {
+	tdb := openTestDB(t, "tmp-select")
+	defer tdb.Close()
+
+	execAll(t, tdb,
+		`CREATE TABLE pets (id INT PRIMARY KEY, name STRING NOT NULL, kind STRING, age INT)`,
+		`INSERT INTO pets (id, name, kind, age) VALUES (1, 'rex', 'dog', 3)`,
+		`INSERT INTO pets (id, name, kind, age) VALUES (2, 'tom', 'cat', 3)`,
+		`INSERT INTO pets (id, name, kind, age) VALUES (3, 'fido', 'dog', 5)`,
+		`INSERT INTO pets (id, name, kind, age) VALUES (4, 'kit', 'cat', 3)`,
+		`INSERT INTO pets (id, name) VALUES (5, 'nemo')`,
+	)
+
+	tests := map[string]string{
+		"SELECT name, age FROM pets ORDER BY id LIMIT 2":                                   "rex|3 tom|3",
+		"SELECT (name, age) FROM pets ORDER BY id LIMIT 2":                                 "rex|3 tom|3",
+		"SELECT (name) FROM pets WHERE id = 1":                                             "rex",
+		"SELECT pets.name, pets.age FROM pets WHERE pets.id = 2":                           "tom|3",
+		"SELECT name AS pet, id n FROM pets WHERE id = 3":                                  "fido|3",
+		"SELECT name AS pet FROM pets ORDER BY pet DESC LIMIT 2":                           "tom rex",
+		"SELECT id AS age FROM pets ORDER BY age DESC LIMIT 2":                             "5 4",
+		"SELECT DISTINCT kind FROM pets ORDER BY kind":                                     "NULL cat dog",
+		"SELECT DISTINCT kind, age FROM pets ORDER BY kind, age":                           "NULL|NULL cat|3 dog|3 dog|5",
+		"SELECT DISTINCT age FROM pets WHERE id > 0 ORDER BY age":                          "NULL 3 5",
+		"SELECT DISTINCT age FROM pets ORDER BY age DESC LIMIT 2":                          "5 3",
+		"SELECT DISTINCT age FROM pets ORDER BY age LIMIT 1 OFFSET 1":                      "3",
+		"SELECT DISTINCT kind FROM pets ORDER BY kind DESC":                                "dog cat NULL",
+		"SELECT DISTINCT (kind) FROM pets WHERE id < 3 ORDER BY kind":                      "cat dog",
+		"SELECT DISTINCT COUNT(*) AS n FROM pets GROUP BY kind ORDER BY n":                 "1 2",
+		"SELECT kind, COUNT(*) AS total FROM pets GROUP BY kind ORDER BY total DESC, kind": "cat|2 dog|2 NULL|1",
+		"SELECT TOP 1 DISTINCT age FROM pets ORDER BY age DESC":                            "5",
+		"SELECT id = 1 AS first FROM pets ORDER BY id LIMIT 2":                             "true false",
+	}
+	for query, want := range tests {
+		rows, err := queryRows(tdb, query)
+		if err != nil {
+			t.Error(fmt.Errorf("%s: %v", query, err))
+			continue
+		}
+		if strings.Join(rows, " ") != want {
+			t.Error(fmt.Errorf("%s: expected %s, got %v", query, want, rows))
+		}
+	}
+
+	// DISTINCT without order
+	rows, err := queryRows(tdb, "SELECT DISTINCT kind FROM pets")
+	if err != nil || !sameStrings(rows, []string{"dog", "cat", "NULL"}) {
+		t.Error(fmt.Errorf("expected 3 kinds, got %v %v", rows, err))
+	}
+
+	// columns are named by alias
+	res, err := tdb.Query("SELECT name AS pet, pets.kind, age years, COUNT(*) FROM pets GROUP BY name, pets.kind, age")
+	if err != nil {
+		t.Fatal(err)
+	}
+	columns, err := res.Columns()
+	if err != nil || strings.Join(columns, ",") != "pet,kind,years,count" {
+		t.Error(fmt.Errorf("invalid columns %v %v", columns, err))
+	}
+	types, err := res.ColumnTypes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []bool{false, true, true, false} {
+		if nullable, ok := types[i].Nullable(); !ok || nullable != want {
+			t.Error(fmt.Errorf("%s: expected nullable %v, got %v %v", columns[i], want, nullable, ok))
+		}
+	}
+	if err = res.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// scan by column name, as struct mapping does
+	res, err = tdb.Query("SELECT id AS pet_id, name AS pet_name FROM pets WHERE id = 4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	columns, _ = res.Columns()
+	vals := map[string]interface{}{}
+	for res.Next() {
+		ptrs := make([]interface{}, len(columns))
+		for i := range ptrs {
+			ptrs[i] = new(interface{})
+		}
+		if err = res.Scan(ptrs...); err != nil {
+			t.Fatal(err)
+		}
+		for i, column := range columns {
+			vals[column] = *ptrs[i].(*interface{})
+		}
+	}
+	if err = res.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if vals["pet_id"] != int64(4) || vals["pet_name"] != "kit" {
+		t.Error(fmt.Errorf("invalid values %v", vals))
+	}
+
+	if _, err = queryRows(tdb, "SELECT people.name FROM pets"); err != furydb.ErrColumnNotExist {
+		t.Error(fmt.Errorf("expected %v, got %v", furydb.ErrColumnNotExist, err))
+	}
+	bad := []string{
+		"SELECT name, FROM pets",
+		"SELECT name AS FROM pets",
+		"SELECT name AS 'x' FROM pets",
+		"SELECT pets. FROM pets",
+		"SELECT (name, age) AS x FROM pets",
+		"SELECT DISTINCT FROM pets",
+		"SELECT name age kind FROM pets",
+	}
+	for _, query := range bad {
+		if _, err = queryRows(tdb, query); err == nil {
+			t.Error(fmt.Errorf("%s: expected error", query))
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// TestPreparedStatement bind values to placeholders
+func TestPreparedStatement(t *testing.T) {
+	tdb := openTestDB(t, "tmp-stmt")
+	defer tdb.Close()
+
+	// multiple statements in one query
+	execAll(t, tdb, `
+		CREATE TABLE authors (id UUID PRIMARY KEY, name STRING, age INT);
+		CREATE TABLE books (title STRING, price FLOAT, published TIME, cover BYTES, in_stock BOOL);
+	`)
+
+	stmt, err := tdb.Prepare("INSERT INTO authors (id, name, age) VALUES (?, ?, ?)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stmt.Close()
+
+	authors := []struct {
+		id   string
+		name string
+		age  int
+	}{
+		{"00000000-0000-0000-0000-000000000001", "O'Brien", 30},
+		{"00000000-0000-0000-0000-000000000002", "Smith; DROP", 45},
+		{"00000000-0000-0000-0000-000000000003", "x') --", 60},
+	}
+	for _, a := range authors {
+		if _, err = stmt.Exec(a.id, a.name, a.age); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// numbered placeholders can be reused
+	names, err := queryStrings(tdb, "SELECT (name) FROM authors WHERE age > $1 AND age < $2 OR age = $1", 30, 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameStrings(names, []string{"O'Brien", "Smith; DROP"}) {
+		t.Error(fmt.Errorf("invalid names %v", names))
+	}
+	names, err = queryStrings(tdb, "SELECT (name) FROM authors WHERE id = ?", "00000000-0000-0000-0000-000000000003")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameStrings(names, []string{"x') --"}) {
+		t.Error(fmt.Errorf("invalid names %v", names))
+	}
+
+	// all driver value types
+	published := time.Date(2020, 12, 29, 10, 0, 0, 0, time.UTC)
+	_, err = tdb.Exec("INSERT INTO books (title, price, published, cover, in_stock) VALUES ($1, $2, $3, $4, $5)",
+		"Go", 9.5, published, []byte{1, 2, 3}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	titles, err := queryStrings(tdb, "SELECT (title) FROM books WHERE price = ? AND published = ? AND cover = ? AND in_stock = ?",
+		9.5, published, []byte{1, 2, 3}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameStrings(titles, []string{"Go"}) {
+		t.Error(fmt.Errorf("invalid titles %v", titles))
+	}
+
+	// update and delete
+	res, err := tdb.Exec("UPDATE authors SET age = ? WHERE name = ?", 31, "O'Brien")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := res.RowsAffected(); n != 1 {
+		t.Error(fmt.Errorf("expected 1 row affected, got %d", n))
+	}
+	res, err = tdb.Exec("DELETE FROM authors WHERE age >= ?", 45)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := res.RowsAffected(); n != 2 {
+		t.Error(fmt.Errorf("expected 2 rows affected, got %d", n))
+	}
+	names, err = queryStrings(tdb, "SELECT (name) FROM authors WHERE age = 31")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameStrings(names, []string{"O'Brien"}) {
+		t.Error(fmt.Errorf("invalid names %v", names))
+	}
+
+	// invalid placeholders
+	if _, err = tdb.Exec("DELETE FROM authors WHERE age = ? OR age = $2", 1, 2); err == nil {
+		t.Error(fmt.Errorf("expected mixed placeholder error"))
+	}
+	if _, err = tdb.Exec("DELETE FROM authors WHERE age = ?"); err == nil {
+		t.Error(fmt.Errorf("expected missing argument error"))
+	}
+	if _, err = tdb.Exec("UPDATE authors SET age = ?", "old"); err == nil {
+		t.Error(fmt.Errorf("expected type error"))
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/comomac/furydb"
+)
+
+// TestSubquery IN, EXISTS, scalar and correlated subqueries and derived tables
+func TestSubquery(t *testing.T) {
+	tdb := openTestDB(t, "tmp-subquery")
+	defer tdb.Close()
+
+	execAll(t, tdb,
+		`CREATE TABLE users (id INT PRIMARY KEY, name STRING NOT NULL, team INT)`,
+		`CREATE TABLE orders (id INT PRIMARY KEY, user_id INT, amount INT)`,
+		`CREATE INDEX orders_user ON orders (user_id)`,
+		`INSERT INTO users (id, name) VALUES (1, 'ann')`,
+		`INSERT INTO users (id, name) VALUES (2, 'bob')`,
+		`INSERT INTO users (id, name) VALUES (3, 'cy')`,
+		`INSERT INTO users (id, name) VALUES (4, 'dee')`,
+		`INSERT INTO orders (id, user_id, amount) VALUES (10, 1, 5)`,
+		`INSERT INTO orders (id, user_id, amount) VALUES (11, 1, 7)`,
+		`INSERT INTO orders (id, user_id, amount) VALUES (12, 2, 3)`,
+		`INSERT INTO orders (id, amount) VALUES (13, 1)`,
+	)
+
+	tests := map[string]string{
+		"SELECT name FROM users WHERE id IN (SELECT user_id FROM orders) ORDER BY id":                             "ann bob",
+		"SELECT name FROM users WHERE id NOT IN (SELECT user_id FROM orders)":                                     "",
+		"SELECT name FROM users WHERE id NOT IN (SELECT user_id FROM orders WHERE user_id > 0) ORDER BY id":       "cy dee",
+		"SELECT name FROM users WHERE id IN (SELECT user_id FROM orders WHERE amount > 100)":                      "",
+		"SELECT name FROM users u WHERE NOT EXISTS (SELECT 1 FROM orders o WHERE o.user_id = u.id) ORDER BY u.id": "cy dee",
+		"SELECT name FROM users u WHERE EXISTS (SELECT * FROM orders WHERE user_id = u.id AND amount > 6)":        "ann",
+		"SELECT name, (SELECT SUM(amount) FROM orders WHERE user_id = users.id) AS total FROM users ORDER BY id": "ann|12 " +
+			"bob|3 cy|NULL dee|NULL",
+		"SELECT id FROM orders WHERE amount = (SELECT MAX(amount) FROM orders)":        "11",
+		"SELECT name FROM users WHERE id = (SELECT user_id FROM orders WHERE id = 12)": "bob",
+		"SELECT id, (SELECT amount FROM orders WHERE id = 99) FROM users WHERE id = 1": "1|NULL",
+		"SELECT COUNT(*) FROM (SELECT DISTINCT user_id FROM orders) d":                 "3",
+		"SELECT t.user_id, t.total FROM (SELECT user_id, SUM(amount) AS total FROM orders GROUP BY user_id) AS t " +
+			"WHERE t.total > 2 ORDER BY t.total": "2|3 1|12",
+		"SELECT u.name, t.n FROM users u JOIN (SELECT user_id, COUNT(*) AS n FROM orders GROUP BY user_id) t " +
+			"ON t.user_id = u.id ORDER BY u.id": "ann|2 bob|1",
+		"SELECT name FROM users u WHERE EXISTS (SELECT 1 FROM orders o WHERE o.user_id = u.id " +
+			"AND o.amount = (SELECT MAX(amount) FROM orders WHERE user_id = u.id)) ORDER BY u.id": "ann bob",
+		"SELECT user_id FROM orders GROUP BY user_id HAVING SUM(amount) > (SELECT AVG(amount) FROM orders)": "1",
+		"SELECT name FROM users WHERE (SELECT COUNT(*) FROM orders WHERE user_id = users.id) = 1":           "bob",
+	}
+	for query, want := range tests {
+		rows, err := queryRows(tdb, query)
+		if err != nil {
+			t.Error(fmt.Errorf("%s: %v", query, err))
+			continue
+		}
+		if strings.Join(rows, " ") != want {
+			t.Error(fmt.Errorf("%s: expected %s, got %v", query, want, rows))
+		}
+	}
+
+	// placeholder in subquery
+	rows, err := queryRows(tdb, "SELECT name FROM users WHERE id IN (SELECT user_id FROM orders WHERE amount > ?) AND id < ?", 4, 9)
+	if err != nil || strings.Join(rows, " ") != "ann" {
+		t.Error(fmt.Errorf("expected ann, got %v %v", rows, err))
+	}
+
+	// column is named after subquery column
+	res, err := tdb.Query("SELECT (SELECT MAX(amount) FROM orders) FROM users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	columns, err := res.Columns()
+	if err != nil || strings.Join(columns, ",") != "max" {
+		t.Error(fmt.Errorf("invalid columns %v %v", columns, err))
+	}
+	if err = res.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// subquery in insert, update and delete
+	execAll(t, tdb,
+		`INSERT INTO orders (id, user_id, amount) VALUES (14, (SELECT id FROM users WHERE name = 'dee'), 2)`,
+		`UPDATE users SET team = 1 WHERE id IN (SELECT user_id FROM orders WHERE amount < 5)`,
+		`DELETE FROM orders WHERE NOT EXISTS (SELECT 1 FROM users WHERE users.id = orders.user_id)`,
+	)
+	rows, err = queryRows(tdb, "SELECT id FROM users WHERE team = 1 ORDER BY id")
+	if err != nil || strings.Join(rows, " ") != "2 4" {
+		t.Error(fmt.Errorf("expected 2 4, got %v %v", rows, err))
+	}
+	rows, err = queryRows(tdb, "SELECT id FROM orders ORDER BY id")
+	if err != nil || strings.Join(rows, " ") != "10 11 12 14" {
+		t.Error(fmt.Errorf("expected 10 11 12 14, got %v %v", rows, err))
+	}
+
+	errs := map[string]error{
+		"SELECT name FROM users WHERE id = (SELECT user_id FROM orders)":                              furydb.ErrSubqueryRows,
+		"SELECT name FROM users WHERE id IN (SELECT id, user_id FROM orders)":                         furydb.ErrSubqueryColumns,
+		"SELECT (SELECT * FROM orders) FROM users":                                                    furydb.ErrSubqueryColumns,
+		"SELECT name FROM users WHERE id IN (SELECT nope FROM orders)":                                furydb.ErrColumnNotExist,
+		"SELECT x.id FROM (SELECT id FROM users) t":                                                   furydb.ErrColumnNotExist,
+		"SELECT name FROM users WHERE EXISTS (SELECT 1 FROM nope)":                                    furydb.ErrTableNotExist,
+		"SELECT u.id FROM users u JOIN (SELECT id FROM orders WHERE user_id = u.id) t ON t.id = u.id": furydb.ErrColumnNotExist,
+	}
+	for query, want := range errs {
+		if _, err = queryRows(tdb, query); err != want {
+			t.Error(fmt.Errorf("%s: expected %v, got %v", query, want, err))
+		}
+	}
+
+	bad := []string{
+		"SELECT * FROM (SELECT id FROM users)",
+		"SELECT * FROM users WHERE id IN (SELECT id FROM users",
+		"SELECT * FROM users WHERE EXISTS SELECT 1 FROM users",
+		"SELECT * FROM users WHERE id NOT 1",
+		"SELECT * FROM users WHERE id IN 1",
+		"SELECT * FROM users WHERE id IN (SELECT id FROM users;)",
+	}
+	for _, query := range bad {
+		if _, err = queryRows(tdb, query); err == nil {
+			t.Error(fmt.Errorf("%s: expected error", query))
+		}
+	}
+}
+
+// TestSubqueryIsolation select list subqueries of sorted rows do not see later uncommitted rows
+func TestSubqueryIsolation(t *testing.T) {
+	tdb := openTestDB(t, "tmp-subquery2")
+	defer tdb.Close()
+
+	execAll(t, tdb,
+		`CREATE TABLE u (id INT PRIMARY KEY, name STRING)`,
+		`CREATE TABLE o (id INT PRIMARY KEY, uid INT)`,
+		`INSERT INTO u (id, name) VALUES (1, 'a')`,
+		`INSERT INTO u (id, name) VALUES (2, 'b')`,
+		`INSERT INTO o (id, uid) VALUES (10, 1)`,
+	)
+
+	rows, err := tdb.Query("SELECT name, (SELECT COUNT(*) FROM o WHERE o.uid = u.id) FROM u ORDER BY name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	// other connection changes table before rows are read
+	tx, err := tdb.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	if _, err = tx.Exec("INSERT INTO o (id, uid) VALUES (11, 2)"); err != nil {
+		t.Fatal(err)
+	}
+
+	got := []string{}
+	for rows.Next() {
+		var name string
+		var count int
+		if err = rows.Scan(&name, &count); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, fmt.Sprintf("%s %d", name, count))
+	}
+	if err = rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(got, ", ") != "a 1, b 0" {
+		t.Error(fmt.Errorf("expected counts before insert, got %v", got))
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+// TestTransaction commit and rollback multiple statements
+func TestTransaction(t *testing.T) {
+	tdb := openTestDB(t, "tmp-tx")
+	defer tdb.Close()
+
+	execAll(t, tdb,
+		`CREATE TABLE accounts (name STRING, balance INT)`,
+		`INSERT INTO accounts (name, balance) VALUES ('alice', 100)`,
+		`INSERT INTO accounts (name, balance) VALUES ('bob', 50)`,
+	)
+
+	// commit makes all changes visible
+	tx, err := tdb.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = tx.Exec("UPDATE accounts SET balance = 70 WHERE name = 'alice'"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = tx.Exec("UPDATE accounts SET balance = 80 WHERE name = 'bob'"); err != nil {
+		t.Fatal(err)
+	}
+	// transaction sees its own changes
+	names, err := txQueryStrings(tx, "SELECT (name) FROM accounts WHERE balance > 60")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameStrings(names, []string{"alice", "bob"}) {
+		t.Error(fmt.Errorf("invalid names in transaction %v", names))
+	}
+	// failed statement does not end transaction
+	if _, err = tx.Exec("UPDATE accounts SET balance = 'lots'"); err == nil {
+		t.Error(fmt.Errorf("expected type error"))
+	}
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	names, err = queryStrings(tdb, "SELECT (name) FROM accounts WHERE balance > 60")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameStrings(names, []string{"alice", "bob"}) {
+		t.Error(fmt.Errorf("invalid names after commit %v", names))
+	}
+
+	// rollback throws away all changes, including new table
+	tx, err = tdb.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = tx.Exec("INSERT INTO accounts (name, balance) VALUES ('carol', 10)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = tx.Exec("DELETE FROM accounts WHERE name = 'alice'"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = tx.Exec("CREATE TABLE audit (note STRING)"); err != nil {
+		t.Fatal(err)
+	}
+	if err = tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	names, err = queryStrings(tdb, "SELECT (name) FROM accounts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameStrings(names, []string{"alice", "bob"}) {
+		t.Error(fmt.Errorf("invalid names after rollback %v", names))
+	}
+	if _, err = queryStrings(tdb, "SELECT * FROM audit"); err == nil {
+		t.Error(fmt.Errorf("expected table audit not exist"))
+	}
+	if _, err = os.Stat("tmp-tx/audit"); !os.IsNotExist(err) {
+		t.Error(fmt.Errorf("expected no folder of table audit, got %v", err))
+	}
+}
+
+// TestTransactionLock other connection waits for transaction to finish
+func TestTransactionLock(t *testing.T) {
+	tdb := openTestDB(t, "tmp-tx-lock")
+	defer tdb.Close()
+
+	execAll(t, tdb, `CREATE TABLE accounts (name STRING, balance INT)`)
+
+	tx, err := tdb.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = tx.Exec("INSERT INTO accounts (name, balance) VALUES ('alice', 100)"); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan []string)
+	go func() {
+		// runs on another connection
+		names, err := queryStrings(tdb, "SELECT (name) FROM accounts")
+		if err != nil {
+			t.Error(err)
+		}
+		done <- names
+	}()
+
+	select {
+	case names := <-done:
+		t.Fatal(fmt.Errorf("query not blocked by transaction, got %v", names))
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	names := <-done
+	if !sameStrings(names, []string{"alice"}) {
+		t.Error(fmt.Errorf("invalid names %v", names))
+	}
+}
+
+// txQueryStrings runs query in transaction and returns first column of all rows as strings
+func txQueryStrings(tx *sql.Tx, query string, args ...interface{}) ([]string, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []string{}
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			return nil, err
+		}
+		res = append(res, s)
+	}
+	return res, rows.Err()
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/comomac/furydb"
+)
+
+var errNegative = errors.New("negative value")
+
+// product multiplies values, it fails for negative value
+type product struct {
+	value float64
+}
+
+func (p *product) Step(v float64) error {
+	if v < 0 {
+		return errNegative
+	}
+	p.value *= v
+	return nil
+}
+
+func (p *product) Done() float64 {
+	return p.value
+}
+
+// joined joins strings in order aggregated, gives null for no string
+type joined struct {
+	parts []string
+}
+
+func (j *joined) Step(s string) {
+	j.parts = append(j.parts, s)
+}
+
+func (j *joined) Done() (*string, error) {
+	if len(j.parts) == 0 {
+		return nil, nil
+	}
+	s := strings.Join(j.parts, "+")
+	return &s, nil
+}
+
+// functions are registered once for all tests
+func init() {
+	funcs := map[string]interface{}{
+		"slugify": func(s string) string {
+			return strings.Trim(strings.Map(func(r rune) rune {
+				if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+					return r
+				}
+				return '-'
+			}, strings.ToLower(s)), "-")
+		},
+		"hypot": func(a, b float64) (float64, error) {
+			if a < 0 || b < 0 {
+				return 0, errNegative
+			}
+			return math.Hypot(a, b), nil
+		},
+		"or_default": func(s *string, def string) string {
+			if s == nil {
+				return def
+			}
+			return *s
+		},
+		"half": func(n int8) *int8 {
+			if n%2 != 0 {
+				return nil
+			}
+			n /= 2
+			return &n
+		},
+		"total": func(base int, ns ...int) int {
+			for _, n := range ns {
+				base += n
+			}
+			return base
+		},
+		"year_of":  func(t time.Time) int { return t.Year() },
+		"is_short": func(b []byte) bool { return len(b) < 4 },
+		"big":      func() uint64 { return math.MaxUint64 },
+		"boom": func(n int) int {
+			if n > 1 {
+				panic("boom")
+			}
+			return n
+		},
+	}
+	for name, fn := range funcs {
+		if err := furydb.RegisterFunc(name, fn); err != nil {
+			panic(err)
+		}
+	}
+	if err := furydb.RegisterAggregate("product", func() *product { return &product{value: 1} }); err != nil {
+		panic(err)
+	}
+	if err := furydb.RegisterAggregate("joined", func() *joined { return &joined{} }); err != nil {
+		panic(err)
+	}
+	if err := furydb.RegisterAggregate("boom_agg", func() *boomAgg { return &boomAgg{} }); err != nil {
+		panic(err)
+	}
+}
+
+// boomAgg panics on value more than 1
+type boomAgg struct{}
+
+func (*boomAgg) Step(n int) {
+	if n > 1 {
+		panic("boom")
+	}
+}
+
+func (*boomAgg) Done() int { return 0 }
+
+// TestUserFuncs go functions and aggregates registered on the driver
+func TestUserFuncs(t *testing.T) {
+	tdb := openTestDB(t, "tmp-udf")
+	defer tdb.Close()
+
+	execAll(t, tdb,
+		`CREATE TABLE posts (id INT PRIMARY KEY, title STRING, cat STRING, score FLOAT, born TIME, data BYTES)`,
+		`INSERT INTO posts (id, title, cat, score, born, data) VALUES (1, 'Hello, World!', 'a', 2, '2020-05-17', '\x0102')`,
+		`INSERT INTO posts (id, title, cat, score, born) VALUES (2, 'Go 1.16 Released', 'a', 3.5, '2021-02-16')`,
+		`INSERT INTO posts (id, title, cat, score) VALUES (3, 'Fury DB', 'b', 4)`,
+		`INSERT INTO posts (id, cat) VALUES (4, 'b')`,
+	)
+
+	tests := map[string]string{
+		"SELECT slugify(title) FROM posts ORDER BY id":                                    "hello--world go-1-16-released fury-db NULL",
+		"SELECT id FROM posts WHERE SLUGIFY(title) LIKE 'go%'":                            "2",
+		"SELECT hypot(3, 4), hypot(score, '0') FROM posts WHERE id = 1":                   "5|2",
+		"SELECT or_default(title, 'none'), or_default(NULL, cat) FROM posts WHERE id = 4": "none|b",
+		"SELECT half(10), half(7), half(NULL) FROM posts WHERE id = 1":                    "5|NULL|NULL",
+		"SELECT total(1), total(1, 2), total(1, 2, 3, id) FROM posts WHERE id = 4":        "1|3|10",
+		"SELECT year_of(born), is_short(data), is_short(title) FROM posts WHERE id = 1":   "2020|true|false",
+		"SELECT UPPER(slugify(cat || title)) FROM posts WHERE id = 3":                     "BFURY-DB",
+		"SELECT product(score), joined(cat) FROM posts":                                   "28|a+a+b+b",
+		"SELECT cat, product(score), joined(title) FROM posts GROUP BY cat ORDER BY cat":  "a|7|Hello, World!+Go 1.16 Released b|4|Fury DB",
+		"SELECT joined(DISTINCT cat), COUNT(*) FROM posts":                                "a+b|4",
+		"SELECT joined(title) FROM posts WHERE id = 4":                                    "NULL",
+		"SELECT cat FROM posts GROUP BY cat HAVING product(score) > 5":                    "a",
+	}
+	for query, want := range tests {
+		rows, err := queryRows(tdb, query)
+		if err != nil {
+			t.Error(fmt.Errorf("%s: %v", query, err))
+			continue
+		}
+		if strings.Join(rows, " ") != want {
+			t.Error(fmt.Errorf("%s: expected %s, got %v", query, want, rows))
+		}
+	}
+
+	execAll(t, tdb, `UPDATE posts SET title = slugify(title) WHERE id = 1`)
+	rows, err := queryRows(tdb, "SELECT title FROM posts WHERE id = 1")
+	if err != nil || strings.Join(rows, " ") != "hello--world" {
+		t.Error(fmt.Errorf("expected updated row, got %v %v", rows, err))
+	}
+
+	errs := map[string]error{
+		"SELECT hypot(-1, 1) FROM posts WHERE id = 1":           errNegative,
+		"SELECT product(-1) FROM posts":                         errNegative,
+		"SELECT slugify(id) FROM posts":                         furydb.ErrValueTypeNotString,
+		"SELECT hypot(title, 1) FROM posts WHERE id = 1":        furydb.ErrValueTypeNotFloat,
+		"SELECT product(title) FROM posts WHERE id = 1":         furydb.ErrValueTypeNotFloat,
+		"SELECT half(1000) FROM posts WHERE id = 1":             furydb.ErrIntegerOverflow,
+		"SELECT big() FROM posts WHERE id = 1":                  furydb.ErrIntegerOverflow,
+		"SELECT product(score) FROM posts WHERE product(1) > 0": furydb.ErrAggregateNotAllowed,
+		"SELECT boom(id) FROM posts":                            furydb.ErrInvalidFunc,
+		"SELECT boom_agg(id) FROM posts":                        furydb.ErrInvalidFunc,
+	}
+	for query, want := range errs {
+		if _, err = queryRows(tdb, query); !errors.Is(err, want) {
+			t.Error(fmt.Errorf("%s: expected %v, got %v", query, want, err))
+		}
+	}
+
+	// panic of function fails the statement, which is rolled back
+	if _, err = tdb.Exec("UPDATE posts SET score = boom(id)"); !errors.Is(err, furydb.ErrInvalidFunc) {
+		t.Error(fmt.Errorf("expected %v, got %v", furydb.ErrInvalidFunc, err))
+	}
+	rows, err = queryRows(tdb, "SELECT score FROM posts ORDER BY id")
+	if err != nil || strings.Join(rows, " ") != "2 3.5 4 NULL" {
+		t.Error(fmt.Errorf("expected scores not updated, got %v %v", rows, err))
+	}
+
+	bad := []string{
+		"SELECT slugify() FROM posts",
+		"SELECT slugify('a', 'b') FROM posts",
+		"SELECT total() FROM posts",
+		"SELECT product(*) FROM posts",
+		"SELECT product(1, 2) FROM posts",
+	}
+	for _, query := range bad {
+		if _, err = tdb.Exec(query); err == nil {
+			t.Error(fmt.Errorf("%s: expected error", query))
+		}
+	}
+
+	// registration errors
+	registers := map[string]error{
+		"slugify":   furydb.RegisterFunc("SLUGIFY", strings.ToLower),
+		"lower":     furydb.RegisterFunc("lower", strings.ToLower),
+		"count":     furydb.RegisterFunc("count", strings.ToLower),
+		"coalesce":  furydb.RegisterFunc("coalesce", strings.ToLower),
+		"product":   furydb.RegisterAggregate("product", func() *joined { return &joined{} }),
+		"keyword":   furydb.RegisterFunc("select", strings.ToLower),
+		"name":      furydb.RegisterFunc("my func", strings.ToLower),
+		"not func":  furydb.RegisterFunc("notfunc", 1),
+		"arg type":  furydb.RegisterFunc("argtype", func(m map[string]int) int { return 0 }),
+		"no result": furydb.RegisterFunc("noresult", func(s string) {}),
+		"not error": furydb.RegisterFunc("noterror", func(s string) (string, string) { return s, s }),
+		"no step":   furydb.RegisterAggregate("nostep", func() *struct{} { return nil }),
+		"agg func":  furydb.RegisterAggregate("aggfunc", strings.ToLower),
+		"step null": furydb.RegisterAggregate("stepnull", func() *nullStep { return nil }),
+	}
+	for name, err := range registers {
+		want := furydb.ErrInvalidFunc
+		if name == "slugify" || name == "lower" || name == "count" || name == "coalesce" || name == "product" {
+			want = furydb.ErrFuncExist
+		}
+		if !errors.Is(err, want) {
+			t.Error(fmt.Errorf("%s: expected %v, got %v", name, want, err))
+		}
+	}
+}
+
+// nullStep takes null in Step, which aggregate is not given
+type nullStep struct{}
+
+func (*nullStep) Step(s *string) {}
+
+func (*nullStep) Done() string { return "" }
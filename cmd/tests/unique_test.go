@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/comomac/furydb"
+)
+
+// TestUniqueConstraint duplicate primary key and unique values are rejected
+func TestUniqueConstraint(t *testing.T) {
+	tdb := openTestDB(t, "tmp-unique")
+	defer tdb.Close()
+
+	execAll(t, tdb,
+		`CREATE TABLE users (id INT PRIMARY KEY, email STRING UNIQUE, first_name STRING, last_name STRING,
+			UNIQUE (first_name, last_name))`,
+		`CREATE TABLE pairs (a INT, b INT, v INT, PRIMARY KEY (a, b))`,
+		`INSERT INTO users (id, email, first_name, last_name) VALUES (1, 'ann@test.com', 'Ann', 'Lee')`,
+		`INSERT INTO users (id, email, first_name, last_name) VALUES (2, 'bob@test.com', 'Bob', 'Lee')`,
+		`INSERT INTO pairs (a, b, v) VALUES (1, 1, 1)`,
+		`INSERT INTO pairs (a, b, v) VALUES (1, 2, 2)`,
+	)
+
+	// expected constraint name of each query, empty is no error
+	tests := []struct {
+		query string
+		cstr  string
+	}{
+		{"INSERT INTO users (id, email) VALUES (1, 'cid@test.com')", "cstr-pk"},
+		{"INSERT INTO users (id, email) VALUES (3, 'ann@test.com')", "cstr-unique-email"},
+		{"INSERT INTO users (id, first_name, last_name) VALUES (3, 'Ann', 'Lee')", "cstr-unique-first_name-last_name"},
+		{"INSERT INTO users (id, first_name, last_name) VALUES (3, 'Ann', 'Kim')", ""},
+		{"UPDATE users SET id = 2 WHERE id = 1", "cstr-pk"},
+		{"UPDATE users SET email = 'bob@test.com' WHERE id = 1", "cstr-unique-email"},
+		{"UPDATE users SET last_name = 'Kim' WHERE id = 1", "cstr-unique-first_name-last_name"},
+		{"UPDATE users SET email = 'ann@test.com' WHERE id = 1", ""},
+		{"UPDATE users SET id = 10 WHERE id = 1", ""},
+		// null is not equal to other null
+		{"INSERT INTO users (id) VALUES (4)", ""},
+		{"INSERT INTO users (id) VALUES (5)", ""},
+		{"INSERT INTO pairs (a, b, v) VALUES (1, 2, 3)", "cstr-pk"},
+		{"INSERT INTO pairs (a, b, v) VALUES (2, 2, 3)", ""},
+		{"UPDATE pairs SET b = 2 WHERE v = 1", "cstr-pk"},
+		{"UPDATE pairs SET b = 3 WHERE v = 1", ""},
+	}
+	for _, test := range tests {
+		_, err := tdb.Exec(test.query)
+		if test.cstr == "" {
+			if err != nil {
+				t.Error(fmt.Errorf("%s: %v", test.query, err))
+			}
+			continue
+		}
+		var cerr *furydb.ConstraintError
+		if !errors.As(err, &cerr) || cerr.Name != test.cstr || !errors.Is(err, furydb.ErrDuplicateKey) {
+			t.Error(fmt.Errorf("%s: expected violation of %s, got %v", test.query, test.cstr, err))
+		}
+	}
+
+	// rejected statements changed nothing
+	ids, err := queryStrings(tdb, "SELECT (id) FROM users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameStrings(ids, []string{"10", "2", "3", "4", "5"}) {
+		t.Error(fmt.Errorf("invalid ids %v", ids))
+	}
+	vals, err := queryStrings(tdb, "SELECT (v) FROM pairs WHERE a = 1 AND b = 3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameStrings(vals, []string{"1"}) {
+		t.Error(fmt.Errorf("invalid values %v", vals))
+	}
+
+	// violation inside transaction keeps the transaction usable
+	tx, err := tdb.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = tx.Exec("INSERT INTO users (id, email) VALUES (2, 'dan@test.com')"); !errors.Is(err, furydb.ErrDuplicateKey) {
+		t.Error(fmt.Errorf("expected duplicate key in transaction, got %v", err))
+	}
+	if _, err = tx.Exec("INSERT INTO users (id, email) VALUES (6, 'dan@test.com')"); err != nil {
+		t.Fatal(err)
+	}
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	ids, err = queryStrings(tdb, "SELECT (id) FROM users WHERE email = 'dan@test.com'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameStrings(ids, []string{"6"}) {
+		t.Error(fmt.Errorf("invalid ids %v", ids))
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/comomac/furydb"
+)
+
+// TestUpdate change rows that match where
+func TestUpdate(t *testing.T) {
+	tdb := openTestDB(t, "tmp-update")
+	defer tdb.Close()
+
+	execAll(t, tdb,
+		`CREATE TABLE people (id UUID PRIMARY KEY, name STRING, age INT, score FLOAT)`,
+		`INSERT INTO people (id,name,age,score) VALUES ('00000000-0000-0000-0000-000000000001','alice',30,1.5);`,
+		`INSERT INTO people (id,name,age,score) VALUES ('00000000-0000-0000-0000-000000000002','bob',40,2.5);`,
+		`INSERT INTO people (id,name,age,score) VALUES ('00000000-0000-0000-0000-000000000003','carol',50,3.5);`,
+	)
+
+	// update single row
+	res, err := tdb.Exec("UPDATE people SET age = 41, score = 9 WHERE name = 'bob'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := res.RowsAffected(); n != 1 {
+		t.Error(fmt.Errorf("expected 1 row affected, got %d", n))
+	}
+	names, err := queryStrings(tdb, "SELECT (name) FROM people WHERE age = 41 AND score = 9.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameStrings(names, []string{"bob"}) {
+		t.Error(fmt.Errorf("bob not updated, got %v", names))
+	}
+
+	// update all rows, value can refer to column
+	res, err = tdb.Exec("UPDATE people SET name = 'someone', score = age;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := res.RowsAffected(); n != 3 {
+		t.Error(fmt.Errorf("expected 3 rows affected, got %d", n))
+	}
+	names, err = queryStrings(tdb, "SELECT (name) FROM people WHERE name = 'someone' AND score > 40")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 2 {
+		t.Error(fmt.Errorf("expected 2 rows, got %v", names))
+	}
+
+	// no match
+	res, err = tdb.Exec("UPDATE people SET age = 1 WHERE age > 100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := res.RowsAffected(); n != 0 {
+		t.Error(fmt.Errorf("expected 0 rows affected, got %d", n))
+	}
+
+	// change primary key
+	_, err = tdb.Exec("UPDATE people SET id = '00000000-0000-0000-0000-000000000009' WHERE age = 30")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids, err := queryStrings(tdb, "SELECT (id) FROM people")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"00000000-0000-0000-0000-000000000009",
+		"00000000-0000-0000-0000-000000000002",
+		"00000000-0000-0000-0000-000000000003",
+	}
+	if !sameStrings(ids, expected) {
+		t.Error(fmt.Errorf("expected %v, got %v", expected, ids))
+	}
+
+	// invalid updates
+	badQueries := map[string]error{
+		"UPDATE people SET age = 'old'":            furydb.ErrValueTypeNotInt,
+		"UPDATE people SET nope = 1":               furydb.ErrColumnNotExist,
+		"UPDATE nope SET age = 1":                  furydb.ErrTableNotExist,
+		"UPDATE people SET age = true":             furydb.ErrValueTypeNotMatch,
+		"UPDATE people SET id = 'x'":               furydb.ErrValueTypeNotUUID,
+		"UPDATE people SET age = 1 WHERE nope = 1": furydb.ErrColumnNotExist,
+	}
+	for q, expected := range badQueries {
+		_, err := tdb.Exec(q)
+		if err != expected {
+			t.Error(fmt.Errorf("%s: expected %v, got %v", q, expected, err))
+		}
+	}
+}
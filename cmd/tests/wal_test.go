@@ -0,0 +1,103 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+)
+
+// TestWALRecover log left by unclean shutdown is replayed on open
+func TestWALRecover(t *testing.T) {
+	folder := "tmp-wal"
+	tdb := openTestDB(t, folder)
+	execAll(t, tdb,
+		`CREATE TABLE accounts (name STRING, balance INT)`,
+		`INSERT INTO accounts (name, balance) VALUES ('alice', 100)`,
+	)
+	err := tdb.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// same database, changes only written to log of the copy
+	crashed := "tmp-wal-crashed"
+	err = os.RemoveAll(crashed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	copyDir(t, folder, crashed)
+	cdb, err := sql.Open("fury", crashed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cdb.Close()
+	execAll(t, cdb,
+		`INSERT INTO accounts (name, balance) VALUES ('bob', 50)`,
+		`UPDATE accounts SET balance = 0 WHERE name = 'alice'`,
+	)
+	dat, err := ioutil.ReadFile(path.Join(crashed, "wal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// last transaction is partially written
+	err = ioutil.WriteFile(path.Join(folder, "wal"), dat[:len(dat)-3], 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tdb, err = sql.Open("fury", folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tdb.Close()
+
+	names, err := queryStrings(tdb, "SELECT (name) FROM accounts WHERE balance > 0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameStrings(names, []string{"alice", "bob"}) {
+		t.Error(fmt.Errorf("invalid names after replay %v", names))
+	}
+	info, err := os.Stat(path.Join(folder, "wal"))
+	if err == nil && info.Size() > 0 {
+		t.Error(fmt.Errorf("log not emptied after replay"))
+	}
+
+	// database keeps working after replay
+	execAll(t, tdb, `INSERT INTO accounts (name, balance) VALUES ('carol', 10)`)
+	names, err = queryStrings(tdb, "SELECT (name) FROM accounts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameStrings(names, []string{"alice", "bob", "carol"}) {
+		t.Error(fmt.Errorf("invalid names %v", names))
+	}
+}
+
+// copyDir copies all files of src dir to dst dir
+func copyDir(t *testing.T, src string, dst string) {
+	err := filepath.Walk(src, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return os.MkdirAll(filepath.Join(dst, rel), 0755)
+		}
+		dat, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(filepath.Join(dst, rel), dat, 0644)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
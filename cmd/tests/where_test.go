@@ -0,0 +1,133 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"testing"
+)
+
+// openTestDB opens new empty database in folder for test
+func openTestDB(t *testing.T, folder string) *sql.DB {
+	err := os.RemoveAll(folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tdb, err := sql.Open("fury", folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tdb
+}
+
+// execAll runs queries one by one
+func execAll(t *testing.T, tdb *sql.DB, queries ...string) {
+	for _, query := range queries {
+		_, err := tdb.Exec(query)
+		if err != nil {
+			t.Fatal(fmt.Errorf("%s: %v", query, err))
+		}
+	}
+}
+
+// queryStrings runs query and returns first column of all rows as strings
+func queryStrings(tdb *sql.DB, query string, args ...interface{}) ([]string, error) {
+	rows, err := tdb.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []string{}
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			return nil, err
+		}
+		res = append(res, s)
+	}
+	return res, rows.Err()
+}
+
+// TestWhere filter rows by various column types
+func TestWhere(t *testing.T) {
+	tdb := openTestDB(t, "tmp-where")
+	defer tdb.Close()
+
+	execAll(t, tdb,
+		`CREATE TABLE items (
+			name STRING,
+			active BOOL,
+			qty INT,
+			price FLOAT,
+			added TIME,
+			code BYTES,
+			ref UUID
+		)`,
+		`INSERT INTO items (name,active,qty,price,added,code,ref)
+		VALUES ('apple','true',3,1.5,'2020-01-01T00:00:00Z','\x0a0b','00000000-0000-0000-0000-000000000001');`,
+		`INSERT INTO items (name,active,qty,price,added,code,ref)
+		VALUES ('banana','false',10,0.25,'2020-06-01T12:00:00Z','\x0c','00000000-0000-0000-0000-000000000002');`,
+		`INSERT INTO items (name,active,qty,price,added,code,ref)
+		VALUES ('cherry','true',-2,12,'2021-01-01T00:00:00Z','\xff','00000000-0000-0000-0000-000000000003');`,
+		`INSERT INTO items (name,qty)
+		VALUES ('durian',7);`,
+	)
+
+	tests := map[string][]string{
+		"name = 'apple'":                 {"apple"},
+		"name <> 'apple'":                {"banana", "cherry", "durian"},
+		"active = true":                  {"apple", "cherry"},
+		"NOT active":                     {"banana"},
+		"qty > 3":                        {"banana", "durian"},
+		"qty >= 3 AND qty <= 7":          {"apple", "durian"},
+		"qty < 0 OR qty = 10":            {"banana", "cherry"},
+		"price > 1":                      {"apple", "cherry"},
+		"price = 12":                     {"cherry"},
+		"added < '2020-06-01'":           {"apple"},
+		"added >= '2020-06-01 12:00:00'": {"banana", "cherry"},
+		"code = '\\x0c'":                 {"banana"},
+		"code > '\\x0b'":                 {"banana", "cherry"},
+		"ref = '00000000-0000-0000-0000-000000000003'": {"cherry"},
+		"name = 'apple' AND (qty > 2 OR price <> 1)":   {"apple"},
+		"NOT (name = 'apple' OR name = 'banana')":      {"cherry", "durian"},
+		"active <> false OR qty = 7":                   {"apple", "cherry", "durian"},
+		"price > 100 AND price = NULL":                 {},
+	}
+	for where, expected := range tests {
+		names, err := queryStrings(tdb, "SELECT (name) FROM items WHERE "+where)
+		if err != nil {
+			t.Error(fmt.Errorf("%s: %v", where, err))
+			continue
+		}
+		if !sameStrings(names, expected) {
+			t.Error(fmt.Errorf("%s: expected %v, got %v", where, expected, names))
+		}
+	}
+
+	// invalid where
+	for _, where := range []string{"nope = 1", "qty = 'x'", "name = 1", "qty AND active", "(qty = 1"} {
+		_, err := queryStrings(tdb, "SELECT (name) FROM items WHERE "+where)
+		if err == nil {
+			t.Error(fmt.Errorf("%s: expected error", where))
+		}
+	}
+}
+
+// sameStrings compares string slices ignoring order
+func sameStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	count := map[string]int{}
+	for _, s := range a {
+		count[s]++
+	}
+	for _, s := range b {
+		count[s]--
+		if count[s] < 0 {
+			return false
+		}
+	}
+	return true
+}
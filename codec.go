@@ -0,0 +1,251 @@
+package furydb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Note:
+// Row is encoded as number of columns followed by each column in table column order.
+// Column starts with its type, 0 being null, then the value
+//   bool          1 byte
+//   int           varint
+//   float         8 bytes
+//   string, bytes uvarint length + bytes
+//   time          uvarint length + time binary
+//   uuid          16 bytes
+
+// encodeRow converts row into bytes, columns missing from row are null
+func encodeRow(table *Table, row *Row) ([]byte, error) {
+	columns := make([]*Column, len(table.Columns))
+	for i, tcol := range table.Columns {
+		for _, rowCol := range row.Columns {
+			if rowCol.Name == tcol.Name {
+				columns[i] = rowCol
+				break
+			}
+		}
+	}
+	return encodeColumns(columns)
+}
+
+// encodeColumns converts columns into bytes in same order, nil column is null
+func encodeColumns(columns []*Column) ([]byte, error) {
+	buf := make([]byte, 0, 64)
+	buf = appendUvarint(buf, uint64(len(columns)))
+
+	for _, col := range columns {
+		if col == nil || col.DataIsNull || col.Type == 0 {
+			buf = append(buf, 0)
+			continue
+		}
+
+		buf = append(buf, byte(col.Type))
+		switch col.Type {
+		case ColumnTypeBool:
+			if col.DataBool {
+				buf = append(buf, 1)
+			} else {
+				buf = append(buf, 0)
+			}
+		case ColumnTypeInt:
+			tmp := make([]byte, binary.MaxVarintLen64)
+			n := binary.PutVarint(tmp, col.DataInt)
+			buf = append(buf, tmp[:n]...)
+		case ColumnTypeFloat:
+			tmp := make([]byte, 8)
+			binary.LittleEndian.PutUint64(tmp, math.Float64bits(col.DataFloat))
+			buf = append(buf, tmp...)
+		case ColumnTypeString:
+			buf = appendUvarint(buf, uint64(len(col.DataString)))
+			buf = append(buf, col.DataString...)
+		case ColumnTypeTime:
+			dat, err := col.DataTime.MarshalBinary()
+			if err != nil {
+				return nil, err
+			}
+			buf = appendUvarint(buf, uint64(len(dat)))
+			buf = append(buf, dat...)
+		case ColumnTypeBytes:
+			buf = appendUvarint(buf, uint64(len(col.DataBytes)))
+			buf = append(buf, col.DataBytes...)
+		case ColumnTypeUUID:
+			buf = append(buf, col.DataUUID[:]...)
+		default:
+			return nil, ErrUnknownColumnType
+		}
+	}
+
+	return buf, nil
+}
+
+// decodeRow converts bytes back to row, columns are named after table columns
+func decodeRow(table *Table, dat []byte) (*Row, error) {
+	columns, err := decodeColumns(dat)
+	if err != nil {
+		return nil, err
+	}
+
+	row := &Row{TableName: table.Name}
+	for i, col := range columns {
+		// columns beyond table schema are dropped
+		if i < len(table.Columns) {
+			col.Name = table.Columns[i].Name
+			if col.DataIsNull {
+				col.Type = table.Columns[i].Type
+			}
+			row.Columns = append(row.Columns, col)
+		}
+	}
+
+	// row written before column was added
+	table.normalizeRow(row)
+
+	return row, nil
+}
+
+// decodeColumns converts bytes back to columns, columns are not named
+func decodeColumns(dat []byte) ([]*Column, error) {
+	errCorrupt := fmt.Errorf("row data corrupted")
+
+	num, n := binary.Uvarint(dat)
+	if n <= 0 {
+		return nil, errCorrupt
+	}
+	dat = dat[n:]
+
+	columns := []*Column{}
+	for i := 0; i < int(num); i++ {
+		if len(dat) < 1 {
+			return nil, errCorrupt
+		}
+		col := &Column{Type: ColumnType(dat[0])}
+		dat = dat[1:]
+
+		switch col.Type {
+		case 0:
+			col.DataIsNull = true
+		case ColumnTypeBool:
+			if len(dat) < 1 {
+				return nil, errCorrupt
+			}
+			col.DataBool = dat[0] == 1
+			dat = dat[1:]
+		case ColumnTypeInt:
+			col.DataInt, n = binary.Varint(dat)
+			if n <= 0 {
+				return nil, errCorrupt
+			}
+			dat = dat[n:]
+		case ColumnTypeFloat:
+			if len(dat) < 8 {
+				return nil, errCorrupt
+			}
+			col.DataFloat = math.Float64frombits(binary.LittleEndian.Uint64(dat))
+			dat = dat[8:]
+		case ColumnTypeString, ColumnTypeTime, ColumnTypeBytes:
+			size, n := binary.Uvarint(dat)
+			if n <= 0 || uint64(len(dat)-n) < size {
+				return nil, errCorrupt
+			}
+			val := dat[n : n+int(size)]
+			dat = dat[n+int(size):]
+
+			switch col.Type {
+			case ColumnTypeString:
+				col.DataString = string(val)
+			case ColumnTypeTime:
+				t := time.Time{}
+				err := t.UnmarshalBinary(val)
+				if err != nil {
+					return nil, err
+				}
+				col.DataTime = t
+			case ColumnTypeBytes:
+				col.DataBytes = append([]byte{}, val...)
+			}
+		case ColumnTypeUUID:
+			if len(dat) < 16 {
+				return nil, errCorrupt
+			}
+			copy(col.DataUUID[:], dat)
+			dat = dat[16:]
+		default:
+			return nil, ErrUnknownColumnType
+		}
+		columns = append(columns, col)
+	}
+
+	return columns, nil
+}
+
+// appendUvarint appends unsigned varint to buf
+func appendUvarint(buf []byte, v uint64) []byte {
+	tmp := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(tmp, v)
+	return append(buf, tmp[:n]...)
+}
+
+// encodeKey converts value into bytes that sort in same order as the values,
+// null sorts first. Encoded values never are prefix of one another, so they can be joined.
+func encodeKey(col *Column) ([]byte, error) {
+	if col == nil || col.DataIsNull || col.Type == 0 {
+		return []byte{0}, nil
+	}
+
+	buf := []byte{1}
+	tmp := make([]byte, 8)
+	switch col.Type {
+	case ColumnTypeBool:
+		if col.DataBool {
+			buf = append(buf, 1)
+		} else {
+			buf = append(buf, 0)
+		}
+	case ColumnTypeInt:
+		// flip sign bit so negative sorts first
+		binary.BigEndian.PutUint64(tmp, uint64(col.DataInt)^(1<<63))
+		buf = append(buf, tmp...)
+	case ColumnTypeFloat:
+		f := col.DataFloat
+		if f == 0 {
+			// -0 equals 0
+			f = 0
+		}
+		bits := math.Float64bits(f)
+		if bits&(1<<63) != 0 {
+			bits = ^bits
+		} else {
+			bits |= 1 << 63
+		}
+		binary.BigEndian.PutUint64(tmp, bits)
+		buf = append(buf, tmp...)
+	case ColumnTypeString:
+		buf = appendKeyBytes(buf, []byte(col.DataString))
+	case ColumnTypeTime:
+		binary.BigEndian.PutUint64(tmp, uint64(col.DataTime.Unix())^(1<<63))
+		buf = append(buf, tmp...)
+		binary.BigEndian.PutUint32(tmp, uint32(col.DataTime.Nanosecond()))
+		buf = append(buf, tmp[:4]...)
+	case ColumnTypeBytes:
+		buf = appendKeyBytes(buf, col.DataBytes)
+	case ColumnTypeUUID:
+		buf = append(buf, col.DataUUID[:]...)
+	default:
+		return nil, ErrUnknownColumnType
+	}
+	return buf, nil
+}
+
+// appendKeyBytes appends variable length value, 0x00 is escaped as 0x00 0xff and end is 0x00 0x00
+func appendKeyBytes(buf []byte, dat []byte) []byte {
+	for _, b := range dat {
+		buf = append(buf, b)
+		if b == 0 {
+			buf = append(buf, 0xff)
+		}
+	}
+	return append(buf, 0, 0)
+}
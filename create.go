@@ -1,43 +1,134 @@
 package furydb
 
 import (
+	"database/sql/driver"
 	"fmt"
 	"strings"
 )
 
 // TableCreateStatement represents a SQL CREATE TABLE statement.
 type TableCreateStatement struct {
-	Columns   []string // of individual column
-	Types     []string // of individual column type
-	TableName string
+	Columns     []string      // of individual column
+	Types       []string      // of individual column type
+	Constraints []*Constraint // of column and table constraints
+	TableName   string
 }
 
-type TableCreateResult struct {
+// columnTypeNames maps sql type names to column type
+var columnTypeNames = map[string]ColumnType{
+	"BOOL":      ColumnTypeBool,
+	"BOOLEAN":   ColumnTypeBool,
+	"INT":       ColumnTypeInt,
+	"INTEGER":   ColumnTypeInt,
+	"BIGINT":    ColumnTypeInt,
+	"FLOAT":     ColumnTypeFloat,
+	"DOUBLE":    ColumnTypeFloat,
+	"REAL":      ColumnTypeFloat,
+	"STRING":    ColumnTypeString,
+	"TEXT":      ColumnTypeString,
+	"VARCHAR":   ColumnTypeString,
+	"TIME":      ColumnTypeTime,
+	"TIMESTAMP": ColumnTypeTime,
+	"DATETIME":  ColumnTypeTime,
+	"BYTES":     ColumnTypeBytes,
+	"BYTEA":     ColumnTypeBytes,
+	"BLOB":      ColumnTypeBytes,
+	"UUID":      ColumnTypeUUID,
 }
 
-// queryTableCreate executes a SQL CREATE TABLE statement
-func (c *FuryConn) queryTableCreate(query string) (*TableCreateResult, error) {
-	parser := NewParser(strings.NewReader(query))
-	_, err := parser.parseTableCreate()
+// parseColumnType converts sql type name to column type
+func parseColumnType(name string) (ColumnType, error) {
+	typ, ok := columnTypeNames[strings.ToUpper(name)]
+	if !ok {
+		return 0, ErrUnknownColumnType
+	}
+	return typ, nil
+}
+
+// execTableCreate executes a SQL CREATE TABLE statement
+func (c *FuryConn) execTableCreate(stmt *TableCreateStatement, args []driver.Value) (*results, error) {
+	var err error
+	res := &results{}
+
+	// sanity check table not already exists
+	if found, _ := c.db.findTable(stmt.TableName); found {
+		return nil, ErrTableExist
+	}
+
+	table := &Table{
+		Name: stmt.TableName,
+	}
+	for i, colName := range stmt.Columns {
+		// sanity check duplicate column
+		for _, col := range table.Columns {
+			if col.Name == colName {
+				return nil, ErrColumnExist
+			}
+		}
+		typ, err := parseColumnType(stmt.Types[i])
+		if err != nil {
+			return nil, err
+		}
+		table.Columns = append(table.Columns, &Column{
+			Name: colName,
+			Type: typ,
+		})
+	}
+
+	// sanity check constraints
+	table.Constraints = stmt.Constraints
+	var pkName string
+	var fkNames []string
+	fks := map[string][]*Constraint{} // columns of foreign key by constraint name
+	for _, cstr := range table.Constraints {
+		col := table.findColumn(cstr.ColumnName)
+		if col == nil {
+			return nil, ErrColumnNotExist
+		}
+		cstr.Type = col.Type
+		if cstr.IsPrimaryKey {
+			if pkName != "" && pkName != cstr.Name {
+				return nil, ErrMultiplePrimaryKey
+			}
+			pkName = cstr.Name
+		}
+		if cstr.IsForeignKey {
+			if fks[cstr.Name] == nil {
+				fkNames = append(fkNames, cstr.Name)
+			}
+			fks[cstr.Name] = append(fks[cstr.Name], cstr)
+		}
+	}
+	// foreign key is checked once with all its columns
+	for _, name := range fkNames {
+		err = c.db.checkForeignKey(table, fks[name])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// folder of table rows, removed again if the create is rolled back
+	err = c.db.makeDir(table.Name)
 	if err != nil {
 		return nil, err
 	}
 
-	// todo finish me
+	c.db.Tables = append(c.db.Tables, table)
+	err = c.db.Save()
+	if err != nil {
+		// dont keep table that is not persisted
+		c.db.Tables = c.db.Tables[:len(c.db.Tables)-1]
+		return nil, err
+	}
 
-	return nil, nil
+	return res, nil
 }
 
 // parseTableCreate parses a SQL TABLE CREATE statement
 func (p *Parser) parseTableCreate() (*TableCreateStatement, error) {
 	stmt := &TableCreateStatement{}
 
-	// First token should be a "CREATE" keyword.
-	if tok, lit := p.scanIgnoreWhitespace(); tok != CREATE {
-		return nil, fmt.Errorf("found %q, expected CREATE", lit)
-	}
-
-	// Next we should see the "TABLE" keyword.
+	// "CREATE" keyword is read by parseCreate, we should see the "TABLE" keyword.
 	if tok, lit := p.scanIgnoreWhitespace(); tok != TABLE {
 		return nil, fmt.Errorf("found %q, expected TABLE", lit)
 	}
@@ -54,28 +145,66 @@ func (p *Parser) parseTableCreate() (*TableCreateStatement, error) {
 		return nil, fmt.Errorf("found %q, expected (", lit)
 	}
 
-	// loop over all our comma-delimited column.
+	// loop over all our comma-delimited column or table constraint.
 	for {
-		// Read column.
-		tok, lit := p.scanIgnoreWhitespace()
-		if tok != IDENT {
-			return nil, fmt.Errorf("found %q, expected column_name", lit)
-		}
-		stmt.Columns = append(stmt.Columns, lit)
-
-		// Read column type
 		tok, lit = p.scanIgnoreWhitespace()
-		if tok != IDENT {
+		switch tok {
+		case CONSTRAINT, PRIMARY, UNIQUE, FOREIGN:
+			// table constraint
+			p.unscan()
+			cstrs, err := p.parseTableConstraint()
+			if err != nil {
+				return nil, err
+			}
+			err = stmt.addConstraints(cstrs)
+			if err != nil {
+				return nil, err
+			}
+
+		case IDENT:
+			// Read column.
+			colName := lit
+			stmt.Columns = append(stmt.Columns, colName)
+
+			// Read column type
+			tok, lit = p.scanIgnoreWhitespace()
+			if tok != IDENT {
+				return nil, fmt.Errorf("found %q, expected column_type", lit)
+			}
+			stmt.Types = append(stmt.Types, lit)
+			typ, err := parseColumnType(lit)
+			if err != nil {
+				return nil, err
+			}
+
+			// type size is ignored, e.g. VARCHAR(255)
+			if tok, _ = p.scanIgnoreWhitespace(); tok == LEFTPAR {
+				if tok, lit = p.scanIgnoreWhitespace(); tok != NUMBER {
+					return nil, fmt.Errorf("found %q, expected type size", lit)
+				}
+				if tok, lit = p.scanIgnoreWhitespace(); tok != RIGHTPAR {
+					return nil, fmt.Errorf("found %q, expected )", lit)
+				}
+			} else {
+				p.unscan()
+			}
+
+			// loop over all semi-space seperated column conditions
+			cstrs, err := p.parseColumnConstraints(colName, typ)
+			if err != nil {
+				return nil, err
+			}
+			err = stmt.addConstraints(cstrs)
+			if err != nil {
+				return nil, err
+			}
+
+		default:
 			return nil, fmt.Errorf("found %q, expected column_name", lit)
 		}
-		stmt.Types = append(stmt.Types, lit)
-
-		// loop over all semi-space seperated column conditions
-		// todo
 
 		// If the next token is not a comma then break the loop.
-		if tok, _ = p.scanIgnoreWhitespace(); tok != COMMA {
-			// p.unscan()
+		if tok, lit = p.scanIgnoreWhitespace(); tok != COMMA {
 			break
 		}
 	}
@@ -85,11 +214,431 @@ func (p *Parser) parseTableCreate() (*TableCreateStatement, error) {
 		return nil, fmt.Errorf("found %q, expected )", lit)
 	}
 
-	// If the next token is not a comma then break the loop.
-	if tok, lit = p.scanValue(); tok != SEMICOL {
-		return nil, fmt.Errorf("found %q, expected ;", lit)
+	// statement may end with ;
+	if err := p.scanEnd(); err != nil {
+		return nil, err
 	}
 
 	// Return the successfully parsed statement.
 	return stmt, nil
 }
+
+// addConstraints adds constraints of a clause, key constraint name must be unique
+func (stmt *TableCreateStatement) addConstraints(cstrs []*Constraint) error {
+	for _, cstr := range cstrs {
+		if !cstr.isKey() {
+			continue
+		}
+		for _, cstr2 := range stmt.Constraints {
+			// second primary key has same default name, it is not just a name clash
+			if cstr.IsPrimaryKey && cstr2.IsPrimaryKey {
+				return ErrMultiplePrimaryKey
+			}
+			if cstr2.isKey() && cstr2.Name == cstr.Name {
+				return ErrConstraintExist
+			}
+		}
+	}
+	stmt.Constraints = append(stmt.Constraints, cstrs...)
+	return nil
+}
+
+// parseColumnConstraints parses constraints that follow the column type,
+// e.g. NOT NULL, PRIMARY KEY, UNIQUE, DEFAULT now(), REFERENCES users (id)
+func (p *Parser) parseColumnConstraints(colName string, typ ColumnType) ([]*Constraint, error) {
+	cstrs := []*Constraint{}
+
+	// name given by CONSTRAINT name
+	var name string
+	for {
+		cstr := &Constraint{
+			Name:       name,
+			ColumnName: colName,
+			Type:       typ,
+		}
+
+		tok, lit := p.scanIgnoreWhitespace()
+		switch tok {
+		case CONSTRAINT:
+			if name != "" {
+				return nil, fmt.Errorf("found %q, expected constraint", lit)
+			}
+			if tok, lit = p.scanIgnoreWhitespace(); tok != IDENT {
+				return nil, fmt.Errorf("found %q, expected constraint_name", lit)
+			}
+			name = lit
+			continue
+
+		case NULL:
+			// explicitly nullable, which is the default
+			continue
+
+		case NOT:
+			if tok, lit = p.scanIgnoreWhitespace(); tok != NULL {
+				return nil, fmt.Errorf("found %q, expected NULL", lit)
+			}
+			cstr.IsNotNull = true
+			if cstr.Name == "" {
+				cstr.Name = "cstr-" + colName
+			}
+
+		case PRIMARY:
+			if tok, lit = p.scanIgnoreWhitespace(); tok != KEY {
+				return nil, fmt.Errorf("found %q, expected KEY", lit)
+			}
+			cstr.IsPrimaryKey = true
+			cstr.IsUnique = true
+			cstr.IsNotNull = true
+			if cstr.Name == "" {
+				cstr.Name = "cstr-pk"
+			}
+
+		case UNIQUE:
+			cstr.IsUnique = true
+			if cstr.Name == "" {
+				cstr.Name = "cstr-unique-" + colName
+			}
+
+		case DEFAULT:
+			isNull, err := p.parseDefault(cstr)
+			if err != nil {
+				return nil, err
+			}
+			if isNull {
+				// default null is same as no default
+				name = ""
+				continue
+			}
+			if cstr.Name == "" {
+				cstr.Name = "cstr-" + colName
+			}
+
+		case REFERENCES:
+			tables, columns, err := p.parseReferences()
+			if err != nil {
+				return nil, err
+			}
+			if len(columns) > 1 {
+				return nil, ErrFieldValueLengthNotMatch
+			}
+			cstr.IsForeignKey = true
+			cstr.ForeignTable = tables
+			if len(columns) == 1 {
+				cstr.ForeignColumn = columns[0]
+			}
+			err = p.parseForeignActions(cstr)
+			if err != nil {
+				return nil, err
+			}
+			if cstr.Name == "" {
+				cstr.Name = "cstr-fk-" + colName
+			}
+
+		default:
+			if name != "" {
+				return nil, fmt.Errorf("found %q, expected constraint", lit)
+			}
+			p.unscan()
+			return cstrs, nil
+		}
+
+		cstrs = append(cstrs, cstr)
+		name = ""
+	}
+}
+
+// parseTableConstraint parses constraint that is not part of a column definition,
+// e.g. PRIMARY KEY (a, b), UNIQUE (a), FOREIGN KEY (a) REFERENCES t (b)
+func (p *Parser) parseTableConstraint() ([]*Constraint, error) {
+	var name string
+
+	tok, lit := p.scanIgnoreWhitespace()
+	if tok == CONSTRAINT {
+		if tok, lit = p.scanIgnoreWhitespace(); tok != IDENT {
+			return nil, fmt.Errorf("found %q, expected constraint_name", lit)
+		}
+		name = lit
+		tok, lit = p.scanIgnoreWhitespace()
+	}
+
+	cstr := &Constraint{}
+	var prefix string
+	switch tok {
+	case PRIMARY:
+		if tok, lit = p.scanIgnoreWhitespace(); tok != KEY {
+			return nil, fmt.Errorf("found %q, expected KEY", lit)
+		}
+		cstr.IsPrimaryKey = true
+		cstr.IsUnique = true
+		cstr.IsNotNull = true
+		prefix = "cstr-pk"
+	case UNIQUE:
+		cstr.IsUnique = true
+		prefix = "cstr-unique"
+	case FOREIGN:
+		if tok, lit = p.scanIgnoreWhitespace(); tok != KEY {
+			return nil, fmt.Errorf("found %q, expected KEY", lit)
+		}
+		cstr.IsForeignKey = true
+		prefix = "cstr-fk"
+	default:
+		return nil, fmt.Errorf("found %q, expected PRIMARY, UNIQUE or FOREIGN", lit)
+	}
+
+	columns, err := p.parseIdentList()
+	if err != nil {
+		return nil, err
+	}
+
+	var foreignColumns []string
+	if cstr.IsForeignKey {
+		if tok, lit = p.scanIgnoreWhitespace(); tok != REFERENCES {
+			return nil, fmt.Errorf("found %q, expected REFERENCES", lit)
+		}
+		cstr.ForeignTable, foreignColumns, err = p.parseReferences()
+		if err != nil {
+			return nil, err
+		}
+		if foreignColumns != nil && len(foreignColumns) != len(columns) {
+			return nil, ErrFieldValueLengthNotMatch
+		}
+		err = p.parseForeignActions(cstr)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if name == "" {
+		name = prefix
+		if !cstr.IsPrimaryKey {
+			name += "-" + strings.Join(columns, "-")
+		}
+	}
+
+	// composite key is made of constraints with same name, one for each column
+	cstrs := []*Constraint{}
+	for i, colName := range columns {
+		dup := *cstr
+		dup.Name = name
+		dup.ColumnName = colName
+		if foreignColumns != nil {
+			dup.ForeignColumn = foreignColumns[i]
+		}
+		cstrs = append(cstrs, &dup)
+	}
+
+	return cstrs, nil
+}
+
+// parseIdentList parses comma-delimited identifiers in parentheses, e.g. (a, b)
+func (p *Parser) parseIdentList() ([]string, error) {
+	if tok, lit := p.scanIgnoreWhitespace(); tok != LEFTPAR {
+		return nil, fmt.Errorf("found %q, expected (", lit)
+	}
+
+	idents := []string{}
+	for {
+		tok, lit := p.scanIgnoreWhitespace()
+		if tok != IDENT {
+			return nil, fmt.Errorf("found %q, expected column_name", lit)
+		}
+		idents = append(idents, lit)
+
+		tok, lit = p.scanIgnoreWhitespace()
+		if tok == RIGHTPAR {
+			break
+		} else if tok != COMMA {
+			return nil, fmt.Errorf("found %q, expected )", lit)
+		}
+	}
+
+	return idents, nil
+}
+
+// parseReferences parses the table and optional columns after REFERENCES
+func (p *Parser) parseReferences() (string, []string, error) {
+	tok, lit := p.scanIgnoreWhitespace()
+	if tok != IDENT {
+		return "", nil, fmt.Errorf("found %q, expected table_name", lit)
+	}
+	table := lit
+
+	// columns are optional, primary key of the table is used if not given
+	if tok, _ = p.scanIgnoreWhitespace(); tok != LEFTPAR {
+		p.unscan()
+		return table, nil, nil
+	}
+	p.unscan()
+	columns, err := p.parseIdentList()
+	if err != nil {
+		return "", nil, err
+	}
+
+	return table, columns, nil
+}
+
+// parseForeignActions parses optional actions of foreign key,
+// e.g. ON DELETE CASCADE ON UPDATE SET NULL
+func (p *Parser) parseForeignActions(cstr *Constraint) error {
+	for {
+		if tok, _ := p.scanIgnoreWhitespace(); tok != ON {
+			p.unscan()
+			return nil
+		}
+		tok, lit := p.scanIgnoreWhitespace()
+		if tok != DELETE && tok != UPDATE {
+			return fmt.Errorf("found %q, expected DELETE or UPDATE", lit)
+		}
+		isDelete := tok == DELETE
+
+		var action string
+		tok, lit = p.scanIgnoreWhitespace()
+		switch {
+		case tok == SET:
+			tok, lit = p.scanIgnoreWhitespace()
+			if tok == NULL {
+				action = ForeignActionSetNull
+			} else if tok == DEFAULT {
+				action = ForeignActionSetDefault
+			} else {
+				return fmt.Errorf("found %q, expected NULL or DEFAULT", lit)
+			}
+		case tok == IDENT && strings.ToUpper(lit) == "CASCADE":
+			action = ForeignActionCascade
+		case tok == IDENT && strings.ToUpper(lit) == "RESTRICT":
+			action = ForeignActionRestrict
+		case tok == IDENT && strings.ToUpper(lit) == "NO":
+			if tok, lit = p.scanIgnoreWhitespace(); tok != IDENT || strings.ToUpper(lit) != "ACTION" {
+				return fmt.Errorf("found %q, expected ACTION", lit)
+			}
+			action = ForeignActionNoAction
+		default:
+			return fmt.Errorf("found %q, expected CASCADE, RESTRICT, NO ACTION, SET NULL or SET DEFAULT", lit)
+		}
+
+		if isDelete {
+			cstr.OnDelete = action
+		} else {
+			cstr.OnUpdate = action
+		}
+	}
+}
+
+// parseDefault parses the value after DEFAULT and stores it in the constraint,
+// returns true if the default is NULL
+func (p *Parser) parseDefault(cstr *Constraint) (bool, error) {
+	var value string
+
+	tok, lit := p.scanIgnoreWhitespace()
+	switch tok {
+	case NULL:
+		return true, nil
+	case NUMBER, TEXT, TRUE, FALSE:
+		value = lit
+	case MINUS:
+		// negative number
+		if tok, lit = p.scanIgnoreWhitespace(); tok != NUMBER {
+			return false, fmt.Errorf("found %q, expected number", lit)
+		}
+		value = "-" + lit
+	case IDENT:
+		// function, e.g. now()
+		if tok, _ := p.scanIgnoreWhitespace(); tok == LEFTPAR {
+			if tok, lit := p.scanIgnoreWhitespace(); tok != RIGHTPAR {
+				return false, fmt.Errorf("found %q, expected )", lit)
+			}
+			fn := strings.ToLower(lit) + "()"
+			if defaultFunc(fn, cstr.Type) == nil {
+				return false, ErrInvalidDefault
+			}
+			cstr.UseDefaultData = true
+			if cstr.Type == ColumnTypeTime {
+				cstr.DefaultDataTime = fn
+			} else {
+				cstr.DefaultDataUUID = fn
+			}
+			return false, nil
+		}
+		return false, fmt.Errorf("found %q, expected default value", lit)
+	default:
+		return false, fmt.Errorf("found %q, expected default value", lit)
+	}
+
+	// check value is valid for the column type
+	column := &Column{Type: cstr.Type}
+	err := parseValue(column, value)
+	if err != nil {
+		return false, err
+	}
+
+	cstr.UseDefaultData = true
+	switch cstr.Type {
+	case ColumnTypeBool:
+		cstr.DefaultDataBool = column.DataBool
+	case ColumnTypeInt:
+		cstr.DefaultDataInt = column.DataInt
+	case ColumnTypeFloat:
+		cstr.DefaultDataFloat = column.DataFloat
+	case ColumnTypeString:
+		cstr.DefaultDataString = column.DataString
+	case ColumnTypeTime:
+		cstr.DefaultDataTime = value
+	case ColumnTypeBytes:
+		cstr.DefaultDataBytes = column.DataBytes
+	case ColumnTypeUUID:
+		cstr.DefaultDataUUID = value
+	}
+
+	return false, nil
+}
+
+// checkForeignKey checks the referenced table and columns of foreign key, cstrs are constraints
+// of the foreign key columns, columns of the referenced table primary key are used when not given
+func (db *Database) checkForeignKey(table *Table, cstrs []*Constraint) error {
+	// can reference itself
+	ftable := table
+	if cstrs[0].ForeignTable != table.Name {
+		_, ftable = db.findTable(cstrs[0].ForeignTable)
+		if ftable == nil {
+			return ErrTableNotExist
+		}
+	}
+
+	if cstrs[0].ForeignColumn == "" {
+		pks := ftable.primaryKey()
+		if len(pks) != len(cstrs) {
+			return ErrInvalidForeignKey
+		}
+		for i, cstr := range cstrs {
+			cstr.ForeignColumn = pks[i]
+		}
+	}
+
+	fcols := map[string]bool{}
+	for _, cstr := range cstrs {
+		fcol := ftable.findColumn(cstr.ForeignColumn)
+		if fcol == nil {
+			return ErrColumnNotExist
+		}
+		if fcol.Type != table.findColumn(cstr.ColumnName).Type {
+			return ErrValueTypeNotMatch
+		}
+		fcols[cstr.ForeignColumn] = true
+	}
+
+	// referenced columns must be all the columns of primary key or unique constraint,
+	// not only some columns of composite key
+	for _, idx := range ftable.allIndexes() {
+		if !idx.isPrimary && !idx.isConstraint || len(idx.Columns) != len(fcols) {
+			continue
+		}
+		match := true
+		for _, col := range idx.Columns {
+			match = match && fcols[col]
+		}
+		if match {
+			return nil
+		}
+	}
+	return ErrInvalidForeignKey
+}
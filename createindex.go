@@ -0,0 +1,109 @@
+package furydb
+
+import (
+	"database/sql/driver"
+	"fmt"
+)
+
+// IndexCreateStatement represents a SQL CREATE INDEX statement.
+type IndexCreateStatement struct {
+	IndexName string
+	TableName string
+	Columns   []string // indexed columns in order
+	IsUnique  bool
+}
+
+// execIndexCreate executes a SQL CREATE INDEX statement
+func (c *FuryConn) execIndexCreate(stmt *IndexCreateStatement, args []driver.Value) (*results, error) {
+	res := &results{}
+
+	// sanity check index not already exists
+	if _, idx := c.db.findIndex(stmt.IndexName); idx != nil {
+		return nil, ErrIndexExist
+	}
+	_, table := c.db.findTable(stmt.TableName)
+	if table == nil {
+		return nil, ErrTableNotExist
+	}
+	for i, colName := range stmt.Columns {
+		if table.findColumn(colName) == nil {
+			return nil, ErrColumnNotExist
+		}
+		for _, other := range stmt.Columns[:i] {
+			if other == colName {
+				return nil, ErrColumnExist
+			}
+		}
+	}
+
+	idx := &Index{
+		Name:     stmt.IndexName,
+		Columns:  stmt.Columns,
+		IsUnique: stmt.IsUnique,
+	}
+	table.Indexes = append(table.Indexes, idx)
+
+	// index is filled with existing rows
+	_, err := c.db.openIndex(table, idx)
+	if err == nil {
+		err = c.db.Save()
+	}
+	if err != nil {
+		// dont keep index that is not persisted
+		table.Indexes = table.Indexes[:len(table.Indexes)-1]
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// parseIndexCreate parses a SQL CREATE INDEX statement
+func (p *Parser) parseIndexCreate() (*IndexCreateStatement, error) {
+	stmt := &IndexCreateStatement{}
+
+	// "CREATE" keyword is read by parseCreate, we may see the "UNIQUE" keyword.
+	tok, lit := p.scanIgnoreWhitespace()
+	if tok == UNIQUE {
+		stmt.IsUnique = true
+		tok, lit = p.scanIgnoreWhitespace()
+	}
+
+	// Next we should see the "INDEX" keyword.
+	if tok != INDEX {
+		return nil, fmt.Errorf("found %q, expected INDEX", lit)
+	}
+
+	// Next we should read the index name.
+	tok, lit = p.scanIgnoreWhitespace()
+	if tok != IDENT {
+		return nil, fmt.Errorf("found %q, expected index_name", lit)
+	}
+	stmt.IndexName = lit
+
+	// Next we should see the "ON" keyword.
+	if tok, lit := p.scanIgnoreWhitespace(); tok != ON {
+		return nil, fmt.Errorf("found %q, expected ON", lit)
+	}
+
+	// Next we should read the table name.
+	tok, lit = p.scanIgnoreWhitespace()
+	if tok != IDENT {
+		return nil, fmt.Errorf("found %q, expected table_name", lit)
+	}
+	stmt.TableName = lit
+
+	// indexed columns
+	var err error
+	stmt.Columns, err = p.parseIdentList()
+	if err != nil {
+		return nil, err
+	}
+
+	// statement may end with ;
+	if err = p.scanEnd(); err != nil {
+		return nil, err
+	}
+
+	// Return the successfully parsed statement.
+	return stmt, nil
+}
@@ -1,9 +1,105 @@
 package furydb
 
-import "fmt"
+import (
+	"database/sql/driver"
+	"fmt"
+)
 
-// queryDelete executes a SQL DELETE statement
-func (c *FuryConn) queryDelete(query string) (*results, error) {
+// execDelete executes a SQL DELETE statement
+func (c *FuryConn) execDelete(stmt *DeleteStatement, args []driver.Value) (*results, error) {
+	var err error
 	res := &results{}
-	return res, fmt.Errorf("not implemented")
+
+	// sanity check find if table exists
+	_, table := c.db.findTable(stmt.TableName)
+	if table == nil {
+		return nil, ErrTableNotExist
+	}
+	res.tableSchema = table
+
+	if stmt.Where != nil {
+		err = stmt.Where.bind(c.db.tableScope(table))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, col := range table.Columns {
+		res.columns = append(res.columns, col.Name)
+	}
+
+	rows, err := c.db.scanRows(table, res.columns, stmt.Where, args)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		// foreign key action of earlier row can change or remove the row
+		row, err = c.db.reloadRow(table, row)
+		if err != nil {
+			return nil, err
+		}
+		ok, err := matchRow(row, stmt.Where, args)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+
+		err = c.db.deleteRow(table, row.id, row)
+		if err != nil {
+			return nil, err
+		}
+		res.rows = append(res.rows, row)
+	}
+
+	return res, nil
+}
+
+// DeleteStatement represents a SQL DELETE statement.
+type DeleteStatement struct {
+	TableName string
+	Where     Expr // condition rows must match, nil matches all
+}
+
+// parseDelete parses a SQL DELETE statement
+func (p *Parser) parseDelete() (*DeleteStatement, error) {
+	var err error
+	stmt := &DeleteStatement{}
+
+	// First token should be a "DELETE" keyword.
+	if tok, lit := p.scanIgnoreWhitespace(); tok != DELETE {
+		return nil, fmt.Errorf("found %q, expected DELETE", lit)
+	}
+
+	// Next we should see the "FROM" keyword.
+	if tok, lit := p.scanIgnoreWhitespace(); tok != FROM {
+		return nil, fmt.Errorf("found %q, expected FROM", lit)
+	}
+
+	// Next we should read the table name.
+	tok, lit := p.scanIgnoreWhitespace()
+	if tok != IDENT {
+		return nil, fmt.Errorf("found %q, expected table name", lit)
+	}
+	stmt.TableName = lit
+
+	// optional WHERE condition
+	if tok, _ = p.scanIgnoreWhitespace(); tok == WHERE {
+		stmt.Where, err = p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		p.unscan()
+	}
+
+	// statement may end with ;
+	if err = p.scanEnd(); err != nil {
+		return nil, err
+	}
+
+	// Return the successfully parsed statement.
+	return stmt, nil
 }
@@ -5,16 +5,22 @@ import (
 	"database/sql/driver"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 )
 
 // FuryDriver sql driver
 type FuryDriver struct {
+	mu  sync.Mutex
+	dbs map[string]*Database // opened databases, shared by connections of same folder
 }
 
 // FuryConn sql connection
 type FuryConn struct {
-	db *Database
+	driver *FuryDriver
+	db     *Database
+	inTx   bool // explicit transaction is running, connection holds database lock
 }
 
 func init() {
@@ -24,84 +30,176 @@ func init() {
 
 // Open database
 func (d *FuryDriver) Open(folderPath string) (driver.Conn, error) {
-	filePath := folderPath + "/schema"
-
-	// file not exist -> new
-	_, err := os.Stat(filePath)
-	if err != nil && os.IsNotExist(err) {
-
-	} else if err != nil {
-		return nil, err
-	}
-
-	// load file
-	db, err := Load(folderPath)
+	absPath, err := filepath.Abs(folderPath)
 	if err != nil {
 		return nil, err
 	}
 
-	return &FuryConn{db: db}, nil
-}
+	d.mu.Lock()
+	defer d.mu.Unlock()
 
-// Query the database
-func (c *FuryConn) Query(query string, args []driver.Value) (driver.Rows, error) {
-	var err error
-	var res *results
+	// reuse already opened database, so all connections see same schema
+	if db, ok := d.dbs[absPath]; ok {
+		db.conns++
+		return &FuryConn{driver: d, db: db}, nil
+	}
 
-	str := strings.ToUpper(strings.TrimSpace(query))
-	if strings.HasPrefix(str, "INSERT") {
-		res, err = c.queryInsert(query)
-		if err != nil {
-			return nil, err
-		}
-		return res, nil
+	var db *Database
+	filePath := folderPath + "/schema"
 
-	} else if strings.HasPrefix(str, "SELECT") {
-		res, err = c.querySelect(query)
+	// file not exist -> new
+	_, err = os.Stat(filePath)
+	if err != nil && os.IsNotExist(err) {
+		db, err = Create(folderPath, filepath.Base(absPath))
 		if err != nil {
 			return nil, err
 		}
-		return res, nil
-
-	} else if strings.HasPrefix(str, "UPDATE") {
-		res, err = c.queryUpdate(query)
+		err = db.Save()
 		if err != nil {
 			return nil, err
 		}
-		return res, nil
 
-	} else if strings.HasPrefix(str, "DELETE") {
-		res, err = c.queryDelete(query)
+	} else if err != nil {
+		return nil, err
+
+	} else {
+		// load file
+		db, err = Load(folderPath)
 		if err != nil {
 			return nil, err
 		}
-		return res, nil
+	}
+
+	if d.dbs == nil {
+		d.dbs = map[string]*Database{}
+	}
+	d.dbs[absPath] = db
+	db.conns++
+
+	return &FuryConn{driver: d, db: db}, nil
+}
+
+// prepare parses the query into statements
+func (c *FuryConn) prepare(query string) (*FuryStmt, error) {
+	parser := NewParser(strings.NewReader(query))
+	stmts, err := parser.parseStatements()
+	if err != nil {
+		return nil, err
+	}
+	return &FuryStmt{
+		conn:       c,
+		statements: stmts,
+		numInput:   parser.numInput,
+	}, nil
+}
+
+// exec executes a parsed SQL statement
+func (c *FuryConn) exec(stmt Statement, args []driver.Value) (*results, error) {
+	switch stmt := stmt.(type) {
+	case *TableCreateStatement:
+		return c.execTableCreate(stmt, args)
+	case *InsertStatement:
+		return c.execInsert(stmt, args)
+	case *SelectStatement:
+		return c.execSelect(stmt, args)
+	case *UpdateStatement:
+		return c.execUpdate(stmt, args)
+	case *DeleteStatement:
+		return c.execDelete(stmt, args)
+	case *IndexCreateStatement:
+		return c.execIndexCreate(stmt, args)
+	case *IndexDropStatement:
+		return c.execIndexDrop(stmt, args)
 	}
 
 	return nil, fmt.Errorf("unsupported query")
 }
 
-// Begin implements driver.Tx interface, not implemented
-func (c *FuryConn) Begin() (_ driver.Tx, err error) {
-	return c, fmt.Errorf("Begin method not implemented")
+// Query implements driver.Queryer interface
+func (c *FuryConn) Query(query string, args []driver.Value) (driver.Rows, error) {
+	stmt, err := c.prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	return stmt.Query(args)
+}
+
+// Exec implements driver.Execer interface
+func (c *FuryConn) Exec(query string, args []driver.Value) (driver.Result, error) {
+	stmt, err := c.prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	return stmt.Exec(args)
 }
 
-// Commit implements driver.Tx interface, not implemented
+// Begin implements driver.Conn interface, connection holds database lock until commit or rollback
+func (c *FuryConn) Begin() (driver.Tx, error) {
+	if c.inTx {
+		return nil, ErrTransactionExist
+	}
+	err := c.db.lock()
+	if err != nil {
+		return nil, err
+	}
+	err = c.db.begin()
+	if err != nil {
+		c.db.unlock()
+		return nil, err
+	}
+	c.inTx = true
+	return c, nil
+}
+
+// Commit implements driver.Tx interface
 func (c *FuryConn) Commit() error {
-	return fmt.Errorf("Commit method not implemented")
+	if !c.inTx {
+		return ErrTransactionNotExist
+	}
+	c.inTx = false
+	defer c.db.unlock()
+
+	return c.db.commit()
 }
 
-// Rollback implements driver.Tx interface, not implemented
+// Rollback implements driver.Tx interface
 func (c *FuryConn) Rollback() error {
-	return fmt.Errorf("Rollback method not implemented")
+	if !c.inTx {
+		return ErrTransactionNotExist
+	}
+	c.inTx = false
+	defer c.db.unlock()
+
+	return c.db.rollback()
 }
 
-// Prepare implements driver.Conn interface, not implemented
+// Prepare implements driver.Conn interface
 func (c *FuryConn) Prepare(query string) (driver.Stmt, error) {
-	return nil, fmt.Errorf("Prepare method not implemented")
+	return c.prepare(query)
 }
 
-// Close implements driver.Conn interface, not implemented
+// Close implements driver.Conn interface
 func (c *FuryConn) Close() error {
-	return nil
+	// unfinished transaction is thrown away
+	if c.inTx {
+		err := c.Rollback()
+		if err != nil {
+			return err
+		}
+	}
+
+	c.driver.mu.Lock()
+	defer c.driver.mu.Unlock()
+
+	// last connection closes the database
+	c.db.conns--
+	if c.db.conns > 0 {
+		return nil
+	}
+	for k, db := range c.driver.dbs {
+		if db == c.db {
+			delete(c.driver.dbs, k)
+		}
+	}
+	return c.db.Close()
 }
@@ -0,0 +1,69 @@
+package furydb
+
+import (
+	"database/sql/driver"
+	"fmt"
+)
+
+// IndexDropStatement represents a SQL DROP INDEX statement.
+type IndexDropStatement struct {
+	IndexName string
+}
+
+// execIndexDrop executes a SQL DROP INDEX statement
+func (c *FuryConn) execIndexDrop(stmt *IndexDropStatement, args []driver.Value) (*results, error) {
+	res := &results{}
+
+	table, idx := c.db.findIndex(stmt.IndexName)
+	if idx == nil {
+		return nil, ErrIndexNotExist
+	}
+
+	indexes := table.Indexes
+	table.Indexes = []*Index{}
+	for _, other := range indexes {
+		if other != idx {
+			table.Indexes = append(table.Indexes, other)
+		}
+	}
+	err := c.db.Save()
+	if err == nil {
+		err = c.db.removeFile(indexPath(table, idx))
+	}
+	if err != nil {
+		table.Indexes = indexes
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// parseIndexDrop parses a SQL DROP INDEX statement
+func (p *Parser) parseIndexDrop() (*IndexDropStatement, error) {
+	stmt := &IndexDropStatement{}
+
+	// First token should be a "DROP" keyword.
+	if tok, lit := p.scanIgnoreWhitespace(); tok != DROP {
+		return nil, fmt.Errorf("found %q, expected DROP", lit)
+	}
+
+	// Next we should see the "INDEX" keyword.
+	if tok, lit := p.scanIgnoreWhitespace(); tok != INDEX {
+		return nil, fmt.Errorf("found %q, expected INDEX", lit)
+	}
+
+	// Next we should read the index name.
+	tok, lit := p.scanIgnoreWhitespace()
+	if tok != IDENT {
+		return nil, fmt.Errorf("found %q, expected index_name", lit)
+	}
+	stmt.IndexName = lit
+
+	// statement may end with ;
+	if err := p.scanEnd(); err != nil {
+		return nil, err
+	}
+
+	// Return the successfully parsed statement.
+	return stmt, nil
+}
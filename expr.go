@@ -0,0 +1,957 @@
+package furydb
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Expr is a node of expression tree, e.g. a = 1 AND (b > 2 OR c <> 'x')
+type Expr interface {
+	// String returns the expression in sql form
+	String() string
+	// bind resolves column references of the expression to the columns of FROM tables
+	bind(s *scope) error
+	// eval evaluates the expression against the row, returned column must not be modified
+	eval(ctx *evalContext) (*Column, error)
+}
+
+// evalContext holds what expression is evaluated against
+type evalContext struct {
+	row  *Row           // current row
+	args []driver.Value // values of placeholders
+	aggs []*Column      // aggregate values of current group, nil if not grouped
+}
+
+// scope is tables of FROM that column references are resolved against,
+// row evaluated has columns of all the tables one after another
+type scope struct {
+	db      *Database
+	sources []*source
+	parent  *scope // scope of query the subquery is in, nil if not subquery
+
+	correlated bool // column of parent scope is used
+	row        *Row // row being evaluated, for column used by subquery
+}
+
+// source is table of FROM
+type source struct {
+	name     string // alias, or table name if not given
+	table    *Table
+	offset   int          // position of first column of the table in row
+	nullable bool         // columns can be null for row not found, by outer join
+	query    *selectQuery // rows of derived table, nil if stored table
+}
+
+// tableScope gives scope of single table
+func (db *Database) tableScope(table *Table) *scope {
+	return &scope{db: db, sources: []*source{{name: table.Name, table: table}}}
+}
+
+// add adds table to the end of scope, name must not be used by other table
+func (s *scope) add(name string, table *Table) (*source, error) {
+	for _, src := range s.sources {
+		if src.name == name {
+			return nil, ErrTableNameNotUnique
+		}
+	}
+	src := &source{name: name, table: table, offset: s.width()}
+	s.sources = append(s.sources, src)
+	return src, nil
+}
+
+// width gives number of columns in row
+func (s *scope) width() int {
+	if len(s.sources) == 0 {
+		return 0
+	}
+	last := s.sources[len(s.sources)-1]
+	return last.offset + len(last.table.Columns)
+}
+
+// resolve gives position of column in row, table name is optional if column name is unique
+func (s *scope) resolve(tableName, name string) (int, error) {
+	index := -1
+	for _, src := range s.sources {
+		if tableName != "" && tableName != src.name {
+			continue
+		}
+		for i, col := range src.table.Columns {
+			if col.Name != name {
+				continue
+			}
+			if index >= 0 {
+				return 0, ErrColumnAmbiguous
+			}
+			index = src.offset + i
+		}
+	}
+	if index < 0 {
+		return 0, ErrColumnNotExist
+	}
+	return index, nil
+}
+
+// sourceOf gives table that column at the position of row belongs to
+func (s *scope) sourceOf(index int) *source {
+	for _, src := range s.sources {
+		if index >= src.offset && index < src.offset+len(src.table.Columns) {
+			return src
+		}
+	}
+	return nil
+}
+
+// OperatorType for where comparision
+type OperatorType int
+
+// types of comparisions
+const (
+	OperatorTypeLessThan OperatorType = iota
+	OperatorTypeLessThanOrEqual
+	OperatorTypeMoreThan
+	OperatorTypeMoreThanOrEqual
+	OperatorTypeEqual
+	OperatorTypeNotEqual
+	OperatorTypeAnd
+	OperatorTypeOr
+	OperatorTypeAdd
+	OperatorTypeSubtract
+	OperatorTypeMultiply
+	OperatorTypeDivide
+	OperatorTypeModulo
+	OperatorTypeConcat
+)
+
+// operators in sql form
+var operatorStrings = map[OperatorType]string{
+	OperatorTypeLessThan:        "<",
+	OperatorTypeLessThanOrEqual: "<=",
+	OperatorTypeMoreThan:        ">",
+	OperatorTypeMoreThanOrEqual: ">=",
+	OperatorTypeEqual:           "=",
+	OperatorTypeNotEqual:        "<>",
+	OperatorTypeAnd:             "AND",
+	OperatorTypeOr:              "OR",
+	OperatorTypeAdd:             "+",
+	OperatorTypeSubtract:        "-",
+	OperatorTypeMultiply:        "*",
+	OperatorTypeDivide:          "/",
+	OperatorTypeModulo:          "%",
+	OperatorTypeConcat:          "||",
+}
+
+// arithmetic operators by token
+var arithmeticOperators = map[Token]OperatorType{
+	PLUS:     OperatorTypeAdd,
+	MINUS:    OperatorTypeSubtract,
+	ASTERISK: OperatorTypeMultiply,
+	SLASH:    OperatorTypeDivide,
+	PERCENT:  OperatorTypeModulo,
+}
+
+// comparison operators by token
+var tokenOperators = map[Token]OperatorType{
+	LT:  OperatorTypeLessThan,
+	LTE: OperatorTypeLessThanOrEqual,
+	GT:  OperatorTypeMoreThan,
+	GTE: OperatorTypeMoreThanOrEqual,
+	EQ:  OperatorTypeEqual,
+	NEQ: OperatorTypeNotEqual,
+}
+
+// ColumnRef is a reference to table column, e.g. name or users.name
+type ColumnRef struct {
+	Table string // table the column is qualified by, empty if not qualified
+	Name  string
+	index int    // position of the column in table and row
+	outer *scope // scope of outer query the column is of, nil if of own query
+}
+
+// String implements Expr
+func (e *ColumnRef) String() string {
+	if e.Table != "" {
+		return e.Table + "." + e.Name
+	}
+	return e.Name
+}
+
+func (e *ColumnRef) bind(s *scope) error {
+	// column not in subquery tables can be of outer query
+	e.outer = nil
+	index, err := s.resolve(e.Table, e.Name)
+	for outer := s; err == ErrColumnNotExist && outer.parent != nil; {
+		outer.correlated = true
+		outer = outer.parent
+		index, err = outer.resolve(e.Table, e.Name)
+		e.outer = outer
+	}
+	if err != nil {
+		return err
+	}
+	e.index = index
+	return nil
+}
+
+func (e *ColumnRef) eval(ctx *evalContext) (*Column, error) {
+	if e.outer != nil {
+		if e.outer.row == nil {
+			return &Column{DataIsNull: true}, nil
+		}
+		return e.outer.row.Columns[e.index], nil
+	}
+	return ctx.row.Columns[e.index], nil
+}
+
+// Literal is a constant value, e.g. 1, 1.23, 'bla', true, null
+type Literal struct {
+	Value *Column
+}
+
+// String implements Expr
+func (e *Literal) String() string {
+	return formatValue(e.Value)
+}
+
+func (e *Literal) bind(s *scope) error {
+	return nil
+}
+
+func (e *Literal) eval(ctx *evalContext) (*Column, error) {
+	return e.Value, nil
+}
+
+// Default is DEFAULT keyword used as value of INSERT or UPDATE, it gives default value of the column
+type Default struct{}
+
+// String implements Expr
+func (e *Default) String() string {
+	return "DEFAULT"
+}
+
+func (e *Default) bind(s *scope) error {
+	return nil
+}
+
+func (e *Default) eval(ctx *evalContext) (*Column, error) {
+	// value depends on column, so it is given by evalValues
+	return nil, ErrDefaultNotAllowed
+}
+
+// Param is a placeholder of value given when statement is executed, e.g. ? or $1
+type Param struct {
+	Index int // position of the value, starts from 0
+}
+
+// String implements Expr
+func (e *Param) String() string {
+	return "$" + strconv.Itoa(e.Index+1)
+}
+
+func (e *Param) bind(s *scope) error {
+	return nil
+}
+
+func (e *Param) eval(ctx *evalContext) (*Column, error) {
+	if e.Index >= len(ctx.args) {
+		return nil, ErrArgumentCountNotMatch
+	}
+	return driverValueToColumn(ctx.args[e.Index])
+}
+
+// driverValueToColumn converts value given by database/sql to column
+func driverValueToColumn(value driver.Value) (*Column, error) {
+	switch v := value.(type) {
+	case nil:
+		return &Column{DataIsNull: true}, nil
+	case bool:
+		return &Column{Type: ColumnTypeBool, DataBool: v}, nil
+	case int64:
+		return &Column{Type: ColumnTypeInt, DataInt: v}, nil
+	case float64:
+		return &Column{Type: ColumnTypeFloat, DataFloat: v}, nil
+	case string:
+		return &Column{Type: ColumnTypeString, DataString: v}, nil
+	case time.Time:
+		return &Column{Type: ColumnTypeTime, DataTime: v}, nil
+	case []byte:
+		return &Column{Type: ColumnTypeBytes, DataBytes: v}, nil
+	}
+	return nil, ErrUnknownColumnType
+}
+
+// ListExpr is list of values in parentheses, e.g. (1, 2, 3)
+type ListExpr struct {
+	Items []Expr
+}
+
+// String implements Expr
+func (e *ListExpr) String() string {
+	strs := make([]string, len(e.Items))
+	for i, item := range e.Items {
+		strs[i] = item.String()
+	}
+	return "(" + strings.Join(strs, ", ") + ")"
+}
+
+func (e *ListExpr) bind(s *scope) error {
+	for _, item := range e.Items {
+		err := item.bind(s)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *ListExpr) eval(ctx *evalContext) (*Column, error) {
+	// list is not a value, it is used by what has it
+	return nil, ErrListNotAllowed
+}
+
+// BinaryExpr is an operation with left and right hand side, e.g. a = 1, a AND b
+type BinaryExpr struct {
+	Op  OperatorType
+	LHS Expr
+	RHS Expr
+}
+
+// String implements Expr
+func (e *BinaryExpr) String() string {
+	return fmt.Sprintf("(%s %s %s)", e.LHS.String(), operatorStrings[e.Op], e.RHS.String())
+}
+
+func (e *BinaryExpr) bind(s *scope) error {
+	err := e.LHS.bind(s)
+	if err != nil {
+		return err
+	}
+	return e.RHS.bind(s)
+}
+
+func (e *BinaryExpr) eval(ctx *evalContext) (*Column, error) {
+	lhs, err := e.LHS.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// right side is not evaluated if left side decides AND or OR, e.g. x <> 0 AND 10 / x > 1
+	if e.Op == OperatorTypeAnd || e.Op == OperatorTypeOr {
+		if !lhs.DataIsNull && lhs.Type != ColumnTypeBool {
+			return nil, ErrValueTypeNotBool
+		}
+		if decisive := e.Op == OperatorTypeOr; !lhs.DataIsNull && lhs.DataBool == decisive {
+			return &Column{Type: ColumnTypeBool, DataBool: decisive}, nil
+		}
+	}
+	rhs, err := e.RHS.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	switch e.Op {
+	case OperatorTypeAnd, OperatorTypeOr:
+		return evalLogical(e.Op, lhs, rhs)
+	case OperatorTypeAdd, OperatorTypeSubtract, OperatorTypeMultiply, OperatorTypeDivide, OperatorTypeModulo:
+		return evalArithmetic(e.Op, lhs, rhs)
+	case OperatorTypeConcat:
+		return evalConcat(lhs, rhs)
+	}
+	return evalComparison(e.Op, lhs, rhs)
+}
+
+// evalComparison evaluates comparison of two values, e.g. a < b
+func evalComparison(op OperatorType, lhs, rhs *Column) (*Column, error) {
+	// comparing with null is unknown
+	if lhs.DataIsNull || rhs.DataIsNull {
+		return nullBool(), nil
+	}
+	cmp, err := compareColumns(lhs, rhs)
+	if err != nil {
+		return nil, err
+	}
+
+	var b bool
+	switch op {
+	case OperatorTypeLessThan:
+		b = cmp < 0
+	case OperatorTypeLessThanOrEqual:
+		b = cmp <= 0
+	case OperatorTypeMoreThan:
+		b = cmp > 0
+	case OperatorTypeMoreThanOrEqual:
+		b = cmp >= 0
+	case OperatorTypeEqual:
+		b = cmp == 0
+	case OperatorTypeNotEqual:
+		b = cmp != 0
+	}
+	return &Column{Type: ColumnTypeBool, DataBool: b}, nil
+}
+
+// NotExpr negates boolean expression
+type NotExpr struct {
+	Expr Expr
+}
+
+// String implements Expr
+func (e *NotExpr) String() string {
+	return fmt.Sprintf("(NOT %s)", e.Expr.String())
+}
+
+func (e *NotExpr) bind(s *scope) error {
+	return e.Expr.bind(s)
+}
+
+func (e *NotExpr) eval(ctx *evalContext) (*Column, error) {
+	val, err := e.Expr.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if val.DataIsNull {
+		return nullBool(), nil
+	}
+	if val.Type != ColumnTypeBool {
+		return nil, ErrValueTypeNotBool
+	}
+	return &Column{Type: ColumnTypeBool, DataBool: !val.DataBool}, nil
+}
+
+// evalLogical evaluates AND, OR with three-valued logic, null is unknown
+func evalLogical(op OperatorType, lhs, rhs *Column) (*Column, error) {
+	for _, val := range []*Column{lhs, rhs} {
+		if !val.DataIsNull && val.Type != ColumnTypeBool {
+			return nil, ErrValueTypeNotBool
+		}
+	}
+
+	// false AND x is false, true OR x is true, regardless of unknown
+	decisive := op == OperatorTypeOr
+	if (!lhs.DataIsNull && lhs.DataBool == decisive) || (!rhs.DataIsNull && rhs.DataBool == decisive) {
+		return &Column{Type: ColumnTypeBool, DataBool: decisive}, nil
+	}
+	if lhs.DataIsNull || rhs.DataIsNull {
+		return nullBool(), nil
+	}
+	return &Column{Type: ColumnTypeBool, DataBool: !decisive}, nil
+}
+
+// nullBool is unknown boolean result
+func nullBool() *Column {
+	return &Column{Type: ColumnTypeBool, DataIsNull: true}
+}
+
+// isTrue tells if the expression result is true, null is not true
+func isTrue(val *Column) bool {
+	return val.Type == ColumnTypeBool && !val.DataIsNull && val.DataBool
+}
+
+// coerce converts value to column type, following same rules as insert values,
+// e.g. '2020-01-01T00:00:00Z' string can be used as time
+func coerce(value *Column, typ ColumnType) (*Column, error) {
+	if value.DataIsNull || value.Type == typ {
+		return value, nil
+	}
+	if value.Type == ColumnTypeInt && typ == ColumnTypeFloat {
+		return &Column{Type: typ, DataFloat: float64(value.DataInt)}, nil
+	}
+	if value.Type == ColumnTypeString {
+		column := &Column{Type: typ}
+		err := parseValue(column, value.DataString)
+		if err != nil {
+			return nil, err
+		}
+		return column, nil
+	}
+	return nil, ErrValueTypeNotMatch
+}
+
+// compareColumns compares two non-null values, returns -1 if a < b, 0 if a == b, 1 if a > b
+func compareColumns(a, b *Column) (int, error) {
+	var err error
+
+	// bring both values to same type, string is converted to the other type
+	if a.Type != b.Type {
+		if b.Type == ColumnTypeString || b.Type == ColumnTypeInt && a.Type == ColumnTypeFloat {
+			b, err = coerce(b, a.Type)
+		} else {
+			a, err = coerce(a, b.Type)
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	switch a.Type {
+	case ColumnTypeBool:
+		if a.DataBool == b.DataBool {
+			return 0, nil
+		} else if b.DataBool {
+			return -1, nil
+		}
+		return 1, nil
+	case ColumnTypeInt:
+		if a.DataInt < b.DataInt {
+			return -1, nil
+		} else if a.DataInt > b.DataInt {
+			return 1, nil
+		}
+		return 0, nil
+	case ColumnTypeFloat:
+		if a.DataFloat < b.DataFloat {
+			return -1, nil
+		} else if a.DataFloat > b.DataFloat {
+			return 1, nil
+		}
+		return 0, nil
+	case ColumnTypeString:
+		return strings.Compare(a.DataString, b.DataString), nil
+	case ColumnTypeTime:
+		if a.DataTime.Before(b.DataTime) {
+			return -1, nil
+		} else if a.DataTime.After(b.DataTime) {
+			return 1, nil
+		}
+		return 0, nil
+	case ColumnTypeBytes:
+		return bytes.Compare(a.DataBytes, b.DataBytes), nil
+	case ColumnTypeUUID:
+		return bytes.Compare(a.DataUUID[:], b.DataUUID[:]), nil
+	}
+
+	return 0, ErrUnknownColumnType
+}
+
+// formatValue returns the value in sql form
+func formatValue(val *Column) string {
+	if val.DataIsNull {
+		return "NULL"
+	}
+	switch val.Type {
+	case ColumnTypeBool:
+		return strings.ToUpper(strconv.FormatBool(val.DataBool))
+	case ColumnTypeInt:
+		return strconv.FormatInt(val.DataInt, 10)
+	case ColumnTypeFloat:
+		return strconv.FormatFloat(val.DataFloat, 'g', -1, 64)
+	case ColumnTypeString:
+		return "'" + strings.ReplaceAll(val.DataString, "'", "''") + "'"
+	case ColumnTypeTime:
+		return "'" + val.DataTime.Format(time.RFC3339Nano) + "'"
+	case ColumnTypeBytes:
+		return fmt.Sprintf("'\\x%x'", val.DataBytes)
+	case ColumnTypeUUID:
+		return "'" + UUIDBinToStr(val.DataUUID) + "'"
+	}
+	return "?"
+}
+
+// parseExpr parses an expression, e.g. a = 1 AND (b > 2 OR c <> 'x')
+func (p *Parser) parseExpr() (Expr, error) {
+	return p.parseOr()
+}
+
+// parseOr parses OR expression, OR has the lowest precedence
+func (p *Parser) parseOr() (Expr, error) {
+	lhs, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if tok, _ := p.scanIgnoreWhitespace(); tok != OR {
+			p.unscan()
+			return lhs, nil
+		}
+		rhs, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		lhs = &BinaryExpr{Op: OperatorTypeOr, LHS: lhs, RHS: rhs}
+	}
+}
+
+// parseAnd parses AND expression
+func (p *Parser) parseAnd() (Expr, error) {
+	lhs, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if tok, _ := p.scanIgnoreWhitespace(); tok != AND {
+			p.unscan()
+			return lhs, nil
+		}
+		rhs, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		lhs = &BinaryExpr{Op: OperatorTypeAnd, LHS: lhs, RHS: rhs}
+	}
+}
+
+// parseNot parses NOT expression
+func (p *Parser) parseNot() (Expr, error) {
+	if tok, _ := p.scanIgnoreWhitespace(); tok != NOT {
+		p.unscan()
+		return p.parseComparison()
+	}
+	expr, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	return &NotExpr{Expr: expr}, nil
+}
+
+// parseComparison parses comparison, e.g. a >= 1
+func (p *Parser) parseComparison() (Expr, error) {
+	lhs, err := p.parseConcat()
+	if err != nil {
+		return nil, err
+	}
+	tok, lit := p.scanIgnoreWhitespace()
+	// value followed by predicate, e.g. [NOT] IN, [NOT] LIKE, IS [NOT] NULL
+	not := false
+	if tok == NOT {
+		not = true
+		if tok, lit = p.scanIgnoreWhitespace(); tok != IN && tok != LIKE && tok != ILIKE && tok != BETWEEN {
+			return nil, fmt.Errorf("found %q, expected IN, LIKE, ILIKE or BETWEEN", lit)
+		}
+	}
+	switch tok {
+	case IN:
+		return p.parseIn(lhs, not)
+	case LIKE, ILIKE:
+		return p.parseLike(lhs, not, tok == ILIKE)
+	case BETWEEN:
+		return p.parseBetween(lhs, not)
+	case IS:
+		return p.parseIsNull(lhs)
+	}
+	op, ok := tokenOperators[tok]
+	if !ok {
+		p.unscan()
+		return lhs, nil
+	}
+	rhs, err := p.parseConcat()
+	if err != nil {
+		return nil, err
+	}
+	return &BinaryExpr{Op: op, LHS: lhs, RHS: rhs}, nil
+}
+
+// parseConcat parses string concatenation, e.g. first_name || ' ' || last_name
+func (p *Parser) parseConcat() (Expr, error) {
+	lhs, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if tok, _ := p.scanIgnoreWhitespace(); tok != CONCAT {
+			p.unscan()
+			return lhs, nil
+		}
+		rhs, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		lhs = &BinaryExpr{Op: OperatorTypeConcat, LHS: lhs, RHS: rhs}
+	}
+}
+
+// parseAdditive parses + and -, e.g. price - discount
+func (p *Parser) parseAdditive() (Expr, error) {
+	lhs, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok, _ := p.scanIgnoreWhitespace()
+		if tok != PLUS && tok != MINUS {
+			p.unscan()
+			return lhs, nil
+		}
+		rhs, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		lhs = &BinaryExpr{Op: arithmeticOperators[tok], LHS: lhs, RHS: rhs}
+	}
+}
+
+// parseMultiplicative parses * / and %, e.g. price * qty
+func (p *Parser) parseMultiplicative() (Expr, error) {
+	lhs, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok, _ := p.scanIgnoreWhitespace()
+		if tok != ASTERISK && tok != SLASH && tok != PERCENT {
+			p.unscan()
+			return lhs, nil
+		}
+		rhs, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		lhs = &BinaryExpr{Op: arithmeticOperators[tok], LHS: lhs, RHS: rhs}
+	}
+}
+
+// parseUnary parses sign before value, e.g. -price, - followed by number is negative number
+func (p *Parser) parseUnary() (Expr, error) {
+	tok, _ := p.scanIgnoreWhitespace()
+	switch tok {
+	case PLUS:
+		return p.parseUnary()
+	case MINUS:
+		if tok, lit := p.scanIgnoreWhitespace(); tok == NUMBER {
+			return parseNumber("-" + lit)
+		}
+		p.unscan()
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &NegExpr{Expr: expr}, nil
+	}
+	p.unscan()
+	return p.parsePrimary()
+}
+
+// parseNumber converts number literal to value, int if it has no fraction
+func parseNumber(lit string) (Expr, error) {
+	if num, err := strconv.ParseInt(lit, 10, 64); err == nil {
+		return &Literal{Value: &Column{Type: ColumnTypeInt, DataInt: num}}, nil
+	}
+	num, err := strconv.ParseFloat(lit, 64)
+	if err != nil {
+		return nil, fmt.Errorf("found %q, expected number", lit)
+	}
+	return &Literal{Value: &Column{Type: ColumnTypeFloat, DataFloat: num}}, nil
+}
+
+// parsePrimary parses column, value or expression in parentheses
+func (p *Parser) parsePrimary() (Expr, error) {
+	tok, lit := p.scanIgnoreWhitespace()
+	switch tok {
+	case IDENT:
+		// name followed by ( is function call, followed by . is table name
+		switch tok, _ = p.scanIgnoreWhitespace(); tok {
+		case LEFTPAR:
+			return p.parseCall(lit)
+		case DOT:
+			name, nameLit := p.scanIgnoreWhitespace()
+			if name != IDENT {
+				return nil, fmt.Errorf("found %q, expected column name", nameLit)
+			}
+			return &ColumnRef{Table: lit, Name: nameLit}, nil
+		}
+		p.unscan()
+		return &ColumnRef{Name: lit}, nil
+	case NUMBER:
+		return parseNumber(lit)
+	case TEXT:
+		return &Literal{Value: &Column{Type: ColumnTypeString, DataString: lit}}, nil
+	case TRUE, FALSE:
+		return &Literal{Value: &Column{Type: ColumnTypeBool, DataBool: tok == TRUE}}, nil
+	case NULL:
+		return &Literal{Value: &Column{DataIsNull: true}}, nil
+	case DEFAULT:
+		return &Default{}, nil
+	case PLACEHOLDER:
+		return p.parseParam(lit)
+	case CASE:
+		return p.parseCase()
+	case CAST:
+		return p.parseCast()
+	case EXISTS:
+		if tok, lit = p.scanIgnoreWhitespace(); tok != LEFTPAR {
+			return nil, fmt.Errorf("found %q, expected (", lit)
+		}
+		stmt, err := p.parseSubquery()
+		if err != nil {
+			return nil, err
+		}
+		return &ExistsExpr{Subquery: &Subquery{Select: stmt}}, nil
+	case LEFTPAR:
+		// ( followed by SELECT is subquery
+		if tok, _ = p.scanIgnoreWhitespace(); tok == SELECT {
+			p.unscan()
+			stmt, err := p.parseSubquery()
+			if err != nil {
+				return nil, err
+			}
+			return &Subquery{Select: stmt}, nil
+		}
+		p.unscan()
+		expr, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		// more than one value is list
+		list := &ListExpr{Items: []Expr{expr}}
+		for {
+			if tok, lit = p.scanIgnoreWhitespace(); tok != COMMA {
+				break
+			}
+			expr, err = p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			list.Items = append(list.Items, expr)
+		}
+		if tok != RIGHTPAR {
+			return nil, fmt.Errorf("found %q, expected )", lit)
+		}
+		if len(list.Items) > 1 {
+			return list, nil
+		}
+		return list.Items[0], nil
+	}
+	return nil, fmt.Errorf("found %q, expected expression", lit)
+}
+
+// parseCall parses function call after the opening (, e.g. COUNT(*)
+func (p *Parser) parseCall(name string) (Expr, error) {
+	fn := strings.ToUpper(name)
+	if aggregateFuncs[fn] {
+		return p.parseAggregate(fn, nil)
+	}
+
+	switch fn {
+	case "COALESCE":
+		args, err := p.parseArgs()
+		if err != nil {
+			return nil, err
+		}
+		if len(args) == 0 {
+			return nil, fmt.Errorf("found %q, expected at least one argument", name)
+		}
+		return &CoalesceExpr{Args: args}, nil
+	case "NULLIF":
+		args, err := p.parseArgs()
+		if err != nil {
+			return nil, err
+		}
+		if len(args) != 2 {
+			return nil, fmt.Errorf("found %q, expected two arguments", name)
+		}
+		return &NullIfExpr{LHS: args[0], RHS: args[1]}, nil
+	case "EXTRACT":
+		return p.parseExtract()
+	}
+	sf, udf := lookupFunc(fn)
+	if sf != nil {
+		return p.parseFunc(name, sf)
+	}
+	if udf != nil {
+		return p.parseAggregate(fn, udf)
+	}
+	return nil, fmt.Errorf("found %q, unknown function", name)
+}
+
+// parseArgs parses arguments of function call after the opening (, e.g. a, 'b', 1)
+func (p *Parser) parseArgs() ([]Expr, error) {
+	args := []Expr{}
+	if tok, _ := p.scanIgnoreWhitespace(); tok == RIGHTPAR {
+		return args, nil
+	}
+	p.unscan()
+
+	for {
+		arg, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+
+		tok, lit := p.scanIgnoreWhitespace()
+		if tok == RIGHTPAR {
+			return args, nil
+		}
+		if tok != COMMA {
+			return nil, fmt.Errorf("found %q, expected , or )", lit)
+		}
+	}
+}
+
+// exprChildren gives expressions directly under expression
+func exprChildren(expr Expr) []Expr {
+	switch e := expr.(type) {
+	case *BinaryExpr:
+		return []Expr{e.LHS, e.RHS}
+	case *NotExpr:
+		return []Expr{e.Expr}
+	case *ListExpr:
+		return e.Items
+	case *Aggregate:
+		if e.Arg != nil {
+			return []Expr{e.Arg}
+		}
+	case *ExistsExpr:
+		return []Expr{e.Subquery}
+	case *InExpr:
+		if e.Subquery == nil {
+			return append([]Expr{e.Expr}, e.List...)
+		}
+		return []Expr{e.Expr, e.Subquery}
+	case *LikeExpr:
+		if e.Escape != nil {
+			return []Expr{e.Expr, e.Pattern, e.Escape}
+		}
+		return []Expr{e.Expr, e.Pattern}
+	case *BetweenExpr:
+		return []Expr{e.Expr, e.Low, e.High}
+	case *IsNullExpr:
+		return []Expr{e.Expr}
+	case *NegExpr:
+		return []Expr{e.Expr}
+	case *CaseExpr:
+		children := []Expr{}
+		if e.Value != nil {
+			children = append(children, e.Value)
+		}
+		for _, w := range e.Whens {
+			children = append(children, w.When, w.Then)
+		}
+		if e.Else != nil {
+			children = append(children, e.Else)
+		}
+		return children
+	case *CastExpr:
+		return []Expr{e.Expr}
+	case *CoalesceExpr:
+		return e.Args
+	case *NullIfExpr:
+		return []Expr{e.LHS, e.RHS}
+	case *FuncExpr:
+		return e.Args
+	}
+	return nil
+}
+
+// parseParam parses placeholder, either ? numbered by its position or $1 numbered explicitly,
+// both style cannot be mixed
+func (p *Parser) parseParam(lit string) (Expr, error) {
+	if p.paramStyle != "" && p.paramStyle != lit[:1] {
+		return nil, fmt.Errorf("found %q, cannot mix placeholder style", lit)
+	}
+	p.paramStyle = lit[:1]
+
+	index := p.numInput
+	if lit != "?" {
+		num, err := strconv.Atoi(lit[1:])
+		if err != nil || num < 1 {
+			return nil, fmt.Errorf("found %q, expected placeholder", lit)
+		}
+		index = num - 1
+	}
+	if index >= p.numInput {
+		p.numInput = index + 1
+	}
+
+	return &Param{Index: index}, nil
+}
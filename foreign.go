@@ -0,0 +1,261 @@
+package furydb
+
+// Note:
+// Foreign key is made of constraints with same name, one for each referencing column.
+// Referencing row is checked after it is written, so row can reference itself.
+// Referenced row is handled after it is removed or changed, by the ON DELETE or ON UPDATE action,
+// rows changed by the action are handled the same way, so CASCADE follows the whole chain.
+// Key with null column references nothing and is not checked.
+
+// actions of foreign key when referenced row is deleted or updated
+const (
+	ForeignActionNoAction   = ""            // same as RESTRICT
+	ForeignActionRestrict   = "RESTRICT"    // referenced row cannot be changed
+	ForeignActionCascade    = "CASCADE"     // referencing rows are deleted or updated too
+	ForeignActionSetNull    = "SET NULL"    // referencing columns are set to null
+	ForeignActionSetDefault = "SET DEFAULT" // referencing columns are set to default value
+)
+
+// foreignKey is a foreign key of table, columns in table reference fcolumns in ftable
+type foreignKey struct {
+	name     string
+	table    *Table
+	columns  []string
+	ftable   *Table
+	fcolumns []string
+	onDelete string
+	onUpdate string
+}
+
+// foreignKeys gives all foreign keys of all tables
+func (db *Database) foreignKeys() []*foreignKey {
+	fks := []*foreignKey{}
+	for _, table := range db.Tables {
+		byName := map[string]*foreignKey{}
+		for _, cstr := range table.Constraints {
+			if !cstr.IsForeignKey {
+				continue
+			}
+			fk := byName[cstr.Name]
+			if fk == nil {
+				_, ftable := db.findTable(cstr.ForeignTable)
+				if ftable == nil {
+					continue
+				}
+				fk = &foreignKey{
+					name:     cstr.Name,
+					table:    table,
+					ftable:   ftable,
+					onDelete: cstr.OnDelete,
+					onUpdate: cstr.OnUpdate,
+				}
+				byName[cstr.Name] = fk
+				fks = append(fks, fk)
+			}
+			fk.columns = append(fk.columns, cstr.ColumnName)
+			fk.fcolumns = append(fk.fcolumns, cstr.ForeignColumn)
+		}
+	}
+	return fks
+}
+
+// rowValue gives value of column in row, column missing from the row is null
+func rowValue(row *Row, name string) *Column {
+	for _, col := range row.Columns {
+		if col.Name == name {
+			return col
+		}
+	}
+	return &Column{Name: name, DataIsNull: true}
+}
+
+// keyValues gives values of columns in row, nil if any of them is null
+func keyValues(row *Row, columns []string) []*Column {
+	values := []*Column{}
+	for _, name := range columns {
+		val := rowValue(row, name)
+		if val.DataIsNull {
+			return nil
+		}
+		values = append(values, val)
+	}
+	return values
+}
+
+// sameValues tells if both rows have same values in the columns
+func sameValues(a *Row, b *Row, columns []string) bool {
+	for _, name := range columns {
+		va, vb := rowValue(a, name), rowValue(b, name)
+		if va.DataIsNull || vb.DataIsNull {
+			if va.DataIsNull != vb.DataIsNull {
+				return false
+			}
+			continue
+		}
+		cmp, err := compareColumns(va, vb)
+		if err != nil || cmp != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// findKeyRows gives rows of table that have the values in the columns
+func (db *Database) findKeyRows(table *Table, columns []string, values []*Column) ([]*Row, error) {
+	var where Expr
+	for i, name := range columns {
+		var cond Expr = &BinaryExpr{Op: OperatorTypeEqual, LHS: &ColumnRef{Name: name}, RHS: &Literal{Value: values[i]}}
+		if where != nil {
+			cond = &BinaryExpr{Op: OperatorTypeAnd, LHS: where, RHS: cond}
+		}
+		where = cond
+	}
+	err := where.bind(db.tableScope(table))
+	if err != nil {
+		return nil, err
+	}
+
+	all := []string{}
+	for _, col := range table.Columns {
+		all = append(all, col.Name)
+	}
+	return db.scanRows(table, all, where, nil)
+}
+
+// checkReferences checks rows referenced by foreign keys of table exist,
+// old is row before update, nil for new row
+func (db *Database) checkReferences(table *Table, old *Row, row *Row) error {
+	for _, fk := range db.foreignKeys() {
+		if fk.table != table {
+			continue
+		}
+		if old != nil && sameValues(old, row, fk.columns) {
+			continue
+		}
+		values := keyValues(row, fk.columns)
+		if values == nil {
+			continue
+		}
+		rows, err := db.findKeyRows(fk.ftable, fk.fcolumns, values)
+		if err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			return &ConstraintError{Name: fk.name, Table: table.Name, Err: ErrForeignKeyNotFound}
+		}
+	}
+	return nil
+}
+
+// applyReferences does foreign key action to rows that reference changed row,
+// row is the changed row, nil if old row is deleted
+func (db *Database) applyReferences(table *Table, old *Row, row *Row) error {
+	for _, fk := range db.foreignKeys() {
+		if fk.ftable != table {
+			continue
+		}
+		if row != nil && sameValues(old, row, fk.fcolumns) {
+			continue
+		}
+		values := keyValues(old, fk.fcolumns)
+		if values == nil {
+			continue
+		}
+		refs, err := db.findKeyRows(fk.table, fk.columns, values)
+		if err != nil {
+			return err
+		}
+
+		action := fk.onUpdate
+		if row == nil {
+			action = fk.onDelete
+		}
+		for _, ref := range refs {
+			// earlier action can change or remove the row
+			cur, err := db.reloadRow(fk.table, ref)
+			if err != nil {
+				return err
+			}
+			if cur == nil || !sameValues(cur, ref, fk.columns) {
+				continue
+			}
+			ref = cur
+
+			switch action {
+			case ForeignActionNoAction, ForeignActionRestrict:
+				return &ConstraintError{Name: fk.name, Table: fk.table.Name, Err: ErrForeignKeyReferenced}
+
+			case ForeignActionCascade:
+				if row == nil {
+					err = db.deleteRow(fk.table, ref.id, ref)
+					break
+				}
+				newRef := copyRow(ref)
+				for i, name := range fk.columns {
+					setRowValue(fk.table, newRef, name, rowValue(row, fk.fcolumns[i]))
+				}
+				_, err = db.updateRow(fk.table, ref.id, ref, newRef)
+
+			case ForeignActionSetNull, ForeignActionSetDefault:
+				newRef := copyRow(ref)
+				for _, name := range fk.columns {
+					val := &Column{DataIsNull: true}
+					if action == ForeignActionSetDefault {
+						val, err = fk.table.defaultValue(name)
+						if err != nil {
+							return err
+						}
+					}
+					setRowValue(fk.table, newRef, name, val)
+				}
+				_, err = db.updateRow(fk.table, ref.id, ref, newRef)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// reloadRow reads row again, gives nil if it is no longer stored under its id
+func (db *Database) reloadRow(table *Table, row *Row) (*Row, error) {
+	page, err := db.readPage(heapPath(table), row.id.page)
+	if err != nil {
+		return nil, err
+	}
+	dat := pageGet(page, row.id.slot)
+	if dat == nil {
+		return nil, nil
+	}
+	cur, err := decodeRow(table, dat)
+	if err != nil {
+		return nil, err
+	}
+	cur.id = row.id
+	return cur, nil
+}
+
+// copyRow gives copy of row that can be changed without changing the original
+func copyRow(row *Row) *Row {
+	dup := &Row{
+		TableName: row.TableName,
+		Columns:   make([]*Column, len(row.Columns)),
+		id:        row.id,
+	}
+	copy(dup.Columns, row.Columns)
+	return dup
+}
+
+// setRowValue replaces value of column in row
+func setRowValue(table *Table, row *Row, name string, value *Column) {
+	col := *table.findColumn(name)
+	setData(&col, value)
+	for i, rowCol := range row.Columns {
+		if rowCol.Name == name {
+			row.Columns[i] = &col
+			return
+		}
+	}
+	row.Columns = append(row.Columns, &col)
+}
@@ -0,0 +1,582 @@
+package furydb
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Note:
+// Scalar functions are looked up by name in scalarFuncs when query is parsed, number of arguments
+// is checked then. Argument of known type, column or literal, is checked when query is prepared.
+// When called, every argument is converted to type the function takes, same as in comparison,
+// e.g. '12' can be INT, 1 can be FLOAT, other type gives error.
+// Function gives null if any argument is null, unless it takes null, e.g. CONCAT.
+// Zero argument function giving TIME or UUID can be DEFAULT value, e.g. DEFAULT now().
+
+// argument types beside column types
+const (
+	argAny    ColumnType = 0  // value of any type, given as it is
+	argNumber ColumnType = -1 // int or float, given as it is
+)
+
+// scalarFunc is function that gives one value for values of one row
+type scalarFunc struct {
+	args     []ColumnType // types of arguments
+	optional int          // number of arguments at the end that can be left out
+	variadic bool         // last argument can be repeated
+	takeNull bool         // called with null argument, otherwise null is given
+	ret      ColumnType   // type of value given, argAny or argNumber if it depends on arguments
+	call     func(args []*Column) (*Column, error)
+}
+
+// scalarFuncs are built-in functions by upper case name
+var scalarFuncs = map[string]*scalarFunc{
+	// string
+	"LOWER":       {args: types(ColumnTypeString), ret: ColumnTypeString, call: strFunc(strings.ToLower)},
+	"UPPER":       {args: types(ColumnTypeString), ret: ColumnTypeString, call: strFunc(strings.ToUpper)},
+	"LENGTH":      {args: types(ColumnTypeString), ret: ColumnTypeInt, call: funcLength},
+	"CHAR_LENGTH": {args: types(ColumnTypeString), ret: ColumnTypeInt, call: funcLength},
+	"SUBSTR":      {args: types(ColumnTypeString, ColumnTypeInt, ColumnTypeInt), optional: 1, ret: ColumnTypeString, call: funcSubstr},
+	"SUBSTRING":   {args: types(ColumnTypeString, ColumnTypeInt, ColumnTypeInt), optional: 1, ret: ColumnTypeString, call: funcSubstr},
+	"TRIM":        {args: types(ColumnTypeString, ColumnTypeString), optional: 1, ret: ColumnTypeString, call: trimFunc(strings.Trim)},
+	"LTRIM":       {args: types(ColumnTypeString, ColumnTypeString), optional: 1, ret: ColumnTypeString, call: trimFunc(strings.TrimLeft)},
+	"RTRIM":       {args: types(ColumnTypeString, ColumnTypeString), optional: 1, ret: ColumnTypeString, call: trimFunc(strings.TrimRight)},
+	"REPLACE":     {args: types(ColumnTypeString, ColumnTypeString, ColumnTypeString), ret: ColumnTypeString, call: funcReplace},
+	"REVERSE":     {args: types(ColumnTypeString), ret: ColumnTypeString, call: strFunc(reverse)},
+	"REPEAT":      {args: types(ColumnTypeString, ColumnTypeInt), ret: ColumnTypeString, call: funcRepeat},
+	"STRPOS":      {args: types(ColumnTypeString, ColumnTypeString), ret: ColumnTypeInt, call: funcStrpos},
+	"LPAD":        {args: types(ColumnTypeString, ColumnTypeInt, ColumnTypeString), optional: 1, ret: ColumnTypeString, call: padFunc(true)},
+	"RPAD":        {args: types(ColumnTypeString, ColumnTypeInt, ColumnTypeString), optional: 1, ret: ColumnTypeString, call: padFunc(false)},
+	"CONCAT":      {args: types(argAny), variadic: true, takeNull: true, ret: ColumnTypeString, call: funcConcat},
+	// math
+	"ABS":     {args: types(argNumber), ret: argNumber, call: funcAbs},
+	"SIGN":    {args: types(argNumber), ret: ColumnTypeInt, call: funcSign},
+	"ROUND":   {args: types(argNumber, ColumnTypeInt), optional: 1, ret: argNumber, call: funcRound},
+	"FLOOR":   {args: types(argNumber), ret: argNumber, call: roundFunc(math.Floor)},
+	"CEIL":    {args: types(argNumber), ret: argNumber, call: roundFunc(math.Ceil)},
+	"CEILING": {args: types(argNumber), ret: argNumber, call: roundFunc(math.Ceil)},
+	"MOD":     {args: types(argNumber, argNumber), ret: argNumber, call: funcMod},
+	"SQRT":    {args: types(ColumnTypeFloat), ret: ColumnTypeFloat, call: funcSqrt},
+	"POWER":   {args: types(ColumnTypeFloat, ColumnTypeFloat), ret: ColumnTypeFloat, call: funcPower},
+	"RANDOM":  {ret: ColumnTypeFloat, call: funcRandom},
+	// date and time
+	"NOW":        {ret: ColumnTypeTime, call: funcNow},
+	"DATE_TRUNC": {args: types(ColumnTypeString, ColumnTypeTime), ret: ColumnTypeTime, call: funcDateTrunc},
+	"DATE_PART":  {args: types(ColumnTypeString, ColumnTypeTime), ret: ColumnTypeInt, call: funcDatePart},
+	"DATE_ADD":   {args: types(ColumnTypeTime, ColumnTypeInt, ColumnTypeString), ret: ColumnTypeTime, call: funcDateAdd},
+	// uuid
+	"GEN_RANDOM_UUID": {ret: ColumnTypeUUID, call: funcGenUUID},
+	"GEN_UUID_V4":     {ret: ColumnTypeUUID, call: funcGenUUID},
+}
+
+// types gives list of argument types
+func types(typs ...ColumnType) []ColumnType {
+	return typs
+}
+
+// checkArgs tells if function can be called with number of arguments
+func (fn *scalarFunc) checkArgs(num int) bool {
+	if num < len(fn.args)-fn.optional {
+		return false
+	}
+	return fn.variadic || num <= len(fn.args)
+}
+
+// argType gives type of argument at position, repeated last argument has type of last argument
+func (fn *scalarFunc) argType(i int) ColumnType {
+	if i >= len(fn.args) {
+		return fn.args[len(fn.args)-1]
+	}
+	return fn.args[i]
+}
+
+// valueTypeErrors are errors of value that is not of type
+var valueTypeErrors = map[ColumnType]error{
+	argNumber:        ErrValueTypeNotNumber,
+	ColumnTypeBool:   ErrValueTypeNotBool,
+	ColumnTypeInt:    ErrValueTypeNotInt,
+	ColumnTypeFloat:  ErrValueTypeNotFloat,
+	ColumnTypeString: ErrValueTypeNotString,
+	ColumnTypeTime:   ErrValueTypeNotTime,
+	ColumnTypeBytes:  ErrValueTypeNotBytes,
+	ColumnTypeUUID:   ErrValueTypeNotUUID,
+}
+
+// convertArg converts argument value to type function takes
+func convertArg(val *Column, typ ColumnType) (*Column, error) {
+	switch {
+	case val.DataIsNull || typ == argAny:
+		return val, nil
+	case typ == argNumber && val.Type == ColumnTypeString:
+		// int if it has no fraction
+		if arg, err := coerce(val, ColumnTypeInt); err == nil {
+			return arg, nil
+		}
+		arg, err := coerce(val, ColumnTypeFloat)
+		if err != nil {
+			return nil, ErrValueTypeNotNumber
+		}
+		return arg, nil
+	case typ == argNumber:
+		if !isNumber(val) {
+			return nil, ErrValueTypeNotNumber
+		}
+		return val, nil
+	}
+	arg, err := coerce(val, typ)
+	if err == ErrValueTypeNotMatch {
+		return nil, valueTypeErrors[typ]
+	}
+	return arg, err
+}
+
+// checkArgType checks that value of type can be argument of type,
+// string is checked when it is converted
+func checkArgType(from, typ ColumnType) error {
+	switch {
+	case from == 0 || from == ColumnTypeString || typ == argAny || from == typ:
+		return nil
+	case typ == argNumber && (from == ColumnTypeInt || from == ColumnTypeFloat):
+		return nil
+	case typ == ColumnTypeFloat && from == ColumnTypeInt:
+		return nil
+	}
+	return valueTypeErrors[typ]
+}
+
+// staticType gives type of expression known before it is evaluated, 0 if not known
+func staticType(expr Expr, s *scope) ColumnType {
+	switch e := expr.(type) {
+	case *Literal:
+		return e.Value.Type
+	case *ColumnRef:
+		if e.outer != nil {
+			return e.outer.column(e.index).Type
+		}
+		return s.column(e.index).Type
+	}
+	return 0
+}
+
+// FuncExpr is scalar function call, e.g. LOWER(name)
+type FuncExpr struct {
+	Name string // upper case
+	Args []Expr
+	fn   *scalarFunc
+}
+
+// String implements Expr
+func (e *FuncExpr) String() string {
+	if len(e.Args) == 0 {
+		return e.Name + "()"
+	}
+	return e.Name + (&ListExpr{Items: e.Args}).String()
+}
+
+func (e *FuncExpr) bind(s *scope) error {
+	for i, arg := range e.Args {
+		err := arg.bind(s)
+		if err != nil {
+			return err
+		}
+		err = checkArgType(staticType(arg, s), e.fn.argType(i))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *FuncExpr) eval(ctx *evalContext) (*Column, error) {
+	args := make([]*Column, len(e.Args))
+	for i, arg := range e.Args {
+		val, err := arg.eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if val.DataIsNull && !e.fn.takeNull {
+			return &Column{Type: e.fn.ret, DataIsNull: true}, nil
+		}
+		args[i], err = convertArg(val, e.fn.argType(i))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return e.fn.call(args)
+}
+
+// parseFunc parses arguments of scalar function after the opening (, e.g. name, 1, 3)
+func (p *Parser) parseFunc(name string, fn *scalarFunc) (Expr, error) {
+	args, err := p.parseArgs()
+	if err != nil {
+		return nil, err
+	}
+	if !fn.checkArgs(len(args)) {
+		return nil, fmt.Errorf("found %q, wrong number of arguments", name)
+	}
+	return &FuncExpr{Name: strings.ToUpper(name), Args: args, fn: fn}, nil
+}
+
+// parseExtract parses EXTRACT after the opening (, e.g. YEAR FROM created), it is DATE_PART
+func (p *Parser) parseExtract() (Expr, error) {
+	tok, lit := p.scanIgnoreWhitespace()
+	if tok != IDENT {
+		return nil, fmt.Errorf("found %q, expected date part", lit)
+	}
+	field := &Literal{Value: &Column{Type: ColumnTypeString, DataString: strings.ToLower(lit)}}
+	if tok, lit = p.scanIgnoreWhitespace(); tok != FROM {
+		return nil, fmt.Errorf("found %q, expected FROM", lit)
+	}
+	value, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if tok, lit = p.scanIgnoreWhitespace(); tok != RIGHTPAR {
+		return nil, fmt.Errorf("found %q, expected )", lit)
+	}
+	return &FuncExpr{Name: "DATE_PART", Args: []Expr{field, value}, fn: scalarFuncs["DATE_PART"]}, nil
+}
+
+// strFunc makes function of string that gives string
+func strFunc(fn func(string) string) func(args []*Column) (*Column, error) {
+	return func(args []*Column) (*Column, error) {
+		return &Column{Type: ColumnTypeString, DataString: fn(args[0].DataString)}, nil
+	}
+}
+
+// funcLength gives number of characters
+func funcLength(args []*Column) (*Column, error) {
+	return &Column{Type: ColumnTypeInt, DataInt: int64(utf8.RuneCountInString(args[0].DataString))}, nil
+}
+
+// funcSubstr gives characters from position, first is 1, optionally only given number of them
+func funcSubstr(args []*Column) (*Column, error) {
+	runes := []rune(args[0].DataString)
+	from, to := args[1].DataInt, int64(len(runes))+1
+	if len(args) > 2 {
+		if args[2].DataInt < 0 {
+			return nil, ErrInvalidArgument
+		}
+		if end := from + args[2].DataInt; end < to && end >= from {
+			to = end
+		}
+	}
+	if from < 1 {
+		from = 1
+	}
+	if from >= to {
+		return &Column{Type: ColumnTypeString}, nil
+	}
+	return &Column{Type: ColumnTypeString, DataString: string(runes[from-1 : to-1])}, nil
+}
+
+// trimFunc makes function that removes characters, space if not given, from string
+func trimFunc(fn func(string, string) string) func(args []*Column) (*Column, error) {
+	return func(args []*Column) (*Column, error) {
+		cutset := " "
+		if len(args) > 1 {
+			cutset = args[1].DataString
+		}
+		return &Column{Type: ColumnTypeString, DataString: fn(args[0].DataString, cutset)}, nil
+	}
+}
+
+// funcReplace replaces every occurrence of text in string
+func funcReplace(args []*Column) (*Column, error) {
+	if args[1].DataString == "" {
+		return args[0], nil
+	}
+	return &Column{Type: ColumnTypeString, DataString: strings.ReplaceAll(args[0].DataString, args[1].DataString, args[2].DataString)}, nil
+}
+
+// reverse gives characters in reverse order
+func reverse(s string) string {
+	runes := []rune(s)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return string(runes)
+}
+
+// funcRepeat gives string repeated number of times
+func funcRepeat(args []*Column) (*Column, error) {
+	count := args[1].DataInt
+	if count < 0 {
+		count = 0
+	}
+	if count > 0 && int64(len(args[0].DataString))*count > maxRowSize {
+		return nil, ErrDataTooBig
+	}
+	return &Column{Type: ColumnTypeString, DataString: strings.Repeat(args[0].DataString, int(count))}, nil
+}
+
+// funcStrpos gives position of first character of text in string, 0 if not found
+func funcStrpos(args []*Column) (*Column, error) {
+	pos := int64(0)
+	if i := strings.Index(args[0].DataString, args[1].DataString); i >= 0 {
+		pos = int64(utf8.RuneCountInString(args[0].DataString[:i])) + 1
+	}
+	return &Column{Type: ColumnTypeInt, DataInt: pos}, nil
+}
+
+// padFunc makes function that fills string to length with fill characters, space if not given,
+// longer string is cut to length
+func padFunc(left bool) func(args []*Column) (*Column, error) {
+	return func(args []*Column) (*Column, error) {
+		runes := []rune(args[0].DataString)
+		length := args[1].DataInt
+		if length < 0 {
+			length = 0
+		}
+		if length > maxRowSize {
+			return nil, ErrDataTooBig
+		}
+		fill := []rune(" ")
+		if len(args) > 2 {
+			fill = []rune(args[2].DataString)
+		}
+		if int64(len(runes)) >= length || len(fill) == 0 {
+			if int64(len(runes)) > length {
+				runes = runes[:length]
+			}
+			return &Column{Type: ColumnTypeString, DataString: string(runes)}, nil
+		}
+
+		pad := make([]rune, 0, length-int64(len(runes)))
+		for i := 0; int64(len(pad)) < length-int64(len(runes)); i++ {
+			pad = append(pad, fill[i%len(fill)])
+		}
+		if left {
+			return &Column{Type: ColumnTypeString, DataString: string(pad) + string(runes)}, nil
+		}
+		return &Column{Type: ColumnTypeString, DataString: string(runes) + string(pad)}, nil
+	}
+}
+
+// funcConcat joins values as strings, null is left out
+func funcConcat(args []*Column) (*Column, error) {
+	var b strings.Builder
+	for _, arg := range args {
+		if arg.DataIsNull {
+			continue
+		}
+		str, err := castValue(arg, ColumnTypeString)
+		if err != nil {
+			return nil, err
+		}
+		b.WriteString(str.DataString)
+	}
+	return &Column{Type: ColumnTypeString, DataString: b.String()}, nil
+}
+
+// funcAbs gives absolute value
+func funcAbs(args []*Column) (*Column, error) {
+	if args[0].Type == ColumnTypeFloat {
+		return &Column{Type: ColumnTypeFloat, DataFloat: math.Abs(args[0].DataFloat)}, nil
+	}
+	if args[0].DataInt >= 0 {
+		return args[0], nil
+	}
+	return evalArithmetic(OperatorTypeSubtract, &Column{Type: ColumnTypeInt}, args[0])
+}
+
+// funcSign gives -1, 0 or 1 by sign of number
+func funcSign(args []*Column) (*Column, error) {
+	num := args[0].DataFloat
+	if args[0].Type == ColumnTypeInt {
+		num = float64(args[0].DataInt)
+	}
+	sign := int64(0)
+	if num > 0 {
+		sign = 1
+	} else if num < 0 {
+		sign = -1
+	}
+	return &Column{Type: ColumnTypeInt, DataInt: sign}, nil
+}
+
+// funcRound rounds number half away from zero, to number of decimal places if given,
+// negative places round to tens, hundreds and so on
+func funcRound(args []*Column) (*Column, error) {
+	places := int64(0)
+	if len(args) > 1 {
+		places = args[1].DataInt
+	}
+	if places > 15 || places < -18 {
+		return nil, ErrInvalidArgument
+	}
+	if args[0].Type == ColumnTypeFloat {
+		scale := math.Pow(10, float64(places))
+		return &Column{Type: ColumnTypeFloat, DataFloat: math.Round(args[0].DataFloat*scale) / scale}, nil
+	}
+	if places >= 0 {
+		return args[0], nil
+	}
+	// int is rounded without going through float
+	unit := int64(1)
+	for i := places; i < 0; i++ {
+		unit *= 10
+	}
+	num := args[0].DataInt
+	rem := num % unit
+	num -= rem
+	if rem >= unit/2 {
+		return evalArithmetic(OperatorTypeAdd, &Column{Type: ColumnTypeInt, DataInt: num}, &Column{Type: ColumnTypeInt, DataInt: unit})
+	} else if rem <= -unit/2 {
+		return evalArithmetic(OperatorTypeSubtract, &Column{Type: ColumnTypeInt, DataInt: num}, &Column{Type: ColumnTypeInt, DataInt: unit})
+	}
+	return &Column{Type: ColumnTypeInt, DataInt: num}, nil
+}
+
+// roundFunc makes function that rounds float, int is given as it is
+func roundFunc(fn func(float64) float64) func(args []*Column) (*Column, error) {
+	return func(args []*Column) (*Column, error) {
+		if args[0].Type == ColumnTypeInt {
+			return args[0], nil
+		}
+		return &Column{Type: ColumnTypeFloat, DataFloat: fn(args[0].DataFloat)}, nil
+	}
+}
+
+// funcMod gives remainder of division, same as %
+func funcMod(args []*Column) (*Column, error) {
+	return evalArithmetic(OperatorTypeModulo, args[0], args[1])
+}
+
+// funcSqrt gives square root
+func funcSqrt(args []*Column) (*Column, error) {
+	if args[0].DataFloat < 0 {
+		return nil, ErrInvalidArgument
+	}
+	return &Column{Type: ColumnTypeFloat, DataFloat: math.Sqrt(args[0].DataFloat)}, nil
+}
+
+// funcPower gives number raised to power
+func funcPower(args []*Column) (*Column, error) {
+	num := math.Pow(args[0].DataFloat, args[1].DataFloat)
+	if math.IsNaN(num) || math.IsInf(num, 0) {
+		return nil, ErrInvalidArgument
+	}
+	return &Column{Type: ColumnTypeFloat, DataFloat: num}, nil
+}
+
+// funcRandom gives random number from 0 up to 1
+func funcRandom(args []*Column) (*Column, error) {
+	return &Column{Type: ColumnTypeFloat, DataFloat: rand.Float64()}, nil
+}
+
+// funcNow gives current time
+func funcNow(args []*Column) (*Column, error) {
+	return &Column{Type: ColumnTypeTime, DataTime: time.Now()}, nil
+}
+
+// funcDateTrunc cuts time down to start of unit, e.g. DATE_TRUNC('month', created)
+func funcDateTrunc(args []*Column) (*Column, error) {
+	t := args[1].DataTime
+	y, m, d := t.Date()
+	loc := t.Location()
+	switch strings.ToLower(args[0].DataString) {
+	case "second":
+		t = t.Truncate(time.Second)
+	case "minute":
+		t = time.Date(y, m, d, t.Hour(), t.Minute(), 0, 0, loc)
+	case "hour":
+		t = time.Date(y, m, d, t.Hour(), 0, 0, 0, loc)
+	case "day":
+		t = time.Date(y, m, d, 0, 0, 0, 0, loc)
+	case "week":
+		// week starts on monday
+		t = time.Date(y, m, d-(int(t.Weekday())+6)%7, 0, 0, 0, 0, loc)
+	case "month":
+		t = time.Date(y, m, 1, 0, 0, 0, 0, loc)
+	case "quarter":
+		t = time.Date(y, m-(m-1)%3, 1, 0, 0, 0, 0, loc)
+	case "year":
+		t = time.Date(y, 1, 1, 0, 0, 0, 0, loc)
+	default:
+		return nil, ErrInvalidArgument
+	}
+	return &Column{Type: ColumnTypeTime, DataTime: t}, nil
+}
+
+// funcDatePart gives part of time as number, e.g. DATE_PART('year', created)
+func funcDatePart(args []*Column) (*Column, error) {
+	t := args[1].DataTime
+	var num int
+	switch strings.ToLower(args[0].DataString) {
+	case "millisecond":
+		num = t.Second()*1000 + t.Nanosecond()/1e6
+	case "second":
+		num = t.Second()
+	case "minute":
+		num = t.Minute()
+	case "hour":
+		num = t.Hour()
+	case "day":
+		num = t.Day()
+	case "dow":
+		// sunday is 0
+		num = int(t.Weekday())
+	case "doy":
+		num = t.YearDay()
+	case "week":
+		_, num = t.ISOWeek()
+	case "month":
+		num = int(t.Month())
+	case "quarter":
+		num = (int(t.Month())-1)/3 + 1
+	case "year":
+		num = t.Year()
+	case "epoch":
+		return &Column{Type: ColumnTypeInt, DataInt: t.Unix()}, nil
+	default:
+		return nil, ErrInvalidArgument
+	}
+	return &Column{Type: ColumnTypeInt, DataInt: int64(num)}, nil
+}
+
+// funcDateAdd adds number of units to time, e.g. DATE_ADD(created, 3, 'day')
+func funcDateAdd(args []*Column) (*Column, error) {
+	t := args[0].DataTime
+	num := args[1].DataInt
+	unit := strings.ToLower(args[2].DataString)
+	var dur time.Duration
+	switch unit {
+	case "millisecond":
+		dur = time.Millisecond
+	case "second":
+		dur = time.Second
+	case "minute":
+		dur = time.Minute
+	case "hour":
+		dur = time.Hour
+	case "day":
+		return &Column{Type: ColumnTypeTime, DataTime: t.AddDate(0, 0, int(num))}, nil
+	case "week":
+		return &Column{Type: ColumnTypeTime, DataTime: t.AddDate(0, 0, int(num)*7)}, nil
+	case "month":
+		return &Column{Type: ColumnTypeTime, DataTime: t.AddDate(0, int(num), 0)}, nil
+	case "year":
+		return &Column{Type: ColumnTypeTime, DataTime: t.AddDate(int(num), 0, 0)}, nil
+	default:
+		return nil, ErrInvalidArgument
+	}
+	if num > math.MaxInt64/int64(dur) || num < math.MinInt64/int64(dur) {
+		return nil, ErrIntegerOverflow
+	}
+	return &Column{Type: ColumnTypeTime, DataTime: t.Add(time.Duration(num) * dur)}, nil
+}
+
+// funcGenUUID gives random uuid v4
+func funcGenUUID(args []*Column) (*Column, error) {
+	uid, err := UUIDNewV4()
+	if err != nil {
+		return nil, err
+	}
+	column := &Column{Type: ColumnTypeUUID}
+	return column, parseValue(column, uid)
+}
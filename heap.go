@@ -0,0 +1,362 @@
+package furydb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"path"
+)
+
+// Note:
+// Table rows are kept in heap file <table>/heap made of slotted pages.
+// Page layout
+//   [0:2] number of slots
+//   [2:4] start of row data, rows are added from end of page towards the slots
+//   [4:]  slots, 4 bytes each, row offset and row length. offset 0 is empty slot
+// Row is found by page number and slot, slot of row does not change while row is on the page.
+// Free space map <table>/fsm remembers free bytes of every page, so insert does not need to read
+// all the pages to find space. It is made of pages of 2 byte entries, entry is free bytes + 1 and
+// 0 is not known yet, then the heap page is read and its entry is fixed. Change of entry writes
+// only the map page of the entry.
+
+const (
+	pageHeaderSize = 4
+	slotSize       = 4
+	maxRowSize     = pageSize - pageHeaderSize - slotSize // largest row that fits in page
+	fsmEntries     = pageSize / 2                         // heap pages in one page of free space map
+)
+
+// rowID points to row in heap file
+type rowID struct {
+	page int64
+	slot int
+}
+
+// String shows row id as page:slot
+func (id rowID) String() string {
+	return fmt.Sprintf("%d:%d", id.page, id.slot)
+}
+
+// newPage gives empty page
+func newPage() []byte {
+	page := make([]byte, pageSize)
+	binary.LittleEndian.PutUint16(page[2:], pageSize)
+	return page
+}
+
+// pageNumSlots gives number of slots in page
+func pageNumSlots(page []byte) int {
+	return int(binary.LittleEndian.Uint16(page[0:]))
+}
+
+// pageSlot gives row offset and length of slot
+func pageSlot(page []byte, slot int) (int, int) {
+	pos := pageHeaderSize + slot*slotSize
+	return int(binary.LittleEndian.Uint16(page[pos:])), int(binary.LittleEndian.Uint16(page[pos+2:]))
+}
+
+// pageSetSlot sets row offset and length of slot
+func pageSetSlot(page []byte, slot int, offset int, length int) {
+	pos := pageHeaderSize + slot*slotSize
+	binary.LittleEndian.PutUint16(page[pos:], uint16(offset))
+	binary.LittleEndian.PutUint16(page[pos+2:], uint16(length))
+}
+
+// pageFreeTotal gives free bytes of page, including holes left by removed rows
+func pageFreeTotal(page []byte) int {
+	num := pageNumSlots(page)
+	used := 0
+	for i := 0; i < num; i++ {
+		_, length := pageSlot(page, i)
+		used += length
+	}
+	return pageSize - pageHeaderSize - num*slotSize - used
+}
+
+// pageFree gives largest row that can be added to page
+func pageFree(page []byte) int {
+	free := pageFreeTotal(page)
+	// new row needs a slot, unless there is empty one
+	for i := 0; i < pageNumSlots(page); i++ {
+		if offset, _ := pageSlot(page, i); offset == 0 {
+			return free
+		}
+	}
+	if free < slotSize {
+		return 0
+	}
+	return free - slotSize
+}
+
+// pageGet gives row data of slot, nil if slot is empty
+func pageGet(page []byte, slot int) []byte {
+	if slot < 0 || slot >= pageNumSlots(page) {
+		return nil
+	}
+	offset, length := pageSlot(page, slot)
+	if offset == 0 {
+		return nil
+	}
+	return page[offset : offset+length]
+}
+
+// pageInsert adds row to page, false if row does not fit
+func pageInsert(page []byte, dat []byte) (int, bool) {
+	if len(dat) > pageFree(page) {
+		return 0, false
+	}
+
+	// reuse empty slot
+	num := pageNumSlots(page)
+	slot := num
+	for i := 0; i < num; i++ {
+		if offset, _ := pageSlot(page, i); offset == 0 {
+			slot = i
+			break
+		}
+	}
+	if slot == num {
+		num++
+		binary.LittleEndian.PutUint16(page[0:], uint16(num))
+		pageSetSlot(page, slot, 0, 0)
+	}
+
+	pagePlace(page, slot, dat)
+	return slot, true
+}
+
+// pagePlace puts row data at end of free space, page must have enough free space
+func pagePlace(page []byte, slot int, dat []byte) {
+	start := int(binary.LittleEndian.Uint16(page[2:]))
+	if start-len(dat) < pageHeaderSize+pageNumSlots(page)*slotSize {
+		pageCompact(page)
+		start = int(binary.LittleEndian.Uint16(page[2:]))
+	}
+	start -= len(dat)
+	copy(page[start:], dat)
+	binary.LittleEndian.PutUint16(page[2:], uint16(start))
+	pageSetSlot(page, slot, start, len(dat))
+}
+
+// pageUpdate replaces row data of slot, false if row does not fit
+func pageUpdate(page []byte, slot int, dat []byte) bool {
+	offset, length := pageSlot(page, slot)
+	if len(dat) <= length {
+		copy(page[offset:], dat)
+		pageSetSlot(page, slot, offset, len(dat))
+		return true
+	}
+	if len(dat) > pageFreeTotal(page)+length {
+		return false
+	}
+	pageSetSlot(page, slot, 0, 0)
+	pagePlace(page, slot, dat)
+	return true
+}
+
+// pageRemove removes row of slot
+func pageRemove(page []byte, slot int) {
+	pageSetSlot(page, slot, 0, 0)
+
+	// drop trailing empty slots
+	num := pageNumSlots(page)
+	for num > 0 {
+		if offset, _ := pageSlot(page, num-1); offset != 0 {
+			break
+		}
+		num--
+	}
+	binary.LittleEndian.PutUint16(page[0:], uint16(num))
+	if num == 0 {
+		binary.LittleEndian.PutUint16(page[2:], pageSize)
+	}
+}
+
+// pageCompact moves rows to end of page, so holes become one free space
+func pageCompact(page []byte) {
+	num := pageNumSlots(page)
+	rows := make([][]byte, num)
+	for i := 0; i < num; i++ {
+		if dat := pageGet(page, i); dat != nil {
+			rows[i] = append([]byte{}, dat...)
+		}
+	}
+	start := pageSize
+	for i, dat := range rows {
+		if dat == nil {
+			continue
+		}
+		start -= len(dat)
+		copy(page[start:], dat)
+		pageSetSlot(page, i, start, len(dat))
+	}
+	binary.LittleEndian.PutUint16(page[2:], uint16(start))
+}
+
+// heapPath gives path of table heap file
+func heapPath(table *Table) string {
+	return path.Join(table.Name, "heap")
+}
+
+// fsmPath gives path of table free space map
+func fsmPath(table *Table) string {
+	return path.Join(table.Name, "fsm")
+}
+
+// readFSMPage gives page of free space map, empty page if map does not have it yet
+func (db *Database) readFSMPage(table *Table, num int64) ([]byte, error) {
+	n, err := db.numPages(fsmPath(table))
+	if err != nil {
+		return nil, err
+	}
+	if num >= n {
+		return make([]byte, pageSize), nil
+	}
+	return db.readPage(fsmPath(table), num)
+}
+
+// fsmEntry gives free bytes of heap page from page of free space map, -1 if it is not known
+func fsmEntry(fsmPage []byte, num int64) int {
+	return int(binary.LittleEndian.Uint16(fsmPage[num%fsmEntries*2:])) - 1
+}
+
+// setFSM sets free bytes of heap page in free space map, only the map page of the entry is written
+func (db *Database) setFSM(table *Table, num int64, free int) error {
+	fsmPage, err := db.readFSMPage(table, num/fsmEntries)
+	if err != nil {
+		return err
+	}
+	if fsmEntry(fsmPage, num) == free {
+		return nil
+	}
+	binary.LittleEndian.PutUint16(fsmPage[num%fsmEntries*2:], uint16(free+1))
+	return db.writePage(fsmPath(table), num/fsmEntries, fsmPage)
+}
+
+// heapInsert adds row data to table heap
+func (db *Database) heapInsert(table *Table, dat []byte) (rowID, error) {
+	if len(dat) > maxRowSize {
+		return rowID{}, ErrDataTooBig
+	}
+	num, err := db.numPages(heapPath(table))
+	if err != nil {
+		return rowID{}, err
+	}
+
+	var fsmPage []byte
+	for i := int64(0); i < num; i++ {
+		if i%fsmEntries == 0 {
+			fsmPage, err = db.readFSMPage(table, i/fsmEntries)
+			if err != nil {
+				return rowID{}, err
+			}
+		}
+		if free := fsmEntry(fsmPage, i); free >= 0 && free < len(dat) {
+			continue
+		}
+		page, err := db.readPage(heapPath(table), i)
+		if err != nil {
+			return rowID{}, err
+		}
+		slot, ok := pageInsert(page, dat)
+		if !ok {
+			// map was wrong or did not know the page, fix it
+			err = db.setFSM(table, i, pageFree(page))
+			if err != nil {
+				return rowID{}, err
+			}
+			continue
+		}
+		err = db.writePage(heapPath(table), i, page)
+		if err != nil {
+			return rowID{}, err
+		}
+		return rowID{i, slot}, db.setFSM(table, i, pageFree(page))
+	}
+
+	// no page with enough space, add new page
+	page := newPage()
+	slot, _ := pageInsert(page, dat)
+	err = db.writePage(heapPath(table), num, page)
+	if err != nil {
+		return rowID{}, err
+	}
+	return rowID{num, slot}, db.setFSM(table, num, pageFree(page))
+}
+
+// heapUpdate replaces row data in table heap, row is moved if it no longer fits in its page
+func (db *Database) heapUpdate(table *Table, id rowID, dat []byte) (rowID, error) {
+	if len(dat) > maxRowSize {
+		return rowID{}, ErrDataTooBig
+	}
+	page, err := db.readPage(heapPath(table), id.page)
+	if err != nil {
+		return rowID{}, err
+	}
+	if pageGet(page, id.slot) == nil {
+		return rowID{}, fmt.Errorf("row %s not found", id)
+	}
+	if !pageUpdate(page, id.slot, dat) {
+		err = db.heapRemove(table, id)
+		if err != nil {
+			return rowID{}, err
+		}
+		return db.heapInsert(table, dat)
+	}
+	err = db.writePage(heapPath(table), id.page, page)
+	if err != nil {
+		return rowID{}, err
+	}
+	return id, db.setFSM(table, id.page, pageFree(page))
+}
+
+// heapRemove removes row from table heap
+func (db *Database) heapRemove(table *Table, id rowID) error {
+	page, err := db.readPage(heapPath(table), id.page)
+	if err != nil {
+		return err
+	}
+	pageRemove(page, id.slot)
+	err = db.writePage(heapPath(table), id.page, page)
+	if err != nil {
+		return err
+	}
+	return db.setFSM(table, id.page, pageFree(page))
+}
+
+// heapGet gives row data of row id
+func (db *Database) heapGet(table *Table, id rowID) ([]byte, error) {
+	page, err := db.readPage(heapPath(table), id.page)
+	if err != nil {
+		return nil, err
+	}
+	dat := pageGet(page, id.slot)
+	if dat == nil {
+		return nil, fmt.Errorf("row %s not found", id)
+	}
+	return dat, nil
+}
+
+// heapScan calls fn for every row in table heap, in page order
+func (db *Database) heapScan(table *Table, fn func(id rowID, dat []byte) error) error {
+	num, err := db.numPages(heapPath(table))
+	if err != nil {
+		return err
+	}
+	for i := int64(0); i < num; i++ {
+		page, err := db.readPage(heapPath(table), i)
+		if err != nil {
+			return err
+		}
+		for slot := 0; slot < pageNumSlots(page); slot++ {
+			dat := pageGet(page, slot)
+			if dat == nil {
+				continue
+			}
+			err = fn(rowID{i, slot}, dat)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,507 @@
+package furydb
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/binary"
+	"fmt"
+	"path"
+)
+
+// Note:
+// Table index is B+tree in <table>/index-<name>, table with primary key also has index <table>/pk.
+// Index key is the indexed columns encoded with encodeKey, followed by row id,
+// so row is found without reading the heap.
+// Rows of WHERE that limits first column of an index, e.g. id = 1 or id > 1 AND id <= 5,
+// are taken from the index, the WHERE is still checked against every row.
+// LIKE 'abc%' limits string column to keys starting with encoded abc, without the end of value.
+
+// keyRange is range of first index column
+type keyRange struct {
+	from        []byte // nil is unbounded
+	to          []byte // nil is unbounded
+	fromExclude bool
+	toExclude   bool
+	toPrefix    bool // to is start of keys, not whole value
+}
+
+// primaryKey gives primary key columns of table in order
+func (t *Table) primaryKey() []string {
+	cols := []string{}
+	for _, cstr := range t.Constraints {
+		if cstr.IsPrimaryKey {
+			cols = append(cols, cstr.ColumnName)
+		}
+	}
+	return cols
+}
+
+// allIndexes gives indexes of table, including indexes of primary key and unique constraints
+func (t *Table) allIndexes() []*Index {
+	indexes := []*Index{}
+	if pk := t.primaryKey(); len(pk) > 0 {
+		indexes = append(indexes, &Index{Name: t.primaryKeyName(), Columns: pk, IsUnique: true, isPrimary: true})
+	}
+
+	// columns of same constraint name make one key
+	for _, cstr := range t.Constraints {
+		if !cstr.IsUnique || cstr.IsPrimaryKey {
+			continue
+		}
+		var idx *Index
+		for _, other := range indexes {
+			if other.isConstraint && other.Name == cstr.Name {
+				idx = other
+			}
+		}
+		if idx == nil {
+			idx = &Index{Name: cstr.Name, IsUnique: true, isConstraint: true}
+			indexes = append(indexes, idx)
+		}
+		idx.Columns = append(idx.Columns, cstr.ColumnName)
+	}
+
+	return append(indexes, t.Indexes...)
+}
+
+// primaryKeyName gives name of primary key constraint
+func (t *Table) primaryKeyName() string {
+	for _, cstr := range t.Constraints {
+		if cstr.IsPrimaryKey {
+			return cstr.Name
+		}
+	}
+	return ""
+}
+
+// findIndex gives table and index by index name
+func (db *Database) findIndex(name string) (*Table, *Index) {
+	for _, table := range db.Tables {
+		for _, idx := range table.Indexes {
+			if idx.Name == name {
+				return table, idx
+			}
+		}
+	}
+	return nil, nil
+}
+
+// indexPath gives path of index file
+func indexPath(table *Table, idx *Index) string {
+	if idx.isPrimary {
+		return path.Join(table.Name, "pk")
+	}
+	if idx.isConstraint {
+		return path.Join(table.Name, "unique-"+idx.Name)
+	}
+	return path.Join(table.Name, "index-"+idx.Name)
+}
+
+// openIndex gives B+tree of index, it is built from the rows if it does not exist yet
+func (db *Database) openIndex(table *Table, idx *Index) (*btree, error) {
+	bt := &btree{db: db, path: indexPath(table, idx)}
+
+	num, err := db.numPages(bt.path)
+	if err != nil || num > 0 {
+		return bt, err
+	}
+
+	// table with rows from before index, tree is made by first added row
+	num, err = db.numPages(heapPath(table))
+	if err != nil || num == 0 {
+		return bt, err
+	}
+	if Verbose >= 1 {
+		fmt.Printf("build index %s of %s\n", idx.Name, table.Name)
+	}
+	err = db.heapScan(table, func(id rowID, dat []byte) error {
+		row, err := decodeRow(table, dat)
+		if err != nil {
+			return err
+		}
+		return bt.addRow(table, idx, row, id)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return bt, nil
+}
+
+// addRow adds row to index, unique index gives error if other row has same values
+func (bt *btree) addRow(table *Table, idx *Index, row *Row, id rowID) error {
+	key, err := indexKey(idx.Columns, row, id)
+	if err != nil {
+		return err
+	}
+	// null is never same as other value
+	if idx.IsUnique && !hasNull(idx.Columns, row) {
+		prefix := key[:len(key)-10]
+		duplicate := false
+		err = bt.scan(prefix, func(other []byte) (bool, error) {
+			if !bytes.HasPrefix(other, prefix) {
+				return false, nil
+			}
+			if keyRowID(other) != id {
+				duplicate = true
+				return false, nil
+			}
+			return true, nil
+		})
+		if err != nil {
+			return err
+		}
+		if duplicate {
+			return &ConstraintError{Name: idx.Name, Table: table.Name, Err: ErrDuplicateKey}
+		}
+	}
+	return bt.insert(key)
+}
+
+// removeRow removes row from index
+func (bt *btree) removeRow(idx *Index, row *Row, id rowID) error {
+	key, err := indexKey(idx.Columns, row, id)
+	if err != nil {
+		return err
+	}
+	return bt.remove(key)
+}
+
+// hasNull tells if any of the columns is null in row
+func hasNull(columns []string, row *Row) bool {
+	for _, name := range columns {
+		null := true
+		for _, col := range row.Columns {
+			if col.Name == name && !col.DataIsNull {
+				null = false
+			}
+		}
+		if null {
+			return true
+		}
+	}
+	return false
+}
+
+// indexKey gives index key of row columns, followed by row id
+func indexKey(columns []string, row *Row, id rowID) ([]byte, error) {
+	key := []byte{}
+	for _, name := range columns {
+		var col *Column
+		for _, rowCol := range row.Columns {
+			if rowCol.Name == name {
+				col = rowCol
+				break
+			}
+		}
+		dat, err := encodeKey(col)
+		if err != nil {
+			return nil, err
+		}
+		key = append(key, dat...)
+	}
+
+	tmp := make([]byte, 10)
+	binary.BigEndian.PutUint64(tmp, uint64(id.page))
+	binary.BigEndian.PutUint16(tmp[8:], uint16(id.slot))
+	return append(key, tmp...), nil
+}
+
+// keyRowID gives row id at end of index key
+func keyRowID(key []byte) rowID {
+	tail := key[len(key)-10:]
+	return rowID{
+		page: int64(binary.BigEndian.Uint64(tail)),
+		slot: int(binary.BigEndian.Uint16(tail[8:])),
+	}
+}
+
+// addIndexes adds row to indexes of table
+func (db *Database) addIndexes(table *Table, row *Row, id rowID) error {
+	for _, idx := range table.allIndexes() {
+		bt, err := db.openIndex(table, idx)
+		if err != nil {
+			return err
+		}
+		err = bt.addRow(table, idx, row, id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeIndexes removes row from indexes of table
+func (db *Database) removeIndexes(table *Table, row *Row, id rowID) error {
+	for _, idx := range table.allIndexes() {
+		bt, err := db.openIndex(table, idx)
+		if err != nil {
+			return err
+		}
+		err = bt.removeRow(idx, row, id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// indexScan calls fn with row id of every index key in range
+func (bt *btree) indexScan(kr *keyRange, fn func(id rowID) error) error {
+	return bt.scan(kr.from, func(key []byte) (bool, error) {
+		// encoded values are never prefix of one another,
+		// so key starting with bound has first column equal to bound, or starting with prefix
+		if kr.from != nil && kr.fromExclude && bytes.HasPrefix(key, kr.from) {
+			return true, nil
+		}
+		if kr.to != nil {
+			if bytes.HasPrefix(key, kr.to) {
+				if kr.toExclude {
+					return false, nil
+				}
+			} else if bytes.Compare(key, kr.to) > 0 {
+				return false, nil
+			}
+		}
+		return true, fn(keyRowID(key))
+	})
+}
+
+// indexRange picks index and range of it that rows matching where are in,
+// nil if no index can be used
+func (db *Database) indexRange(table *Table, where Expr, args []driver.Value) (*keyRange, *btree, error) {
+	if where == nil {
+		return nil, nil, nil
+	}
+
+	// equality on unique index is best, then any equality, then any range
+	var best *keyRange
+	var bestIdx *Index
+	bestScore := 0
+	for _, idx := range table.allIndexes() {
+		kr, err := whereRange(table.findColumn(idx.Columns[0]), where, args)
+		if err != nil {
+			return nil, nil, err
+		}
+		if kr == nil {
+			continue
+		}
+		score := 1
+		if kr.isPoint() {
+			score = 2
+			if len(idx.Columns) == 1 && idx.IsUnique {
+				score = 3
+			}
+		}
+		if score > bestScore {
+			best, bestIdx, bestScore = kr, idx, score
+		}
+	}
+	if best == nil {
+		return nil, nil, nil
+	}
+
+	bt, err := db.openIndex(table, bestIdx)
+	if err != nil {
+		return nil, nil, err
+	}
+	return best, bt, nil
+}
+
+// isPoint tells if range is a single value
+func (kr *keyRange) isPoint() bool {
+	return kr.from != nil && kr.to != nil && !kr.fromExclude && !kr.toExclude && !kr.toPrefix &&
+		bytes.Equal(kr.from, kr.to)
+}
+
+// whereRange finds range of column that rows must be in for where to be true,
+// nil if where does not limit the column
+func whereRange(column *Column, where Expr, args []driver.Value) (*keyRange, error) {
+	var kr *keyRange
+	for _, cond := range rangeConds(where) {
+		if like, ok := cond.(*LikeExpr); ok {
+			prefix, err := likeRange(column, like, args)
+			if err != nil {
+				return nil, err
+			}
+			if prefix != nil {
+				if kr == nil {
+					kr = &keyRange{}
+				}
+				kr.setFrom(prefix, false)
+				kr.setToPrefix(prefix)
+			}
+			continue
+		}
+
+		bin, ok := cond.(*BinaryExpr)
+		if !ok || !isComparison(bin.Op) {
+			continue
+		}
+
+		// column compared with value
+		op := bin.Op
+		ref, ok := bin.LHS.(*ColumnRef)
+		value := bin.RHS
+		if !ok {
+			ref, ok = bin.RHS.(*ColumnRef)
+			value = bin.LHS
+			op = flipOperator(op)
+		}
+		if !ok || ref.outer != nil || ref.Name != column.Name || op == OperatorTypeNotEqual {
+			continue
+		}
+		if !isConstant(value) {
+			continue
+		}
+		val, err := value.eval(&evalContext{args: args})
+		if err != nil {
+			return nil, err
+		}
+		val, err = coerce(val, column.Type)
+		if err != nil || val.DataIsNull {
+			// compared as other type, or never true
+			continue
+		}
+		key, err := encodeKey(val)
+		if err != nil {
+			return nil, err
+		}
+
+		if kr == nil {
+			kr = &keyRange{}
+		}
+		switch op {
+		case OperatorTypeEqual:
+			kr.setFrom(key, false)
+			kr.setTo(key, false)
+		case OperatorTypeMoreThan:
+			kr.setFrom(key, true)
+		case OperatorTypeMoreThanOrEqual:
+			kr.setFrom(key, false)
+		case OperatorTypeLessThan:
+			kr.setTo(key, true)
+		case OperatorTypeLessThanOrEqual:
+			kr.setTo(key, false)
+		}
+	}
+
+	// null sorts first but never matches comparison
+	if kr != nil && kr.from == nil {
+		kr.from = []byte{1}
+	}
+	return kr, nil
+}
+
+// rangeConds splits expression joined by AND, BETWEEN is split to >= and <=
+func rangeConds(where Expr) []Expr {
+	conds := []Expr{}
+	for _, cond := range conjuncts(where) {
+		if e, ok := cond.(*BetweenExpr); ok && !e.Not {
+			conds = append(conds,
+				&BinaryExpr{Op: OperatorTypeMoreThanOrEqual, LHS: e.Expr, RHS: e.Low},
+				&BinaryExpr{Op: OperatorTypeLessThanOrEqual, LHS: e.Expr, RHS: e.High})
+			continue
+		}
+		conds = append(conds, cond)
+	}
+	return conds
+}
+
+// isConstant tells if expression has same value for every row,
+// column of outer query is constant while subquery runs
+func isConstant(expr Expr) bool {
+	switch e := expr.(type) {
+	case *Literal, *Param:
+		return true
+	case *ColumnRef:
+		return e.outer != nil
+	}
+	return false
+}
+
+// likeRange gives encoded literal prefix of LIKE pattern if LIKE limits string column, nil if not
+func likeRange(column *Column, like *LikeExpr, args []driver.Value) ([]byte, error) {
+	ref, ok := like.Expr.(*ColumnRef)
+	if !ok || ref.outer != nil || ref.Name != column.Name || column.Type != ColumnTypeString ||
+		like.Not || like.IgnoreCase || !isConstant(like.Pattern) || like.Escape != nil && !isConstant(like.Escape) {
+		return nil, nil
+	}
+	pattern, err := like.compile(&evalContext{args: args})
+	if err != nil || pattern == nil {
+		// error is given again when rows are matched
+		return nil, nil
+	}
+	prefix := likePrefix(pattern)
+	if prefix == "" {
+		return nil, nil
+	}
+	key, err := encodeKey(&Column{Type: ColumnTypeString, DataString: prefix})
+	if err != nil {
+		return nil, err
+	}
+	// without end of value
+	return key[:len(key)-2], nil
+}
+
+// setFrom narrows lower bound
+func (kr *keyRange) setFrom(key []byte, exclude bool) {
+	cmp := bytes.Compare(key, kr.from)
+	if kr.from == nil || cmp > 0 {
+		kr.from, kr.fromExclude = key, exclude
+	} else if cmp == 0 && exclude {
+		kr.fromExclude = true
+	}
+}
+
+// setTo narrows upper bound
+func (kr *keyRange) setTo(key []byte, exclude bool) {
+	cmp := bytes.Compare(key, kr.to)
+	if kr.to == nil || cmp < 0 {
+		kr.to, kr.toExclude, kr.toPrefix = key, exclude, false
+	} else if cmp == 0 && exclude {
+		kr.toExclude = true
+	}
+}
+
+// setToPrefix narrows upper bound to keys starting with prefix
+func (kr *keyRange) setToPrefix(prefix []byte) {
+	if kr.to == nil || bytes.Compare(prefix, kr.to) < 0 {
+		kr.to, kr.toExclude, kr.toPrefix = prefix, false, true
+	}
+}
+
+// conjuncts splits expression joined by AND
+func conjuncts(expr Expr) []Expr {
+	if expr == nil {
+		return nil
+	}
+	if bin, ok := expr.(*BinaryExpr); ok && bin.Op == OperatorTypeAnd {
+		return append(conjuncts(bin.LHS), conjuncts(bin.RHS)...)
+	}
+	return []Expr{expr}
+}
+
+// flipOperator gives operator with sides swapped, e.g. 1 < a is a > 1
+func flipOperator(op OperatorType) OperatorType {
+	switch op {
+	case OperatorTypeLessThan:
+		return OperatorTypeMoreThan
+	case OperatorTypeLessThanOrEqual:
+		return OperatorTypeMoreThanOrEqual
+	case OperatorTypeMoreThan:
+		return OperatorTypeLessThan
+	case OperatorTypeMoreThanOrEqual:
+		return OperatorTypeLessThanOrEqual
+	}
+	return op
+}
+
+// isComparison tells if operator compares two values, e.g. = or <
+func isComparison(op OperatorType) bool {
+	switch op {
+	case OperatorTypeLessThan, OperatorTypeLessThanOrEqual, OperatorTypeMoreThan, OperatorTypeMoreThanOrEqual,
+		OperatorTypeEqual, OperatorTypeNotEqual:
+		return true
+	}
+	return false
+}
@@ -1,23 +1,16 @@
 package furydb
 
 import (
-	"bytes"
-	"encoding/gob"
+	"database/sql/driver"
 	"fmt"
-	"path"
 	"strings"
 )
 
-// queryInsert executes a SQL INSERT statement
-func (c *FuryConn) queryInsert(query string) (*results, error) {
+// execInsert executes a SQL INSERT statement
+func (c *FuryConn) execInsert(stmt *InsertStatement, args []driver.Value) (*results, error) {
+	var err error
 	res := &results{}
 
-	parser := NewParser(strings.NewReader(query))
-	stmt, err := parser.parseInsert()
-	if err != nil {
-		return nil, err
-	}
-
 	// sanity check find if table exists
 	_, table := c.db.findTable(stmt.TableName)
 	if table == nil {
@@ -25,45 +18,53 @@ func (c *FuryConn) queryInsert(query string) (*results, error) {
 	}
 
 	// insert to all fields
+	fields := stmt.Fields
 	if stmt.FieldsAll {
+		fields = nil
 		for _, col := range table.Columns {
-			stmt.Fields = append(stmt.Fields, col.Name)
+			fields = append(fields, col.Name)
 		}
 	}
 
-	// sanity check and get formatted columns values
-	columns, err := sanityCheckQuery(stmt.Fields, stmt.Values, table)
+	// values cannot refer to columns
+	for _, value := range stmt.Values {
+		err = value.bind(&scope{db: c.db})
+		if err != nil {
+			return nil, err
+		}
+	}
+	ctx := &evalContext{args: args}
+	values, err := evalValues(table, fields, stmt.Values, ctx)
 	if err != nil {
 		return nil, err
 	}
-	// todo probably unnecessary
-	// update results
-	res.columns = stmt.Fields
-
-	// find row id or generate one
-	var pkColName string
-	var id string
-	for _, cstr := range table.Constraints {
-		if cstr.IsPrimaryKey {
-			pkColName = cstr.ColumnName
-			break
-		}
+
+	// sanity check and get formatted columns values
+	columns, err := sanityCheckQuery(fields, values, table)
+	if err != nil {
+		return nil, err
 	}
-	if pkColName != "" {
-		for _, col := range columns {
-			if col.Name == pkColName {
-				// todo detect id type and pick correctly, instead of using this shortcut
-				id = UUIDBinToStr(col.DataUUID)
+
+	// omitted columns get their default value
+	for _, col := range table.Columns {
+		omitted := true
+		for _, field := range fields {
+			if field == col.Name {
+				omitted = false
 			}
 		}
-	}
-	if id == "" {
-		// todo detect id type correctly, instead of using this shortcut
-		id, err = UUIDNewV4()
+		if !omitted {
+			continue
+		}
+		val, err := table.defaultValue(col.Name)
 		if err != nil {
 			return nil, err
 		}
+		columns = append(columns, val)
 	}
+	// todo probably unnecessary
+	// update results
+	res.columns = fields
 
 	// convert to row
 	row := &Row{
@@ -73,36 +74,210 @@ func (c *FuryConn) queryInsert(query string) (*results, error) {
 	// update results
 	res.rows = []*Row{row}
 
-	// convert data to bytes
-	buf := bytes.Buffer{}
-	enc := gob.NewEncoder(&buf)
-	err = enc.Encode(row)
+	row.id, err = c.db.insertRow(table, row)
 	if err != nil {
 		return nil, err
 	}
 
-	// todo make system support larger than 8k encoded row
-	if buf.Len() > 8192 {
-		return nil, ErrDataTooBig
+	return res, nil
+}
+
+// evalValues evaluates value of each field, DEFAULT gives default value of the field
+func evalValues(table *Table, fields []string, values []Expr, ctx *evalContext) ([]*Column, error) {
+	columns := []*Column{}
+	for i, value := range values {
+		if _, ok := value.(*Default); ok && i < len(fields) {
+			val, err := table.defaultValue(fields[i])
+			if err != nil {
+				return nil, err
+			}
+			columns = append(columns, val)
+			continue
+		}
+		val, err := value.eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+		columns = append(columns, val)
+	}
+	return columns, nil
+}
+
+// defaultValue gives default value of column, null if column has no default
+func (t *Table) defaultValue(name string) (*Column, error) {
+	col := t.findColumn(name)
+	if col == nil {
+		return nil, ErrColumnNotExist
+	}
+	column := &Column{Name: name, Type: col.Type, DataIsNull: true}
+
+	for _, cstr := range t.Constraints {
+		if cstr.ColumnName != name {
+			continue
+		}
+		text := cstr.defaultText()
+		if !cstr.UseDefaultData && text == "" {
+			continue
+		}
+		column.DataIsNull = false
+
+		switch column.Type {
+		case ColumnTypeBool:
+			column.DataBool = cstr.DefaultDataBool
+		case ColumnTypeInt:
+			column.DataInt = cstr.DefaultDataInt
+		case ColumnTypeFloat:
+			column.DataFloat = cstr.DefaultDataFloat
+		case ColumnTypeString:
+			column.DataString = cstr.DefaultDataString
+		case ColumnTypeBytes:
+			column.DataBytes = cstr.DefaultDataBytes
+		case ColumnTypeTime, ColumnTypeUUID:
+			if fn := defaultFunc(text, column.Type); fn != nil {
+				val, err := fn.call(nil)
+				if err != nil {
+					return nil, err
+				}
+				setData(column, val)
+			} else if err := parseValue(column, text); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// uuid primary key without default is generated, as rows were always given uuid
+	if pk := t.primaryKey(); column.DataIsNull && column.Type == ColumnTypeUUID && len(pk) == 1 && pk[0] == name {
+		val, err := funcGenUUID(nil)
+		if err != nil {
+			return nil, err
+		}
+		setData(column, val)
+	}
+	return column, nil
+}
+
+// defaultText gives default value of time or uuid column in text form, e.g. now(),
+// schema made in go code can have the function in either field
+func (cstr *Constraint) defaultText() string {
+	if cstr.DefaultDataTime != "" {
+		return cstr.DefaultDataTime
+	}
+	return cstr.DefaultDataUUID
+}
+
+// defaultFunc gives function that can be DEFAULT value of column type, e.g. now(), nil if there is none
+func defaultFunc(text string, typ ColumnType) *scalarFunc {
+	// only time and uuid default keeps function
+	if typ != ColumnTypeTime && typ != ColumnTypeUUID || !strings.HasSuffix(text, "()") {
+		return nil
+	}
+	fn, ok := scalarFuncs[strings.ToUpper(strings.TrimSuffix(text, "()"))]
+	if !ok || !fn.checkArgs(0) || fn.ret != typ {
+		return nil
+	}
+	return fn
+}
+
+// notNullConstraint gives constraint that makes column not null, primary key column is always not null
+func (t *Table) notNullConstraint(name string) *Constraint {
+	for _, cstr := range t.Constraints {
+		if cstr.ColumnName == name && (cstr.IsNotNull || cstr.IsPrimaryKey) {
+			return cstr
+		}
+	}
+	return nil
+}
+
+// isNotNull tells if column cannot be null
+func (t *Table) isNotNull(name string) bool {
+	return t.notNullConstraint(name) != nil
+}
+
+// checkNotNull checks row has value in every not null column
+func (t *Table) checkNotNull(row *Row) error {
+	for _, col := range t.Columns {
+		cstr := t.notNullConstraint(col.Name)
+		if cstr != nil && rowValue(row, col.Name).DataIsNull {
+			return &ConstraintError{Name: cstr.Name, Table: t.Name, Err: ErrColumnNotNullable}
+		}
+	}
+	return nil
+}
+
+// insertRow adds row to the table, gives where it is stored
+func (db *Database) insertRow(table *Table, row *Row) (rowID, error) {
+	err := table.checkNotNull(row)
+	if err != nil {
+		return rowID{}, err
+	}
+	dat, err := encodeRow(table, row)
+	if err != nil {
+		return rowID{}, err
 	}
-	// todo make rows in single file instead of individual files
-	filepath := path.Join(c.db.Folderpath, table.Name, id)
 	if Verbose >= 3 {
-		fmt.Printf("writing row data (%d) to %s", buf.Len(), filepath)
+		fmt.Printf("writing row data (%d) to %s\n", len(dat), table.Name)
 	}
-	_, err = writeFile(filepath, row)
+	id, err := db.heapInsert(table, dat)
 	if err != nil {
-		return nil, err
+		return rowID{}, err
+	}
+	err = db.addIndexes(table, row, id)
+	if err != nil {
+		return rowID{}, err
+	}
+	return id, db.checkReferences(table, nil, row)
+}
+
+// updateRow replaces old row stored under id, gives where it is stored now
+func (db *Database) updateRow(table *Table, id rowID, old *Row, row *Row) (rowID, error) {
+	err := table.checkNotNull(row)
+	if err != nil {
+		return rowID{}, err
+	}
+	dat, err := encodeRow(table, row)
+	if err != nil {
+		return rowID{}, err
+	}
+	if Verbose >= 3 {
+		fmt.Printf("writing row data (%d) to %s %s\n", len(dat), table.Name, id)
+	}
+	err = db.removeIndexes(table, old, id)
+	if err != nil {
+		return rowID{}, err
+	}
+	id, err = db.heapUpdate(table, id, dat)
+	if err != nil {
+		return rowID{}, err
+	}
+	err = db.addIndexes(table, row, id)
+	if err != nil {
+		return rowID{}, err
+	}
+	err = db.checkReferences(table, old, row)
+	if err != nil {
+		return rowID{}, err
 	}
+	return id, db.applyReferences(table, old, row)
+}
 
-	return res, nil
+// deleteRow removes row stored under id
+func (db *Database) deleteRow(table *Table, id rowID, row *Row) error {
+	err := db.removeIndexes(table, row, id)
+	if err != nil {
+		return err
+	}
+	err = db.heapRemove(table, id)
+	if err != nil {
+		return err
+	}
+	return db.applyReferences(table, row, nil)
 }
 
 // InsertStatement represents a SQL INSERT statement.
 type InsertStatement struct {
 	FieldsAll bool     // true if using all field(s)
 	Fields    []string // or individual field(s)
-	Values    []string
+	Values    []Expr
 	TableName string
 }
 
@@ -171,26 +346,26 @@ func (p *Parser) parseInsert() (*InsertStatement, error) {
 	// Next we should loop over all our comma-delimited values.
 	for {
 		// Read a value.
-		tok, lit = p.scanValueIgnoreWhitespace()
-		if tok == VALUE {
-			stmt.Values = append(stmt.Values, lit)
+		value, err := p.parseExpr()
+		if err != nil {
+			return nil, err
 		}
+		stmt.Values = append(stmt.Values, value)
 
 		// If the next token is not a comma then break the loop.
-		if tok, _ = p.scanIgnoreWhitespace(); tok != COMMA {
-			// p.unscan()
+		if tok, lit = p.scanIgnoreWhitespace(); tok != COMMA {
 			break
 		}
 	}
 
 	// last token must be )
 	if tok != RIGHTPAR {
-		return nil, fmt.Errorf("found %q, expected )))", lit)
+		return nil, fmt.Errorf("found %q, expected )", lit)
 	}
 
-	// If the next token is not a ; then break the loop.
-	if tok, lit = p.scanValue(); tok != SEMICOL {
-		return nil, fmt.Errorf("found %q, expected ;", lit)
+	// statement may end with ;
+	if err := p.scanEnd(); err != nil {
+		return nil, err
 	}
 
 	// Return the successfully parsed statement.
@@ -0,0 +1,529 @@
+package furydb
+
+import (
+	"database/sql/driver"
+	"fmt"
+)
+
+// Note:
+// Tables of FROM are joined left to right, row of the join has columns of all the tables one after another.
+// Rows of first table are read one by one and passed through every join, so joined rows are not kept in memory.
+// Rows of joined table are found by the first of
+//   index of joined table column that ON compares by = with column of earlier table, looked up for each row
+//   hash of joined table rows by that column, rows are kept in memory
+//   all joined table rows, for CROSS JOIN or ON without such =
+// RIGHT JOIN does not use index, as it has to know which rows of the joined table were never joined.
+// Conditions of WHERE that only use first table are checked as the table is read, so index can be used,
+// unless RIGHT JOIN can make the first table null.
+
+// types of join
+const (
+	JoinInner = "INNER" // rows of both tables that match
+	JoinLeft  = "LEFT"  // and rows of earlier tables that match nothing
+	JoinRight = "RIGHT" // and rows of joined table that match nothing
+	JoinCross = "CROSS" // every row with every row
+)
+
+// Join is table joined to tables before it, e.g. LEFT JOIN orders AS o ON o.user_id = u.id
+type Join struct {
+	Type      string // JoinInner, JoinLeft, JoinRight or JoinCross
+	TableName string
+	Subquery  *SelectStatement // derived table used instead of stored table, e.g. (SELECT ...) AS t
+	Alias     string           // name the table is referred by, empty if by table name
+	On        Expr             // condition joined rows must match, nil for CROSS JOIN
+}
+
+// parseFrom parses tables after FROM, e.g. users u LEFT JOIN orders o ON o.user_id = u.id
+func (p *Parser) parseFrom(stmt *SelectStatement) error {
+	var err error
+	stmt.TableName, stmt.Subquery, stmt.TableAlias, err = p.parseTableRef()
+	if err != nil {
+		return err
+	}
+
+	for {
+		join := &Join{}
+		tok, lit := p.scanIgnoreWhitespace()
+		switch tok {
+		case COMMA:
+			join.Type = JoinCross
+		case JOIN:
+			join.Type = JoinInner
+		case INNER, LEFT, RIGHT, CROSS:
+			join.Type = map[Token]string{INNER: JoinInner, LEFT: JoinLeft, RIGHT: JoinRight, CROSS: JoinCross}[tok]
+			next, nextLit := p.scanIgnoreWhitespace()
+			if next == OUTER && (tok == LEFT || tok == RIGHT) {
+				next, nextLit = p.scanIgnoreWhitespace()
+			}
+			if next != JOIN {
+				return fmt.Errorf("found %q, expected JOIN", nextLit)
+			}
+		default:
+			p.unscan()
+			return nil
+		}
+
+		join.TableName, join.Subquery, join.Alias, err = p.parseTableRef()
+		if err != nil {
+			return err
+		}
+		if join.Type != JoinCross {
+			if tok, lit = p.scanIgnoreWhitespace(); tok != ON {
+				return fmt.Errorf("found %q, expected ON", lit)
+			}
+			join.On, err = p.parseExpr()
+			if err != nil {
+				return err
+			}
+		}
+		stmt.Joins = append(stmt.Joins, join)
+	}
+}
+
+// parseTableRef parses table name or derived table with optional alias, e.g. users AS u,
+// (SELECT id FROM users) u. AS can be left out, derived table must have alias
+func (p *Parser) parseTableRef() (name string, sub *SelectStatement, alias string, err error) {
+	tok, lit := p.scanIgnoreWhitespace()
+	switch tok {
+	case IDENT:
+		name = lit
+	case LEFTPAR:
+		sub, err = p.parseSubquery()
+		if err != nil {
+			return "", nil, "", err
+		}
+	default:
+		return "", nil, "", fmt.Errorf("found %q, expected table name", lit)
+	}
+
+	tok, lit = p.scanIgnoreWhitespace()
+	if tok == AS {
+		if tok, lit = p.scanIgnoreWhitespace(); tok != IDENT {
+			return "", nil, "", fmt.Errorf("found %q, expected alias", lit)
+		}
+	}
+	if tok != IDENT {
+		if sub != nil {
+			return "", nil, "", fmt.Errorf("found %q, expected alias of derived table", lit)
+		}
+		p.unscan()
+		return name, nil, "", nil
+	}
+	return name, sub, lit, nil
+}
+
+// fromScope gives scope of FROM tables of select, ON of joins are resolved against it,
+// parent is scope of outer query for subquery
+func (db *Database) fromScope(stmt *SelectStatement, parent *scope) (*scope, error) {
+	s := &scope{db: db, parent: parent}
+	add := func(tableName string, sub *SelectStatement, alias string) (*source, error) {
+		if sub != nil {
+			// derived table cannot use tables before it, only outer query
+			q, err := db.prepareSelect(sub, parent)
+			if err != nil {
+				return nil, err
+			}
+			src, err := s.add(alias, q.table(alias))
+			if err != nil {
+				return nil, err
+			}
+			src.query = q
+			return src, nil
+		}
+		_, table := db.findTable(tableName)
+		if table == nil {
+			return nil, ErrTableNotExist
+		}
+		if alias == "" {
+			alias = tableName
+		}
+		return s.add(alias, table)
+	}
+
+	_, err := add(stmt.TableName, stmt.Subquery, stmt.TableAlias)
+	if err != nil {
+		return nil, err
+	}
+	for _, join := range stmt.Joins {
+		src, err := add(join.TableName, join.Subquery, join.Alias)
+		if err != nil {
+			return nil, err
+		}
+		switch join.Type {
+		case JoinLeft:
+			src.nullable = true
+		case JoinRight:
+			for _, earlier := range s.sources[:len(s.sources)-1] {
+				earlier.nullable = true
+			}
+		}
+
+		// ON can use tables up to the joined one
+		if join.On != nil {
+			err = join.On.bind(s)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return s, nil
+}
+
+// column gives schema of column at the position of row
+func (s *scope) column(index int) *Column {
+	src := s.sourceOf(index)
+	return src.table.Columns[index-src.offset]
+}
+
+// isNullable tells if select list value can be null
+func (s *scope) isNullable(field Expr) bool {
+	switch e := field.(type) {
+	case *ColumnRef:
+		src := s.sourceOf(e.index)
+		return src.nullable || !src.table.isNotNull(src.table.Columns[e.index-src.offset].Name)
+	case *Aggregate:
+		return e.Func != "COUNT"
+	}
+	return true
+}
+
+// joinStep finds rows of joined table for rows of earlier tables
+type joinStep struct {
+	join  *Join
+	src   *source
+	outer *ColumnRef // column of earlier table ON compares by =, nil if there is none
+	inner *ColumnRef // column of joined table compared with outer
+
+	// rows are found by index, or by hash or all of rows kept in memory
+	index   *btree
+	rows    []*Row
+	hash    map[string][]int // positions of rows by value of inner column
+	matched []bool           // rows that were joined, for RIGHT JOIN
+}
+
+// joiner joins rows of first table with the other tables of FROM
+type joiner struct {
+	db    *Database
+	scope *scope
+	steps []*joinStep
+	args  []driver.Value
+}
+
+// newJoiner prepares joins, picks how rows of every joined table are found
+func (db *Database) newJoiner(s *scope, joins []*Join, args []driver.Value) (*joiner, error) {
+	j := &joiner{db: db, scope: s, args: args}
+	for i, join := range joins {
+		step := &joinStep{join: join, src: s.sources[i+1]}
+		j.steps = append(j.steps, step)
+
+		// = of columns of same type, one of joined table and one of earlier table
+		for _, cond := range conjuncts(join.On) {
+			bin, ok := cond.(*BinaryExpr)
+			if !ok || bin.Op != OperatorTypeEqual {
+				continue
+			}
+			outer, ok := bin.LHS.(*ColumnRef)
+			inner, ok2 := bin.RHS.(*ColumnRef)
+			if !ok || !ok2 {
+				continue
+			}
+			if outer.index >= step.src.offset {
+				outer, inner = inner, outer
+			}
+			if outer.index >= step.src.offset || s.sourceOf(inner.index) != step.src {
+				continue
+			}
+			if outer.outer != nil || inner.outer != nil {
+				continue
+			}
+			// column of derived table can have no type
+			if typ := s.column(inner.index).Type; typ == 0 || typ != s.column(outer.index).Type {
+				continue
+			}
+			step.outer, step.inner = outer, inner
+			break
+		}
+
+		if step.outer != nil && join.Type != JoinRight {
+			name := s.column(step.inner.index).Name
+			for _, idx := range step.src.table.allIndexes() {
+				if idx.Columns[0] != name {
+					continue
+				}
+				bt, err := db.openIndex(step.src.table, idx)
+				if err != nil {
+					return nil, err
+				}
+				step.index = bt
+				break
+			}
+		}
+		if step.index != nil {
+			continue
+		}
+
+		err := db.walkSource(step.src, nil, args, nil, func(row *Row) error {
+			step.rows = append(step.rows, row)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		if step.outer != nil {
+			step.hash = map[string][]int{}
+			for pos, row := range step.rows {
+				// null never equals
+				val := row.Columns[step.inner.index-step.src.offset]
+				if val.DataIsNull {
+					continue
+				}
+				key, err := encodeKey(val)
+				if err != nil {
+					return nil, err
+				}
+				step.hash[string(key)] = append(step.hash[string(key)], pos)
+			}
+		}
+		if join.Type == JoinRight {
+			step.matched = make([]bool, len(step.rows))
+		}
+		if Verbose >= 2 {
+			fmt.Printf("join %s   rows: %d  hash: %v\n", step.src.name, len(step.rows), step.hash != nil)
+		}
+	}
+	return j, nil
+}
+
+// eachRow calls fn with rows of joined table that can be joined with row,
+// pos is position of the row kept in memory, -1 if found by index
+func (j *joiner) eachRow(step *joinStep, row *Row, fn func(pos int, inner *Row) error) error {
+	if step.outer == nil {
+		for pos, inner := range step.rows {
+			err := fn(pos, inner)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	val := row.Columns[step.outer.index]
+	if val.DataIsNull {
+		return nil
+	}
+	key, err := encodeKey(val)
+	if err != nil {
+		return err
+	}
+
+	if step.index != nil {
+		kr := &keyRange{}
+		kr.setFrom(key, false)
+		kr.setTo(key, false)
+		return step.index.indexScan(kr, func(id rowID) error {
+			dat, err := j.db.heapGet(step.src.table, id)
+			if err != nil {
+				return err
+			}
+			inner, err := decodeRow(step.src.table, dat)
+			if err != nil {
+				return err
+			}
+			inner.id = id
+			return fn(-1, inner)
+		})
+	}
+	for _, pos := range step.hash[string(key)] {
+		err = fn(pos, step.rows[pos])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// joinRow joins row with tables of steps from i on, fn is called with every joined row
+func (j *joiner) joinRow(i int, row *Row, fn func(row *Row) error) error {
+	if i == len(j.steps) {
+		return fn(row)
+	}
+	step := j.steps[i]
+
+	found := false
+	err := j.eachRow(step, row, func(pos int, inner *Row) error {
+		joined := joinColumns(row.Columns, inner.Columns)
+		if ok, err := matchRow(joined, step.join.On, j.args); err != nil || !ok {
+			return err
+		}
+		found = true
+		if step.matched != nil {
+			step.matched[pos] = true
+		}
+		return j.joinRow(i+1, joined, fn)
+	})
+	if err != nil {
+		return err
+	}
+
+	// row of earlier tables is kept, joined table is null
+	if !found && step.join.Type == JoinLeft {
+		return j.joinRow(i+1, joinColumns(row.Columns, nullColumns(step.src.table)), fn)
+	}
+	return nil
+}
+
+// joinUnmatched joins rows of RIGHT JOIN tables that were never joined, earlier tables are null
+func (j *joiner) joinUnmatched(fn func(row *Row) error) error {
+	for i, step := range j.steps {
+		if step.join.Type != JoinRight {
+			continue
+		}
+		for pos, inner := range step.rows {
+			if step.matched[pos] {
+				continue
+			}
+			nulls := []*Column{}
+			for _, src := range j.scope.sources[:i+1] {
+				nulls = append(nulls, nullColumns(src.table)...)
+			}
+			err := j.joinRow(i+1, joinColumns(nulls, inner.Columns), fn)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// joinColumns gives row of columns of a followed by columns of b
+func joinColumns(a, b []*Column) *Row {
+	columns := make([]*Column, 0, len(a)+len(b))
+	columns = append(columns, a...)
+	return &Row{Columns: append(columns, b...)}
+}
+
+// nullColumns gives null of every column of table
+func nullColumns(table *Table) []*Column {
+	columns := make([]*Column, len(table.Columns))
+	for i, col := range table.Columns {
+		columns[i] = &Column{Name: col.Name, Type: col.Type, DataIsNull: true}
+	}
+	return columns
+}
+
+// walkSelect calls fn for every row of FROM tables that match where condition,
+// rows are in order of index if given, index can only be given without joins
+func (db *Database) walkSelect(s *scope, joins []*Join, where Expr, args []driver.Value, order *Index, fn func(row *Row) error) error {
+	if len(joins) == 0 {
+		return db.walkSource(s.sources[0], where, args, order, fn)
+	}
+
+	j, err := db.newJoiner(s, joins, args)
+	if err != nil {
+		return err
+	}
+
+	// conditions of only first table are checked when it is read
+	var first, rest []Expr
+	for _, cond := range conjuncts(where) {
+		if s.onlyFirst(cond) && !hasJoin(joins, JoinRight) {
+			first = append(first, cond)
+		} else {
+			rest = append(rest, cond)
+		}
+	}
+	restWhere := joinConjuncts(rest)
+
+	stopped := false
+	emit := func(row *Row) error {
+		if ok, err := matchRow(row, restWhere, args); err != nil || !ok {
+			return err
+		}
+		err := fn(row)
+		if err == errStopWalk {
+			stopped = true
+		}
+		return err
+	}
+	err = db.walkSource(s.sources[0], joinConjuncts(first), args, nil, func(row *Row) error {
+		return j.joinRow(0, row, emit)
+	})
+	if err != nil || stopped {
+		return err
+	}
+	err = j.joinUnmatched(emit)
+	if err == errStopWalk {
+		return nil
+	}
+	return err
+}
+
+// walkSource calls fn for every row of table or derived table that match where condition
+func (db *Database) walkSource(src *source, where Expr, args []driver.Value, order *Index, fn func(row *Row) error) error {
+	if src.query == nil {
+		return db.walkRows(src.table, where, args, order, fn)
+	}
+
+	rows, err := src.query.rows(args)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		row.TableName = src.table.Name
+		ok, err := matchRow(row, where, args)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		err = fn(row)
+		if err == errStopWalk {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// onlyFirst tells if expression uses no column other than of first table,
+// subquery can use any column so it is never only of first table
+func (s *scope) onlyFirst(expr Expr) bool {
+	switch e := expr.(type) {
+	case *ColumnRef:
+		return e.outer != nil || s.sourceOf(e.index) == s.sources[0]
+	case *Subquery:
+		return false
+	}
+	for _, child := range exprChildren(expr) {
+		if !s.onlyFirst(child) {
+			return false
+		}
+	}
+	return true
+}
+
+// hasJoin tells if there is join of the type
+func hasJoin(joins []*Join, joinType string) bool {
+	for _, join := range joins {
+		if join.Type == joinType {
+			return true
+		}
+	}
+	return false
+}
+
+// joinConjuncts joins expressions by AND, nil if there is none
+func joinConjuncts(exprs []Expr) Expr {
+	var expr Expr
+	for _, cond := range exprs {
+		if expr == nil {
+			expr = cond
+			continue
+		}
+		expr = &BinaryExpr{Op: OperatorTypeAnd, LHS: expr, RHS: cond}
+	}
+	return expr
+}
@@ -0,0 +1,130 @@
+package furydb
+
+import (
+	"io"
+	"os"
+	"path"
+)
+
+// Note:
+// Files holding table rows are split into fixed size pages, pages are read and written as whole.
+// Pages read from disk are kept in cache, pages written inside transaction stays pending in
+// the transaction until commit, so reads see the newest version of the page.
+
+const (
+	pageSize       = 8192 // size of page in bytes
+	maxCachedPages = 1024 // most pages kept in cache
+)
+
+// pageKey identify page in file, path is relative to database folder
+type pageKey struct {
+	path string
+	num  int64
+}
+
+// readPage reads page from file relative to database folder, returned page can be modified
+func (db *Database) readPage(relpath string, num int64) ([]byte, error) {
+	key := pageKey{relpath, num}
+	page := make([]byte, pageSize)
+
+	// pending page of transaction
+	if db.tx != nil {
+		if entry, ok := db.tx.files[key]; ok {
+			copy(page, entry.Data)
+			return page, nil
+		}
+		if db.isRemoved(relpath) {
+			return page, nil
+		}
+	}
+	if cached, ok := db.cache[key]; ok {
+		copy(page, cached)
+		return page, nil
+	}
+
+	f, err := os.Open(path.Join(db.Folderpath, relpath))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	_, err = f.ReadAt(page, num*pageSize)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	db.cachePage(key, page)
+
+	return page, nil
+}
+
+// writePage writes page to file relative to database folder
+func (db *Database) writePage(relpath string, num int64, page []byte) error {
+	key := pageKey{relpath, num}
+	data := make([]byte, pageSize)
+	copy(data, page)
+
+	entry := &walEntry{Path: relpath, Page: num, Data: data}
+	if db.tx == nil {
+		return db.logCommit([]*walEntry{entry})
+	}
+	db.tx.files[key] = entry
+	return nil
+}
+
+// numPages gives number of pages in file relative to database folder
+func (db *Database) numPages(relpath string) (int64, error) {
+	var num int64
+	// removed file is recreated from pending pages only
+	if !db.isRemoved(relpath) {
+		info, err := os.Stat(path.Join(db.Folderpath, relpath))
+		if err == nil {
+			num = (info.Size() + pageSize - 1) / pageSize
+		} else if !os.IsNotExist(err) {
+			return 0, err
+		}
+	}
+
+	// file grows with pending pages
+	if db.tx != nil {
+		for key := range db.tx.files {
+			if key.path == relpath && key.num >= num {
+				num = key.num + 1
+			}
+		}
+	}
+	return num, nil
+}
+
+// isRemoved tells if file is removed by transaction
+func (db *Database) isRemoved(relpath string) bool {
+	if db.tx == nil {
+		return false
+	}
+	entry, ok := db.tx.files[pageKey{relpath, -1}]
+	return ok && entry.Remove
+}
+
+// cachePage keeps copy of committed page
+func (db *Database) cachePage(key pageKey, page []byte) {
+	if db.cache == nil {
+		db.cache = map[pageKey][]byte{}
+	}
+	// make room, any page will do
+	if _, ok := db.cache[key]; !ok && len(db.cache) >= maxCachedPages {
+		for k := range db.cache {
+			delete(db.cache, k)
+			break
+		}
+	}
+	data := make([]byte, pageSize)
+	copy(data, page)
+	db.cache[key] = data
+}
+
+// uncacheFile drops cached pages of file
+func (db *Database) uncacheFile(relpath string) {
+	for key := range db.cache {
+		if key.path == relpath {
+			delete(db.cache, key)
+		}
+	}
+}
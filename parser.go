@@ -1,6 +1,7 @@
 package furydb
 
 import (
+	"encoding/hex"
 	"fmt"
 	"io"
 	"strconv"
@@ -16,8 +17,15 @@ type Parser struct {
 		lit string // last read literal
 		n   int    // buffer size (max=1)
 	}
+
+	numInput   int    // number of placeholders
+	paramStyle string // placeholder style used, ? or $
 }
 
+// Statement is a parsed SQL statement,
+// e.g. *SelectStatement, *InsertStatement
+type Statement interface{}
+
 // NewParser returns a new instance of Parser.
 func NewParser(r io.Reader) *Parser {
 	return &Parser{s: NewScanner(r)}
@@ -41,40 +49,10 @@ func (p *Parser) scan() (tok Token, lit string) {
 	return
 }
 
-// scan returns the next token from the underlying scanner.
-// If a token has been unscanned then read that instead.
-func (p *Parser) scanValue() (tok Token, lit string) {
-	// If we have a token on the buffer, then return it.
-	if p.buf.n != 0 {
-		p.buf.n = 0
-		return p.buf.tok, p.buf.lit
-	}
-
-	// Otherwise read the next token from the scanner.
-	tok, lit = p.s.ScanValue()
-
-	// Save it to the buffer in case we unscan later.
-	p.buf.tok, p.buf.lit = tok, lit
-
-	return
-}
-
-// scanIgnoreWhitespace scans the next non-whitespace token.
-func (p *Parser) scanValueIgnoreWhitespace() (tok Token, lit string) {
-	tok, lit = p.scanValue()
-	if tok == WS {
-		tok, lit = p.scanValue()
-	}
-	if Verbose >= 3 {
-		fmt.Printf("tok: %+v      lit: %+v\n", tok, lit)
-	}
-	return
-}
-
 // scanIgnoreWhitespace scans the next non-whitespace token.
 func (p *Parser) scanIgnoreWhitespace() (tok Token, lit string) {
 	tok, lit = p.scan()
-	if tok == WS {
+	for tok == WS {
 		tok, lit = p.scan()
 	}
 	if Verbose >= 3 {
@@ -86,14 +64,94 @@ func (p *Parser) scanIgnoreWhitespace() (tok Token, lit string) {
 // unscan pushes the previously read token back onto the buffer.
 func (p *Parser) unscan() { p.buf.n = 1 }
 
+// scanEnd expects the end of statement, the ending ; is optional for the last statement
+func (p *Parser) scanEnd() error {
+	tok, lit := p.scanIgnoreWhitespace()
+	if tok == EOF {
+		p.unscan()
+		return nil
+	}
+	if tok != SEMICOL {
+		return fmt.Errorf("found %q, expected ;", lit)
+	}
+	return nil
+}
+
+// parseStatements parses all semicolon seperated statements
+func (p *Parser) parseStatements() ([]Statement, error) {
+	stmts := []Statement{}
+	for {
+		tok, _ := p.scanIgnoreWhitespace()
+		if tok == EOF {
+			break
+		} else if tok == SEMICOL {
+			// empty statement
+			continue
+		}
+		p.unscan()
+
+		stmt, err := p.parseStatement()
+		if err != nil {
+			return nil, err
+		}
+		stmts = append(stmts, stmt)
+	}
+	if len(stmts) == 0 {
+		return nil, fmt.Errorf("empty query")
+	}
+	return stmts, nil
+}
+
+// parseStatement parses a statement, first keyword tells the type of statement
+func (p *Parser) parseStatement() (Statement, error) {
+	tok, lit := p.scanIgnoreWhitespace()
+	p.unscan()
+
+	switch tok {
+	case CREATE:
+		return p.parseCreate()
+	case DROP:
+		return p.parseIndexDrop()
+	case INSERT:
+		return p.parseInsert()
+	case SELECT:
+		return p.parseSelect()
+	case UPDATE:
+		return p.parseUpdate()
+	case DELETE:
+		return p.parseDelete()
+	}
+
+	return nil, fmt.Errorf("found %q, unsupported query", lit)
+}
+
+// parseCreate parses a SQL CREATE statement, keyword after CREATE tells what is created
+func (p *Parser) parseCreate() (Statement, error) {
+	// First token should be a "CREATE" keyword.
+	if tok, lit := p.scanIgnoreWhitespace(); tok != CREATE {
+		return nil, fmt.Errorf("found %q, expected CREATE", lit)
+	}
+	tok, lit := p.scanIgnoreWhitespace()
+	p.unscan()
+
+	switch tok {
+	case TABLE:
+		return p.parseTableCreate()
+	case INDEX, UNIQUE:
+		return p.parseIndexCreate()
+	}
+
+	return nil, fmt.Errorf("found %q, expected TABLE or INDEX", lit)
+}
+
 // sanityCheckQuery check the field and value, and return formatted columns
-func sanityCheckQuery(fields []string, values []string, table *Table) ([]*Column, error) {
+func sanityCheckQuery(fields []string, values []*Column, table *Table) ([]*Column, error) {
 	// result columns with data
 	rColumns := []*Column{}
 
 	if Verbose >= 3 {
 		fmt.Printf("fields: (%d) %q\n", len(fields), fields)
-		fmt.Printf("values: (%d) %q\n", len(values), values)
+		fmt.Printf("values: (%d) %+v\n", len(values), values)
 	}
 
 	// sanity check fields and values length
@@ -107,109 +165,28 @@ func sanityCheckQuery(fields []string, values []string, table *Table) ([]*Column
 		for _, col := range table.Columns {
 			if col.Name == field {
 				// duplicate so we dont mutate the original column
-				column = &*col
+				dup := *col
+				column = &dup
 			}
 		}
 		if column == nil {
 			return nil, ErrColumnNotExist
 		}
-		var constraint *Constraint
-		for _, cstr := range table.Constraints {
-			if cstr.ColumnName == field {
-				constraint = cstr
-			}
-		}
-
 		if Verbose >= 4 {
 			fmt.Printf("column: %+v\n", column)
 		}
 
 		value := values[i]
-		switch column.Type {
-		case ColumnTypeBool:
-			switch strings.ToLower(value) {
-			case "true":
-				column.DataBool = true
-			case "false":
-				column.DataBool = false
-			case "null":
-				if constraint == nil {
-					return nil, ErrColumnNotNullable
-				}
-				column.DataBool = false
-				column.DataIsNull = true
-			default:
-				return nil, ErrValueTypeNotBool
-			}
-		case ColumnTypeInt:
-			if strings.ToLower(value) == "null" {
-				if constraint == nil {
-					return nil, ErrColumnNotNullable
-				}
-				column.DataInt = 0
-				column.DataIsNull = true
-			} else {
-				num, err := strconv.ParseInt(value, 10, 64)
-				if err != nil {
-					return nil, ErrValueTypeNotInt
-				}
-				column.DataInt = num
-			}
-		case ColumnTypeFloat:
-			if strings.ToLower(value) == "null" {
-				if constraint == nil {
-					return nil, ErrColumnNotNullable
-				}
-				column.DataFloat = 0
-				column.DataIsNull = true
-			} else {
-				num, err := strconv.ParseFloat(value, 64)
-				if err != nil {
-					return nil, ErrValueTypeNotFloat
-				}
-				column.DataFloat = num
-			}
-		case ColumnTypeString:
-			// todo, null or 'null' is just treated as null, this could be problematic
-			if strings.ToLower(value) == "null" {
-				if constraint == nil {
-					return nil, ErrColumnNotNullable
-				}
-				column.DataString = ""
-				column.DataIsNull = true
-			} else {
-				column.DataString = value
-			}
-		case ColumnTypeTime:
-			if strings.ToLower(value) == "null" {
-				if constraint == nil {
-					return nil, ErrColumnNotNullable
-				}
-				column.DataTime = time.Time{}
-				column.DataIsNull = true
-			} else {
-				t, err := time.Parse(value, time.RFC3339)
-				if err != nil {
-					return nil, ErrValueTypeNotTime
-				}
-				column.DataTime = t
-			}
-		case ColumnTypeUUID:
-			if strings.ToLower(value) == "null" {
-				if constraint == nil {
-					return nil, ErrColumnNotNullable
-				}
-				column.DataUUID = [16]byte{}
-				column.DataIsNull = true
-			} else {
-				b, err := UUIDStrToBin(value)
-				if err != nil {
-					return nil, ErrValueTypeNotUUID
-				}
-				column.DataUUID = b
+		if value.DataIsNull {
+			// not null is checked when row is written, as default and foreign key action can give null too
+			column.DataIsNull = true
+		} else {
+			// value is converted to column type, e.g. text to uuid
+			val, err := coerce(value, column.Type)
+			if err != nil {
+				return nil, err
 			}
-		default:
-			return nil, ErrUnknownColumnType
+			setData(column, val)
 		}
 		// add columns together and eventually use for return
 		rColumns = append(rColumns, column)
@@ -217,3 +194,85 @@ func sanityCheckQuery(fields []string, values []string, table *Table) ([]*Column
 
 	return rColumns, nil
 }
+
+// setData copies data of src column to dst column
+func setData(dst *Column, src *Column) {
+	dst.DataIsNull = src.DataIsNull
+	dst.DataIsValid = src.DataIsValid
+	dst.DataBool = src.DataBool
+	dst.DataInt = src.DataInt
+	dst.DataFloat = src.DataFloat
+	dst.DataString = src.DataString
+	dst.DataTime = src.DataTime
+	dst.DataBytes = src.DataBytes
+	dst.DataUUID = src.DataUUID
+}
+
+// timeLayouts accepted for time value
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// parseValue converts value in text form to column data base on the column type
+func parseValue(column *Column, value string) error {
+	switch column.Type {
+	case ColumnTypeBool:
+		switch strings.ToLower(value) {
+		case "true":
+			column.DataBool = true
+		case "false":
+			column.DataBool = false
+		default:
+			return ErrValueTypeNotBool
+		}
+	case ColumnTypeInt:
+		num, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return ErrValueTypeNotInt
+		}
+		column.DataInt = num
+	case ColumnTypeFloat:
+		num, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return ErrValueTypeNotFloat
+		}
+		column.DataFloat = num
+	case ColumnTypeString:
+		column.DataString = value
+	case ColumnTypeTime:
+		var t time.Time
+		var err error
+		for _, layout := range timeLayouts {
+			t, err = time.Parse(layout, value)
+			if err == nil {
+				break
+			}
+		}
+		if err != nil {
+			return ErrValueTypeNotTime
+		}
+		column.DataTime = t
+	case ColumnTypeBytes:
+		// \x prefix is hex encoded, otherwise raw bytes of the text
+		if strings.HasPrefix(value, "\\x") {
+			b, err := hex.DecodeString(value[2:])
+			if err != nil {
+				return ErrValueTypeNotBytes
+			}
+			column.DataBytes = b
+		} else {
+			column.DataBytes = []byte(value)
+		}
+	case ColumnTypeUUID:
+		b, err := UUIDStrToBin(value)
+		if err != nil {
+			return ErrValueTypeNotUUID
+		}
+		column.DataUUID = b
+	default:
+		return ErrUnknownColumnType
+	}
+	return nil
+}
@@ -0,0 +1,301 @@
+package furydb
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Note:
+// LIKE pattern has % for any text and _ for any one character, there is no escape character
+// unless given by ESCAPE, e.g. name LIKE '100!%' ESCAPE '!'. ILIKE ignores case.
+// Value that is not string is matched in its CAST to string form.
+// LIKE with pattern starting with literal text limits index range of string column to keys
+// starting with the text, same as BETWEEN limits it like >= and <=.
+
+// LikeExpr tells if value matches pattern, e.g. name LIKE 'a%', name NOT ILIKE '%x_'
+type LikeExpr struct {
+	Expr       Expr
+	Pattern    Expr
+	Escape     Expr // nil if not given
+	Not        bool
+	IgnoreCase bool // ILIKE
+}
+
+// String implements Expr
+func (e *LikeExpr) String() string {
+	op := "LIKE"
+	if e.IgnoreCase {
+		op = "ILIKE"
+	}
+	if e.Not {
+		op = "NOT " + op
+	}
+	str := "(" + e.Expr.String() + " " + op + " " + e.Pattern.String()
+	if e.Escape != nil {
+		str += " ESCAPE " + e.Escape.String()
+	}
+	return str + ")"
+}
+
+func (e *LikeExpr) bind(s *scope) error {
+	for _, expr := range exprChildren(e) {
+		err := expr.bind(s)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *LikeExpr) eval(ctx *evalContext) (*Column, error) {
+	val, err := e.Expr.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pattern, err := e.compile(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if val.DataIsNull || pattern == nil {
+		return nullBool(), nil
+	}
+	val, err = castValue(val, ColumnTypeString)
+	if err != nil {
+		return nil, err
+	}
+	match := matchLike([]rune(val.DataString), pattern, e.IgnoreCase)
+	return &Column{Type: ColumnTypeBool, DataBool: match != e.Not}, nil
+}
+
+// wildcards of compiled LIKE pattern, other runes are matched as they are
+const (
+	likeAnyChar rune = -1 // _
+	likeAnyText rune = -2 // %
+)
+
+// compile gives pattern with wildcards replaced, nil if pattern or escape is null
+func (e *LikeExpr) compile(ctx *evalContext) ([]rune, error) {
+	val, err := e.Pattern.eval(ctx)
+	if err != nil || val.DataIsNull {
+		return nil, err
+	}
+	val, err = castValue(val, ColumnTypeString)
+	if err != nil {
+		return nil, err
+	}
+
+	// empty escape is no escape
+	escape := []rune{}
+	if e.Escape != nil {
+		esc, err := e.Escape.eval(ctx)
+		if err != nil || esc.DataIsNull {
+			return nil, err
+		}
+		if esc.Type != ColumnTypeString {
+			return nil, ErrValueTypeNotString
+		}
+		escape = []rune(esc.DataString)
+		if len(escape) > 1 {
+			return nil, ErrInvalidEscape
+		}
+	}
+
+	pattern := []rune{}
+	runes := []rune(val.DataString)
+	for i := 0; i < len(runes); i++ {
+		switch ch := runes[i]; {
+		case len(escape) == 1 && ch == escape[0]:
+			i++
+			if i == len(runes) {
+				return nil, ErrInvalidPattern
+			}
+			pattern = append(pattern, runes[i])
+		case ch == '%':
+			pattern = append(pattern, likeAnyText)
+		case ch == '_':
+			pattern = append(pattern, likeAnyChar)
+		default:
+			pattern = append(pattern, ch)
+		}
+	}
+	return pattern, nil
+}
+
+// matchLike tells if text matches compiled pattern, on mismatch it goes back to the last %
+// and lets it take one more character
+func matchLike(text, pattern []rune, ignoreCase bool) bool {
+	t, p := 0, 0
+	star, mark := -1, 0
+	for t < len(text) {
+		switch {
+		case p < len(pattern) && pattern[p] == likeAnyText:
+			star, mark = p, t
+			p++
+		case p < len(pattern) && (pattern[p] == likeAnyChar || sameRune(pattern[p], text[t], ignoreCase)):
+			p++
+			t++
+		case star >= 0:
+			mark++
+			p, t = star+1, mark
+		default:
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p] == likeAnyText {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// sameRune tells if two runes are same, optionally ignoring case
+func sameRune(a, b rune, ignoreCase bool) bool {
+	return a == b || ignoreCase && unicode.ToLower(a) == unicode.ToLower(b)
+}
+
+// likePrefix gives literal text that every value matching compiled pattern starts with
+func likePrefix(pattern []rune) string {
+	var b strings.Builder
+	for _, ch := range pattern {
+		if ch == likeAnyChar || ch == likeAnyText {
+			break
+		}
+		b.WriteRune(ch)
+	}
+	return b.String()
+}
+
+// parseLike parses LIKE or ILIKE after value, e.g. LIKE 'a%' ESCAPE '!'
+func (p *Parser) parseLike(lhs Expr, not, ignoreCase bool) (Expr, error) {
+	var err error
+	expr := &LikeExpr{Expr: lhs, Not: not, IgnoreCase: ignoreCase}
+	expr.Pattern, err = p.parseConcat()
+	if err != nil {
+		return nil, err
+	}
+	if tok, _ := p.scanIgnoreWhitespace(); tok != ESCAPE {
+		p.unscan()
+		return expr, nil
+	}
+	expr.Escape, err = p.parseConcat()
+	if err != nil {
+		return nil, err
+	}
+	return expr, nil
+}
+
+// BetweenExpr tells if value is in range including both ends, e.g. qty BETWEEN 1 AND 10
+type BetweenExpr struct {
+	Expr Expr
+	Low  Expr
+	High Expr
+	Not  bool
+}
+
+// String implements Expr
+func (e *BetweenExpr) String() string {
+	op := " BETWEEN "
+	if e.Not {
+		op = " NOT BETWEEN "
+	}
+	return "(" + e.Expr.String() + op + e.Low.String() + " AND " + e.High.String() + ")"
+}
+
+func (e *BetweenExpr) bind(s *scope) error {
+	for _, expr := range exprChildren(e) {
+		err := expr.bind(s)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *BetweenExpr) eval(ctx *evalContext) (*Column, error) {
+	val, err := e.Expr.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	low, err := e.Low.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	high, err := e.High.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// same as val >= low AND val <= high
+	lhs, err := evalComparison(OperatorTypeMoreThanOrEqual, val, low)
+	if err != nil {
+		return nil, err
+	}
+	rhs, err := evalComparison(OperatorTypeLessThanOrEqual, val, high)
+	if err != nil {
+		return nil, err
+	}
+	res, err := evalLogical(OperatorTypeAnd, lhs, rhs)
+	if err != nil || !e.Not || res.DataIsNull {
+		return res, err
+	}
+	return &Column{Type: ColumnTypeBool, DataBool: !res.DataBool}, nil
+}
+
+// parseBetween parses BETWEEN after value, e.g. BETWEEN 1 AND 10
+func (p *Parser) parseBetween(lhs Expr, not bool) (Expr, error) {
+	var err error
+	expr := &BetweenExpr{Expr: lhs, Not: not}
+	// AND of BETWEEN is not logical AND, so ends are parsed below it
+	expr.Low, err = p.parseConcat()
+	if err != nil {
+		return nil, err
+	}
+	if tok, lit := p.scanIgnoreWhitespace(); tok != AND {
+		return nil, fmt.Errorf("found %q, expected AND", lit)
+	}
+	expr.High, err = p.parseConcat()
+	if err != nil {
+		return nil, err
+	}
+	return expr, nil
+}
+
+// IsNullExpr tells if value is null, e.g. email IS NOT NULL
+type IsNullExpr struct {
+	Expr Expr
+	Not  bool
+}
+
+// String implements Expr
+func (e *IsNullExpr) String() string {
+	if e.Not {
+		return "(" + e.Expr.String() + " IS NOT NULL)"
+	}
+	return "(" + e.Expr.String() + " IS NULL)"
+}
+
+func (e *IsNullExpr) bind(s *scope) error {
+	return e.Expr.bind(s)
+}
+
+func (e *IsNullExpr) eval(ctx *evalContext) (*Column, error) {
+	val, err := e.Expr.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &Column{Type: ColumnTypeBool, DataBool: val.DataIsNull != e.Not}, nil
+}
+
+// parseIsNull parses IS NULL after value, e.g. IS NOT NULL
+func (p *Parser) parseIsNull(lhs Expr) (Expr, error) {
+	expr := &IsNullExpr{Expr: lhs}
+	tok, lit := p.scanIgnoreWhitespace()
+	if tok == NOT {
+		expr.Not = true
+		tok, lit = p.scanIgnoreWhitespace()
+	}
+	if tok != NULL {
+		return nil, fmt.Errorf("found %q, expected NULL", lit)
+	}
+	return expr, nil
+}
@@ -31,12 +31,54 @@ func (s *Scanner) Scan() (tok Token, lit string) {
 	} else if isLetter(ch) {
 		s.unread()
 		return s.scanIdent()
+	} else if isDigit(ch) {
+		s.unread()
+		return s.scanNumber()
 	}
 
 	// Otherwise read the individual character.
 	switch ch {
 	case eof:
 		return EOF, ""
+	case '-':
+		// -- is comment till end of line
+		ch2 := s.read()
+		if ch2 == '-' {
+			return s.scanComment()
+		}
+		s.unread()
+		return MINUS, string(ch)
+	case '+':
+		return PLUS, string(ch)
+	case '/':
+		return SLASH, string(ch)
+	case '%':
+		return PERCENT, string(ch)
+	case '|':
+		if ch2 := s.read(); ch2 == '|' {
+			return CONCAT, "||"
+		}
+		s.unread()
+	case '\'':
+		return s.scanText()
+	case '?':
+		return PLACEHOLDER, string(ch)
+	case '$':
+		// numbered placeholder, e.g. $1
+		var buf bytes.Buffer
+		buf.WriteRune(ch)
+		for {
+			if ch := s.read(); isDigit(ch) {
+				buf.WriteRune(ch)
+			} else {
+				s.unread()
+				break
+			}
+		}
+		if buf.Len() == 1 {
+			return ILLEGAL, buf.String()
+		}
+		return PLACEHOLDER, buf.String()
 	case '*':
 		return ASTERISK, string(ch)
 	case ',':
@@ -45,12 +87,34 @@ func (s *Scanner) Scan() (tok Token, lit string) {
 		return LEFTPAR, string(ch)
 	case ')':
 		return RIGHTPAR, string(ch)
-	case '\'':
-		return SINGLEQUO, string(ch)
 	case '"':
-		return DOUBLEQUO, string(ch)
+		return s.scanQuotedIdent()
 	case ';':
 		return SEMICOL, string(ch)
+	case '.':
+		return DOT, string(ch)
+	case '=':
+		return EQ, string(ch)
+	case '<':
+		ch2 := s.read()
+		if ch2 == '=' {
+			return LTE, "<="
+		} else if ch2 == '>' {
+			return NEQ, "<>"
+		}
+		s.unread()
+		return LT, string(ch)
+	case '>':
+		if ch2 := s.read(); ch2 == '=' {
+			return GTE, ">="
+		}
+		s.unread()
+		return GT, string(ch)
+	case '!':
+		if ch2 := s.read(); ch2 == '=' {
+			return NEQ, "!="
+		}
+		s.unread()
 	}
 
 	return ILLEGAL, string(ch)
@@ -111,6 +175,77 @@ func (s *Scanner) scanWhitespace() (tok Token, lit string) {
 	return WS, buf.String()
 }
 
+// scanComment consumes the rest of the line, comment is treated as whitespace.
+func (s *Scanner) scanComment() (tok Token, lit string) {
+	for {
+		if ch := s.read(); ch == eof || ch == '\n' {
+			break
+		}
+	}
+	return WS, " "
+}
+
+// scanNumber consumes the current rune and all contiguous number runes.
+func (s *Scanner) scanNumber() (tok Token, lit string) {
+	var buf bytes.Buffer
+	buf.WriteRune(s.read())
+
+	for {
+		if ch := s.read(); ch == eof {
+			break
+		} else if !isDigit(ch) && ch != '.' {
+			s.unread()
+			break
+		} else {
+			_, _ = buf.WriteRune(ch)
+		}
+	}
+
+	return NUMBER, buf.String()
+}
+
+// scanText consumes a single quoted string, the opening quote is already read.
+// Two single quotes inside the string is an escaped single quote.
+func (s *Scanner) scanText() (tok Token, lit string) {
+	var buf bytes.Buffer
+
+	for {
+		ch := s.read()
+		if ch == eof {
+			// unterminated string
+			return ILLEGAL, buf.String()
+		} else if ch == '\'' {
+			// look forward for escaped single quote
+			if ch2 := s.read(); ch2 != '\'' {
+				s.unread()
+				break
+			}
+		}
+		_, _ = buf.WriteRune(ch)
+	}
+
+	return TEXT, buf.String()
+}
+
+// scanQuotedIdent consumes a double quoted identifier, the opening quote is already read.
+// Quoted identifier can have any character, e.g. "cstr-pk"
+func (s *Scanner) scanQuotedIdent() (tok Token, lit string) {
+	var buf bytes.Buffer
+
+	for {
+		ch := s.read()
+		if ch == eof {
+			// unterminated identifier
+			return ILLEGAL, buf.String()
+		} else if ch == '"' {
+			break
+		}
+		_, _ = buf.WriteRune(ch)
+	}
+
+	return IDENT, buf.String()
+}
+
 // scanIdent consumes the current rune and all contiguous ident runes.
 func (s *Scanner) scanValue() (tok Token, lit string) {
 	// Create a buffer and read the current character into it.
@@ -189,6 +324,10 @@ func (s *Scanner) scanIdent() (tok Token, lit string) {
 
 	// If the string matches a keyword then return that keyword.
 	switch strings.ToUpper(buf.String()) {
+	case "CREATE":
+		return CREATE, buf.String()
+	case "TABLE":
+		return TABLE, buf.String()
 	case "INSERT":
 		return INSERT, buf.String()
 	case "INTO":
@@ -199,6 +338,108 @@ func (s *Scanner) scanIdent() (tok Token, lit string) {
 		return SELECT, buf.String()
 	case "FROM":
 		return FROM, buf.String()
+	case "WHERE":
+		return WHERE, buf.String()
+	case "ORDER":
+		return ORDER, buf.String()
+	case "BY":
+		return BY, buf.String()
+	case "ASC":
+		return ASC, buf.String()
+	case "DESC":
+		return DESC, buf.String()
+	case "NULLS":
+		return NULLS, buf.String()
+	case "LIMIT":
+		return LIMIT, buf.String()
+	case "OFFSET":
+		return OFFSET, buf.String()
+	case "TOP":
+		return TOP, buf.String()
+	case "DISTINCT":
+		return DISTINCT, buf.String()
+	case "GROUP":
+		return GROUP, buf.String()
+	case "HAVING":
+		return HAVING, buf.String()
+	case "AS":
+		return AS, buf.String()
+	case "JOIN":
+		return JOIN, buf.String()
+	case "INNER":
+		return INNER, buf.String()
+	case "LEFT":
+		return LEFT, buf.String()
+	case "RIGHT":
+		return RIGHT, buf.String()
+	case "CROSS":
+		return CROSS, buf.String()
+	case "OUTER":
+		return OUTER, buf.String()
+	case "IN":
+		return IN, buf.String()
+	case "EXISTS":
+		return EXISTS, buf.String()
+	case "CASE":
+		return CASE, buf.String()
+	case "WHEN":
+		return WHEN, buf.String()
+	case "THEN":
+		return THEN, buf.String()
+	case "ELSE":
+		return ELSE, buf.String()
+	case "END":
+		return END, buf.String()
+	case "CAST":
+		return CAST, buf.String()
+	case "IS":
+		return IS, buf.String()
+	case "LIKE":
+		return LIKE, buf.String()
+	case "ILIKE":
+		return ILIKE, buf.String()
+	case "BETWEEN":
+		return BETWEEN, buf.String()
+	case "ESCAPE":
+		return ESCAPE, buf.String()
+	case "UPDATE":
+		return UPDATE, buf.String()
+	case "SET":
+		return SET, buf.String()
+	case "DELETE":
+		return DELETE, buf.String()
+	case "INDEX":
+		return INDEX, buf.String()
+	case "ON":
+		return ON, buf.String()
+	case "DROP":
+		return DROP, buf.String()
+	case "AND":
+		return AND, buf.String()
+	case "OR":
+		return OR, buf.String()
+	case "TRUE":
+		return TRUE, buf.String()
+	case "FALSE":
+		return FALSE, buf.String()
+	case "CONSTRAINT":
+		return CONSTRAINT, buf.String()
+	case "PRIMARY":
+		return PRIMARY, buf.String()
+	case "FOREIGN":
+		return FOREIGN, buf.String()
+	case "KEY":
+		return KEY, buf.String()
+	case "REFERENCES":
+		return REFERENCES, buf.String()
+	case "UNIQUE":
+		return UNIQUE, buf.String()
+	case "NOT":
+		return NOT, buf.String()
+	case "NULL":
+		return NULL, buf.String()
+	case "DEFAULT":
+		return DEFAULT, buf.String()
 	}
 
 	// Otherwise return as a regular identifier.
@@ -219,7 +460,7 @@ func (s *Scanner) read() rune {
 func (s *Scanner) unread() { _ = s.r.UnreadRune() }
 
 // isWhitespace returns true if the rune is a space, tab, or newline.
-func isWhitespace(ch rune) bool { return ch == ' ' || ch == '\t' || ch == '\n' }
+func isWhitespace(ch rune) bool { return ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r' }
 
 // isLetter returns true if the rune is a letter.
 func isLetter(ch rune) bool { return (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') }
@@ -1,50 +1,211 @@
 package furydb
 
 import (
-	"bytes"
-	"encoding/gob"
+	"database/sql/driver"
 	"fmt"
-	"io/ioutil"
-	"path"
+	"strconv"
 	"strings"
 )
 
-// querySelect executes a SQL SELECGT statement
-func (c *FuryConn) querySelect(query string) (*results, error) {
-	res := &results{}
-
-	parser := NewParser(strings.NewReader(query))
-	stmt, err := parser.parseSelect()
+// execSelect executes a SQL SELECT statement
+func (c *FuryConn) execSelect(stmt *SelectStatement, args []driver.Value) (*results, error) {
+	q, err := c.db.prepareSelect(stmt, nil)
 	if err != nil {
 		return nil, err
 	}
+	return q.run(args)
+}
+
+// selectQuery is SELECT statement with columns resolved, it can be run many times, e.g. as subquery
+type selectQuery struct {
+	db       *Database
+	stmt     *SelectStatement // with ORDER BY alias resolved
+	scope    *scope
+	fields   []Expr       // select list values
+	aggs     []*Aggregate // aggregates of select, nil if rows are not aggregated
+	columns  []string
+	nullable []bool
+}
 
-	// sanity check find if table exists
-	_, table := c.db.findTable(stmt.TableName)
-	if table == nil {
-		return nil, ErrTableNotExist
+// prepareSelect resolves columns of select, parent is scope of outer query for subquery
+func (db *Database) prepareSelect(stmt *SelectStatement, parent *scope) (*selectQuery, error) {
+	// sanity check find if tables exist, resolve ON of joins
+	s, err := db.fromScope(stmt, parent)
+	if err != nil {
+		return nil, err
 	}
-	// result remember table schema
-	res.tableSchema = table
+	q := &selectQuery{db: db, scope: s}
 
 	// select to all fields
+	items := stmt.Fields
 	if stmt.FieldsAll {
-		for _, col := range table.Columns {
-			stmt.Fields = append(stmt.Fields, col.Name)
+		items = nil
+		for _, src := range s.sources {
+			for _, col := range src.table.Columns {
+				ref := &ColumnRef{Name: col.Name}
+				if len(s.sources) > 1 {
+					ref.Table = src.name
+				}
+				items = append(items, &SelectItem{Expr: ref})
+			}
 		}
 	}
 	// result remember columns
-	res.columns = stmt.Fields
+	for _, item := range items {
+		q.fields = append(q.fields, item.Expr)
+		q.columns = append(q.columns, item.name())
+	}
+	// ORDER BY can use name given to select list value
+	stmt = stmt.orderByAlias(items)
+	q.stmt = stmt
+
+	exprs := append([]Expr{stmt.Where, stmt.Having}, q.fields...)
+	exprs = append(exprs, stmt.GroupBy...)
+	for _, item := range stmt.OrderBy {
+		exprs = append(exprs, item.Expr)
+	}
+	for _, expr := range exprs {
+		if expr == nil {
+			continue
+		}
+		err = expr.bind(s)
+		if err != nil {
+			return nil, err
+		}
+	}
+	q.aggs, err = stmt.aggregates(q.fields)
+	if err != nil {
+		return nil, err
+	}
+	for _, field := range q.fields {
+		q.nullable = append(q.nullable, s.isNullable(field))
+	}
+	return q, nil
+}
+
+// run runs the query, rows can be given one by one by res.more
+func (q *selectQuery) run(args []driver.Value) (*results, error) {
+	stmt, s, fields, aggs := q.stmt, q.scope, q.fields, q.aggs
+	table := s.sources[0].table
+	// result remember table schema and columns
+	res := &results{tableSchema: table, columns: q.columns, nullable: q.nullable}
+
+	limit, err := evalCount(stmt.Limit, args)
+	if err != nil {
+		return nil, err
+	}
+	offset, err := evalCount(stmt.Offset, args)
+	if err != nil {
+		return nil, err
+	}
+	if offset < 0 {
+		offset = 0
+	}
 
 	if Verbose >= 2 {
 		fmt.Printf("stmt: %+v\n", stmt)
 	}
 
-	folderpath := path.Join(c.db.Folderpath, table.Name)
-	res.rows, err = scanDirRows(folderpath, table.Name, stmt.Fields, nil)
+	if limit == 0 {
+		return res, nil
+	}
+	var distinct distinctRows
+	if stmt.Distinct {
+		distinct = distinctRows{}
+	}
+
+	// groups are made in memory, so they are given all at once
+	if aggs != nil || len(stmt.GroupBy) > 0 || stmt.Having != nil {
+		rows, err := q.db.groupRows(s, stmt, fields, aggs, args)
+		if err != nil {
+			return nil, err
+		}
+		rows, err = distinct.filter(rows)
+		if err != nil {
+			return nil, err
+		}
+		if offset > int64(len(rows)) {
+			offset = int64(len(rows))
+		}
+		rows = rows[offset:]
+		if limit >= 0 && limit < int64(len(rows)) {
+			rows = rows[:limit]
+		}
+		res.rows = rows
+		return res, nil
+	}
+
+	// rows are read in index order if index has same order
+	var orderIdx *Index
+	if len(stmt.OrderBy) > 0 && len(stmt.Joins) == 0 {
+		orderIdx = table.orderIndex(stmt.OrderBy)
+	}
+	if len(stmt.OrderBy) == 0 || orderIdx != nil {
+		// scan stops once there are enough rows
+		err = q.db.walkSelect(s, stmt.Joins, stmt.Where, args, orderIdx, func(row *Row) error {
+			row, err := projectRow(fields, &evalContext{row: row, args: args})
+			if err != nil {
+				return err
+			}
+			if seen, err := distinct.seen(row); err != nil || seen {
+				return err
+			}
+			if offset > 0 {
+				offset--
+				return nil
+			}
+			res.rows = append(res.rows, row)
+			if limit > 0 && int64(len(res.rows)) >= limit {
+				return errStopWalk
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return res, nil
+	}
+
+	// sorted rows are given one by one, as they may not fit in memory.
+	// select list is evaluated before sorting, subqueries cannot read tables after lock is released
+	sorter := newRowSorter(stmt.OrderBy, args)
+	err = q.db.walkSelect(s, stmt.Joins, stmt.Where, args, nil, func(row *Row) error {
+		out, err := projectRow(fields, &evalContext{row: row, args: args})
+		if err != nil {
+			return err
+		}
+		return sorter.add(row, out)
+	})
 	if err != nil {
+		sorter.close()
 		return nil, err
 	}
+	next := sorter.sorted()
+	res.more = func() (*Row, error) {
+		for limit != 0 {
+			row, err := next()
+			if err != nil || row == nil {
+				return nil, err
+			}
+			seen, err := distinct.seen(row)
+			if err != nil {
+				return nil, err
+			}
+			if seen {
+				continue
+			}
+			if offset > 0 {
+				offset--
+				continue
+			}
+			if limit > 0 {
+				limit--
+			}
+			return row, nil
+		}
+		return nil, nil
+	}
+	res.close = sorter.close
 
 	if Verbose >= 2 {
 		fmt.Printf("giving results %+v\n", res)
@@ -55,139 +216,468 @@ func (c *FuryConn) querySelect(query string) (*results, error) {
 
 // SelectStatement represents a SQL SELECT statement.
 type SelectStatement struct {
-	FieldsAll bool     // true if using all field(s)
-	Fields    []string // or individual field(s)
-	TableName string
+	Distinct   bool          // rows with same values are given once
+	FieldsAll  bool          // true if using all field(s)
+	Fields     []*SelectItem // or individual field(s), e.g. name, COUNT(*) AS total
+	TableName  string
+	Subquery   *SelectStatement // derived table used instead of stored table, e.g. (SELECT ...) AS t
+	TableAlias string           // name the table is referred by, empty if by table name
+	Joins      []*Join          // tables joined to the table, in order
+	Where      Expr             // condition rows must match, nil matches all
+	GroupBy    []Expr           // rows with same values are aggregated to one row
+	Having     Expr             // condition groups must match, nil matches all
+	OrderBy    []*OrderItem     // order of rows, nil is any order
+	Limit      Expr             // most rows given, from LIMIT or TOP, nil is no limit
+	Offset     Expr             // rows skipped before first row given, nil skips none
 }
 
 // parseSelect parses a SQL SELECT statement
 func (p *Parser) parseSelect() (*SelectStatement, error) {
+	stmt, err := p.parseQuery()
+	if err != nil {
+		return nil, err
+	}
+
+	// statement may end with ;
+	if err = p.scanEnd(); err != nil {
+		return nil, err
+	}
+
+	// Return the successfully parsed statement.
+	return stmt, nil
+}
+
+// parseQuery parses SELECT up to its end, it can be statement or subquery
+func (p *Parser) parseQuery() (*SelectStatement, error) {
+	var err error
 	stmt := &SelectStatement{}
 
 	// First token should be a "SELECT" keyword.
 	if tok, lit := p.scanIgnoreWhitespace(); tok != SELECT {
 		return nil, fmt.Errorf("found %q, expected SELECT", lit)
 	}
+	// optional TOP n, same as LIMIT n
+	if tok, _ := p.scanIgnoreWhitespace(); tok == TOP {
+		stmt.Limit, err = p.parseCount()
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		p.unscan()
+	}
+
+	// optional DISTINCT
+	if tok, _ := p.scanIgnoreWhitespace(); tok == DISTINCT {
+		stmt.Distinct = true
+	} else {
+		p.unscan()
+	}
+
 	// if we see *, then we know it is all fields
-	if tok, lit := p.scanIgnoreWhitespace(); tok == ASTERISK {
+	if tok, _ := p.scanIgnoreWhitespace(); tok == ASTERISK {
 		stmt.FieldsAll = true
+	} else {
+		p.unscan()
+		stmt.Fields, err = p.parseSelectItems()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Next token should be a "FROM" keyword.
+	if tok, lit := p.scanIgnoreWhitespace(); tok != FROM {
+		return nil, fmt.Errorf("found %q, expected FROM", lit)
+	}
+
+	// Next we should read the table name and joined tables.
+	if err = p.parseFrom(stmt); err != nil {
+		return nil, err
+	}
+
+	// optional WHERE condition
+	tok, lit := p.scanIgnoreWhitespace()
+	if tok == WHERE {
+		stmt.Where, err = p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		p.unscan()
+	}
 
-	} else if tok == LEFTPAR {
-		// loop over all our comma-delimited fields
+	// optional GROUP BY
+	if tok, _ = p.scanIgnoreWhitespace(); tok == GROUP {
+		if tok, lit = p.scanIgnoreWhitespace(); tok != BY {
+			return nil, fmt.Errorf("found %q, expected BY", lit)
+		}
 		for {
-			// Read a field.
-			tok, lit = p.scanIgnoreWhitespace()
-			if tok != IDENT {
-				return nil, fmt.Errorf("found %q, expected field", lit)
+			expr, err := p.parseExpr()
+			if err != nil {
+				return nil, err
 			}
-			stmt.Fields = append(stmt.Fields, lit)
-
-			// If the next token is not a comma then break the loop.
+			stmt.GroupBy = append(stmt.GroupBy, expr)
 			if tok, _ = p.scanIgnoreWhitespace(); tok != COMMA {
+				p.unscan()
 				break
 			}
 		}
+	} else {
+		p.unscan()
+	}
 
-		// last token must be )
-		if tok != RIGHTPAR {
-			return nil, fmt.Errorf("found %q, expected )))", lit)
+	// optional HAVING condition
+	if tok, _ = p.scanIgnoreWhitespace(); tok == HAVING {
+		stmt.Having, err = p.parseExpr()
+		if err != nil {
+			return nil, err
 		}
+	} else {
+		p.unscan()
 	}
 
-	// Next token should be a "FROM" keyword.
-	if tok, lit := p.scanIgnoreWhitespace(); tok != FROM {
-		return nil, fmt.Errorf("found %q, expected FROM", lit)
+	// optional ORDER BY
+	if tok, _ = p.scanIgnoreWhitespace(); tok == ORDER {
+		stmt.OrderBy, err = p.parseOrderBy()
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		p.unscan()
 	}
 
-	// Next we should read the table name.
-	tok, lit := p.scanIgnoreWhitespace()
-	if tok != IDENT {
-		return nil, fmt.Errorf("found %q, expected table name", lit)
+	// optional LIMIT n, OFFSET m
+	if tok, lit = p.scanIgnoreWhitespace(); tok == LIMIT {
+		if stmt.Limit != nil {
+			return nil, fmt.Errorf("found %q, cannot use both TOP and LIMIT", lit)
+		}
+		stmt.Limit, err = p.parseCount()
+		if err != nil {
+			return nil, err
+		}
+		tok, _ = p.scanIgnoreWhitespace()
+	}
+	if tok == OFFSET {
+		stmt.Offset, err = p.parseCount()
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		p.unscan()
 	}
-	stmt.TableName = lit
+	return stmt, nil
+}
 
-	// If the next token is not a ; then break the loop.
-	if tok, lit = p.scan(); tok != SEMICOL {
-		return nil, fmt.Errorf("found %q, expected ;", lit)
+// SelectItem is value of select list, e.g. price AS cost
+type SelectItem struct {
+	Expr  Expr
+	Alias string // name given to the value, empty if not given
+}
+
+// name gives name of the value in results
+func (item *SelectItem) name() string {
+	if item.Alias != "" {
+		return item.Alias
 	}
+	return fieldName(item.Expr)
+}
 
-	// Return the successfully parsed statement.
-	return stmt, nil
+// parseSelectItems parses select list, e.g. name, qty AS count, items.price,
+// list in parentheses is same as list without them, e.g. (name, qty)
+func (p *Parser) parseSelectItems() ([]*SelectItem, error) {
+	items := []*SelectItem{}
+	for {
+		expr, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		item := &SelectItem{Expr: expr}
+
+		// optional alias, AS can be left out
+		tok, lit := p.scanIgnoreWhitespace()
+		if tok == AS {
+			if tok, lit = p.scanIgnoreWhitespace(); tok != IDENT {
+				return nil, fmt.Errorf("found %q, expected alias", lit)
+			}
+		}
+		if tok == IDENT {
+			item.Alias = lit
+			tok, _ = p.scanIgnoreWhitespace()
+		}
+		items = append(items, item)
+
+		if tok != COMMA {
+			p.unscan()
+			break
+		}
+	}
+
+	if list, ok := items[0].Expr.(*ListExpr); ok && len(items) == 1 && items[0].Alias == "" {
+		items = nil
+		for _, expr := range list.Items {
+			items = append(items, &SelectItem{Expr: expr})
+		}
+	}
+	return items, nil
+}
+
+// orderByAlias gives statement with ORDER BY alias replaced by value of select list,
+// name given in select list is used before table column of same name
+func (stmt *SelectStatement) orderByAlias(items []*SelectItem) *SelectStatement {
+	var orderBy []*OrderItem
+	for i, order := range stmt.OrderBy {
+		ref, ok := order.Expr.(*ColumnRef)
+		if !ok || ref.Table != "" {
+			continue
+		}
+		for _, item := range items {
+			if item.Alias == "" || item.Alias != ref.Name {
+				continue
+			}
+			if orderBy == nil {
+				orderBy = append([]*OrderItem{}, stmt.OrderBy...)
+			}
+			replaced := *order
+			replaced.Expr = item.Expr
+			orderBy[i] = &replaced
+			break
+		}
+	}
+	if orderBy == nil {
+		return stmt
+	}
+
+	resolved := *stmt
+	resolved.OrderBy = orderBy
+	return &resolved
 }
 
-// Where condisions to match
-type Where struct {
-	OperatorType OperatorType
-	Value        interface{}
+// distinctRows is rows given by SELECT DISTINCT, nil if not distinct
+type distinctRows map[string]bool
+
+// seen tells if row of same values was given before, row is remembered as given
+func (d distinctRows) seen(row *Row) (bool, error) {
+	if d == nil {
+		return false, nil
+	}
+	key := []byte{}
+	for _, col := range row.Columns {
+		var err error
+		key, err = appendValueKey(key, col)
+		if err != nil {
+			return false, err
+		}
+	}
+	if d[string(key)] {
+		return true, nil
+	}
+	d[string(key)] = true
+	return false, nil
 }
 
-// OperatorType for where comparision
-type OperatorType int
+// filter gives rows not seen before
+func (d distinctRows) filter(rows []*Row) ([]*Row, error) {
+	if d == nil {
+		return rows, nil
+	}
+	res := []*Row{}
+	for _, row := range rows {
+		seen, err := d.seen(row)
+		if err != nil {
+			return nil, err
+		}
+		if !seen {
+			res = append(res, row)
+		}
+	}
+	return res, nil
+}
 
-// types of comparisions
-const (
-	OperatorTypeLessThan int = iota
-	OperatorTypeLessThanOrEqual
-	OperatorTypeMoreThan
-	OperatorTypeMoreThanOrEqual
-	OperatorTypeEqual
-	OperatorTypeNotEqual
-)
+// parseCount parses row count of LIMIT, OFFSET or TOP, either number or placeholder
+func (p *Parser) parseCount() (Expr, error) {
+	tok, lit := p.scanIgnoreWhitespace()
+	switch tok {
+	case NUMBER:
+		num, err := strconv.ParseInt(lit, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("found %q, expected non-negative integer", lit)
+		}
+		return &Literal{Value: &Column{Type: ColumnTypeInt, DataInt: num}}, nil
+	case PLACEHOLDER:
+		return p.parseParam(lit)
+	}
+	return nil, fmt.Errorf("found %q, expected row count", lit)
+}
 
-// scanDirRows scan all the records in table dir for rows
-func scanDirRows(folderpath string, tableName string, columns []string, wheres []*Where) ([]*Row, error) {
-	files, err := ioutil.ReadDir(folderpath)
+// evalCount gives row count of LIMIT, OFFSET or TOP, -1 if there is none or it is null
+func evalCount(expr Expr, args []driver.Value) (int64, error) {
+	if expr == nil {
+		return -1, nil
+	}
+	val, err := expr.eval(&evalContext{args: args})
 	if err != nil {
-		return nil, err
+		return 0, err
+	}
+	if val.DataIsNull {
+		return -1, nil
+	}
+	if val.Type != ColumnTypeInt || val.DataInt < 0 {
+		return 0, ErrInvalidLimit
 	}
+	return val.DataInt, nil
+}
 
-	rows := []*Row{}
+// errStopWalk is returned by walkRows callback to stop walking without error
+var errStopWalk = fmt.Errorf("stop walking rows")
 
-	for _, file := range files {
-		filepath := path.Join(folderpath, file.Name())
-		dat, err := ioutil.ReadFile(filepath)
+// scanRows scan all the rows in table heap for rows that match where condition
+func (db *Database) scanRows(table *Table, columns []string, where Expr, args []driver.Value) ([]*Row, error) {
+	rows := []*Row{}
+	err := db.walkRows(table, where, args, nil, func(row *Row) error {
+		row, err := selectColumns(row, columns)
 		if err != nil {
-			fmt.Printf("read row fail - %s  Err: ( %+v )\n", filepath, err)
-			continue
+			return err
 		}
+		rows = append(rows, row)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
 
-		// row decode
-		row := &Row{}
-		dec := gob.NewDecoder(bytes.NewReader(dat))
-		err = dec.Decode(row)
+// walkRows calls fn for every row of table that match where condition,
+// rows are in order of index if given, otherwise in any order.
+// walking stops when fn returns errStopWalk
+func (db *Database) walkRows(table *Table, where Expr, args []driver.Value, order *Index, fn func(row *Row) error) error {
+	match := func(id rowID, dat []byte) error {
+		// row that cannot be read is not skipped, it would be lost silently
+		row, err := decodeRow(table, dat)
 		if err != nil {
-			fmt.Printf("decode row failed - %s  Err: ( %+v )\n", filepath, err)
-			continue
+			return fmt.Errorf("decode row %s of %s: %w", id, table.Name, err)
 		}
+		row.id = id
 
-		// todo do where match
-		// if wheres != nil {
-		// 	for _, where := range wheres {
-		// ??? continue
-		// 	}
-		// }
+		// do where match
+		if ok, err := matchRow(row, where, args); err != nil || !ok {
+			return err
+		}
+		return fn(row)
+	}
 
-		// sort and filter column accordly
-		resCols := []*Column{}
-		for _, colName := range columns {
-			for _, resCol := range row.Columns {
-				if resCol.Name == colName {
-					resCols = append(resCols, resCol)
-				}
+	// use index if where limits indexed column
+	var kr *keyRange
+	var bt *btree
+	var err error
+	if order != nil {
+		bt, err = db.openIndex(table, order)
+		if err != nil {
+			return err
+		}
+		kr, err = whereRange(table.findColumn(order.Columns[0]), where, args)
+		if kr == nil && err == nil {
+			kr = &keyRange{}
+		}
+	} else {
+		kr, bt, err = db.indexRange(table, where, args)
+	}
+	if err != nil {
+		return err
+	}
+	if kr != nil {
+		err = bt.indexScan(kr, func(id rowID) error {
+			dat, err := db.heapGet(table, id)
+			if err != nil {
+				return err
 			}
+			return match(id, dat)
+		})
+	} else {
+		err = db.heapScan(table, match)
+	}
+	if err == errStopWalk {
+		return nil
+	}
+	return err
+}
+
+// projectRow gives row of select list values
+func projectRow(fields []Expr, ctx *evalContext) (*Row, error) {
+	row := &Row{Columns: make([]*Column, len(fields))}
+	if ctx.row != nil {
+		row.TableName = ctx.row.TableName
+		row.id = ctx.row.id
+	}
+	for i, field := range fields {
+		val, err := field.eval(ctx)
+		if err != nil {
+			return nil, err
 		}
-		if len(resCols) != len(columns) {
-			fmt.Printf("invalid result column length - %s\n", filepath)
-			continue
+		row.Columns[i] = val
+	}
+	return row, nil
+}
+
+// fieldName gives name of select list value, column name or aggregate function name
+func fieldName(field Expr) string {
+	switch e := field.(type) {
+	case *ColumnRef:
+		return e.Name
+	case *Aggregate:
+		return strings.ToLower(e.Func)
+	case *Subquery:
+		if len(e.Select.Fields) == 1 {
+			return e.Select.Fields[0].name()
 		}
-		row.Columns = resCols
+	}
+	return field.String()
+}
 
-		rows = append(rows, row)
+// selectColumns gives row with only the columns in given order, error if row does not have them all
+func selectColumns(row *Row, columns []string) (*Row, error) {
+	resCols := []*Column{}
+	for _, colName := range columns {
+		for _, resCol := range row.Columns {
+			if resCol.Name == colName {
+				resCols = append(resCols, resCol)
+			}
+		}
 	}
+	if len(resCols) != len(columns) {
+		return nil, ErrColumnNotExist
+	}
+	row.Columns = resCols
+	return row, nil
+}
 
-	if Verbose >= 2 {
-		fmt.Printf("scanDirRows -> rows %+v\n", rows)
+// matchRow tells if row matches where, nil row matches nothing and nil where matches all
+func matchRow(row *Row, where Expr, args []driver.Value) (bool, error) {
+	if row == nil {
+		return false, nil
+	}
+	if where == nil {
+		return true, nil
+	}
+	val, err := where.eval(&evalContext{row: row, args: args})
+	if err != nil {
+		return false, err
 	}
+	return isTrue(val), nil
+}
 
-	return rows, nil
+// normalizeRow puts row columns in same order as table columns,
+// column missing from the row is null
+func (t *Table) normalizeRow(row *Row) {
+	columns := make([]*Column, len(t.Columns))
+	for i, col := range t.Columns {
+		for _, rowCol := range row.Columns {
+			if rowCol.Name == col.Name {
+				columns[i] = rowCol
+			}
+		}
+		if columns[i] == nil {
+			columns[i] = &Column{Name: col.Name, Type: col.Type, DataIsNull: true}
+		}
+	}
+	row.Columns = columns
 }
@@ -0,0 +1,380 @@
+package furydb
+
+import (
+	"bufio"
+	"bytes"
+	"container/heap"
+	"database/sql/driver"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Note:
+// ORDER BY sorts rows by sort key, value of each order expression encoded by encodeKey joined together,
+// so keys are compared as bytes. Null is the smallest value, it is first in ASC and last in DESC
+// unless NULLS FIRST or NULLS LAST is given. Value of DESC expression has its bytes inverted,
+// encoded values are never prefix of one another, so inverted values compare in reverse.
+// Rows are sorted in memory until they take SortMemory bytes, then the sorted run is written to
+// temp file. Runs are merged while rows are read, rows with same key keep the order they were found in.
+// ORDER BY of index columns in ASC order reads rows in index order instead of sorting.
+
+// SortMemory is how many bytes of rows are sorted in memory before they are written to temp file
+var SortMemory = 4 << 20
+
+// OrderItem is expression of ORDER BY, e.g. name DESC NULLS FIRST
+type OrderItem struct {
+	Expr       Expr
+	Desc       bool
+	NullsFirst bool // null is placed before other values
+}
+
+// String gives order item in sql form
+func (item *OrderItem) String() string {
+	str := item.Expr.String()
+	if item.Desc {
+		str += " DESC"
+	}
+	if item.NullsFirst {
+		return str + " NULLS FIRST"
+	}
+	return str + " NULLS LAST"
+}
+
+// parseOrderBy parses expressions after ORDER BY,
+// e.g. last_name, first_name DESC, age ASC NULLS LAST
+func (p *Parser) parseOrderBy() ([]*OrderItem, error) {
+	if tok, lit := p.scanIgnoreWhitespace(); tok != BY {
+		return nil, fmt.Errorf("found %q, expected BY", lit)
+	}
+
+	items := []*OrderItem{}
+	for {
+		expr, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		item := &OrderItem{Expr: expr}
+
+		tok, lit := p.scanIgnoreWhitespace()
+		if tok == ASC || tok == DESC {
+			item.Desc = tok == DESC
+			tok, lit = p.scanIgnoreWhitespace()
+		}
+		// null is smallest, unless told otherwise
+		item.NullsFirst = !item.Desc
+		if tok == NULLS {
+			tok, lit = p.scanIgnoreWhitespace()
+			place := strings.ToUpper(lit)
+			if tok != IDENT || (place != "FIRST" && place != "LAST") {
+				return nil, fmt.Errorf("found %q, expected FIRST or LAST", lit)
+			}
+			item.NullsFirst = place == "FIRST"
+			tok, _ = p.scanIgnoreWhitespace()
+		}
+		items = append(items, item)
+
+		if tok != COMMA {
+			p.unscan()
+			return items, nil
+		}
+	}
+}
+
+// orderKey gives sort key of row
+func orderKey(items []*OrderItem, ctx *evalContext) ([]byte, error) {
+	key := []byte{}
+	for _, item := range items {
+		val, err := item.Expr.eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if val.DataIsNull {
+			// non-null value starts with 1
+			if item.NullsFirst {
+				key = append(key, 0)
+			} else {
+				key = append(key, 2)
+			}
+			continue
+		}
+
+		enc, err := encodeKey(val)
+		if err != nil {
+			return nil, err
+		}
+		if item.Desc {
+			for i := 1; i < len(enc); i++ {
+				enc[i] = ^enc[i]
+			}
+		}
+		key = append(key, enc...)
+	}
+	return key, nil
+}
+
+// orderIndex gives index that has rows in same order as ORDER BY, nil if there is none
+func (t *Table) orderIndex(items []*OrderItem) *Index {
+	for _, idx := range t.allIndexes() {
+		if len(items) > len(idx.Columns) {
+			continue
+		}
+		match := true
+		for i, item := range items {
+			ref, ok := item.Expr.(*ColumnRef)
+			if !ok || ref.Name != idx.Columns[i] || item.Desc || (!item.NullsFirst && !t.isNotNull(ref.Name)) {
+				match = false
+				break
+			}
+		}
+		if match {
+			return idx
+		}
+	}
+	return nil
+}
+
+// sortEntry is a row to sort
+type sortEntry struct {
+	key []byte // sort key
+	dat []byte // encoded row
+}
+
+// rowSorter sorts rows, rows that do not fit in memory are written to temp files
+type rowSorter struct {
+	items   []*OrderItem
+	args    []driver.Value
+	entries []sortEntry // rows in memory
+	size    int         // bytes of rows in memory
+	runs    []*os.File  // sorted runs written to temp file
+}
+
+// newRowSorter gives sorter of rows
+func newRowSorter(items []*OrderItem, args []driver.Value) *rowSorter {
+	return &rowSorter{items: items, args: args}
+}
+
+// add adds row to be sorted by ORDER BY values of row, out is the row given in sorted order
+func (s *rowSorter) add(row *Row, out *Row) error {
+	key, err := orderKey(s.items, &evalContext{row: row, args: s.args})
+	if err != nil {
+		return err
+	}
+	dat, err := encodeColumns(out.Columns)
+	if err != nil {
+		return err
+	}
+	s.entries = append(s.entries, sortEntry{key: key, dat: dat})
+	s.size += len(key) + len(dat)
+	if s.size >= SortMemory {
+		return s.spill()
+	}
+	return nil
+}
+
+// sortEntries sorts rows in memory, rows with same key keep their order
+func (s *rowSorter) sortEntries() {
+	sort.SliceStable(s.entries, func(i, j int) bool {
+		return bytes.Compare(s.entries[i].key, s.entries[j].key) < 0
+	})
+}
+
+// spill writes sorted rows in memory to temp file
+func (s *rowSorter) spill() error {
+	s.sortEntries()
+
+	f, err := ioutil.TempFile("", "furydb-sort-")
+	if err != nil {
+		return err
+	}
+	s.runs = append(s.runs, f)
+	if Verbose >= 2 {
+		fmt.Printf("sort run %s   rows: %d\n", f.Name(), len(s.entries))
+	}
+
+	w := bufio.NewWriter(f)
+	for _, entry := range s.entries {
+		buf := appendUvarint(nil, uint64(len(entry.key)))
+		buf = append(buf, entry.key...)
+		buf = appendUvarint(buf, uint64(len(entry.dat)))
+		buf = append(buf, entry.dat...)
+		if _, err = w.Write(buf); err != nil {
+			return err
+		}
+	}
+	if err = w.Flush(); err != nil {
+		return err
+	}
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	s.entries = nil
+	s.size = 0
+	return nil
+}
+
+// sorted gives function that gives sorted rows one by one, nil row when there is no more
+func (s *rowSorter) sorted() func() (*Row, error) {
+	s.sortEntries()
+
+	// runs are merged, rows still in memory are last run
+	merge := &sortMerge{}
+	for _, f := range s.runs {
+		merge.runs = append(merge.runs, &sortRun{r: bufio.NewReader(f)})
+	}
+	merge.runs = append(merge.runs, &sortRun{mem: s.entries})
+	for i, run := range merge.runs {
+		run.order = i
+	}
+
+	started := false
+	return func() (*Row, error) {
+		if !started {
+			started = true
+			err := merge.init()
+			if err != nil {
+				return nil, err
+			}
+		}
+		dat, err := merge.next()
+		if err != nil || dat == nil {
+			return nil, err
+		}
+		columns, err := decodeColumns(dat)
+		if err != nil {
+			return nil, err
+		}
+		return &Row{Columns: columns}, nil
+	}
+}
+
+// close removes temp files
+func (s *rowSorter) close() error {
+	var firstErr error
+	for _, f := range s.runs {
+		err := f.Close()
+		if err2 := os.Remove(f.Name()); err == nil {
+			err = err2
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	s.runs = nil
+	s.entries = nil
+	return firstErr
+}
+
+// sortRun is a sorted run of rows, either in temp file or in memory
+type sortRun struct {
+	r     *bufio.Reader
+	mem   []sortEntry
+	cur   sortEntry // current row of run
+	order int       // position of the run, earlier run has rows found earlier
+}
+
+// read reads next row of run into cur, false if run has no more rows
+func (run *sortRun) read() (bool, error) {
+	if run.r == nil {
+		if len(run.mem) == 0 {
+			return false, nil
+		}
+		run.cur, run.mem = run.mem[0], run.mem[1:]
+		return true, nil
+	}
+
+	key, err := readChunk(run.r)
+	if err == io.EOF {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	dat, err := readChunk(run.r)
+	if err != nil {
+		return false, err
+	}
+	run.cur = sortEntry{key: key, dat: dat}
+	return true, nil
+}
+
+// readChunk reads length prefixed bytes
+func readChunk(r *bufio.Reader) ([]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	dat := make([]byte, n)
+	_, err = io.ReadFull(r, dat)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return dat, err
+}
+
+// sortMerge merges sorted runs, it implements heap.Interface with run of smallest row on top
+type sortMerge struct {
+	runs []*sortRun
+}
+
+func (m *sortMerge) Len() int { return len(m.runs) }
+
+func (m *sortMerge) Less(i, j int) bool {
+	cmp := bytes.Compare(m.runs[i].cur.key, m.runs[j].cur.key)
+	if cmp == 0 {
+		return m.runs[i].order < m.runs[j].order
+	}
+	return cmp < 0
+}
+
+func (m *sortMerge) Swap(i, j int) { m.runs[i], m.runs[j] = m.runs[j], m.runs[i] }
+
+func (m *sortMerge) Push(x interface{}) { m.runs = append(m.runs, x.(*sortRun)) }
+
+func (m *sortMerge) Pop() interface{} {
+	run := m.runs[len(m.runs)-1]
+	m.runs = m.runs[:len(m.runs)-1]
+	return run
+}
+
+// init reads first row of every run
+func (m *sortMerge) init() error {
+	runs := m.runs
+	m.runs = nil
+	for _, run := range runs {
+		ok, err := run.read()
+		if err != nil {
+			return err
+		}
+		if ok {
+			m.runs = append(m.runs, run)
+		}
+	}
+	heap.Init(m)
+	return nil
+}
+
+// next gives next encoded row in order, nil when there is no more
+func (m *sortMerge) next() ([]byte, error) {
+	if len(m.runs) == 0 {
+		return nil, nil
+	}
+	run := m.runs[0]
+	dat := run.cur.dat
+
+	ok, err := run.read()
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		heap.Fix(m, 0)
+	} else {
+		heap.Pop(m)
+	}
+	return dat, nil
+}
@@ -0,0 +1,100 @@
+package furydb
+
+import (
+	"database/sql/driver"
+)
+
+// FuryStmt is a prepared statement, query is parsed once and can be executed many times
+type FuryStmt struct {
+	conn       *FuryConn
+	statements []Statement // query can have multiple statements
+	numInput   int         // number of placeholders
+}
+
+// exec executes all statements in order, result of the last statement is returned
+func (s *FuryStmt) exec(args []driver.Value) (*results, error) {
+	if len(args) != s.numInput {
+		return nil, ErrArgumentCountNotMatch
+	}
+	db := s.conn.db
+
+	// failed statement inside transaction leaves the transaction as it was
+	if s.conn.inTx {
+		sp, err := db.savepoint()
+		if err != nil {
+			return nil, err
+		}
+		res, err := s.execAll(args)
+		if err != nil {
+			db.rollbackTo(sp)
+			return nil, err
+		}
+		return res, nil
+	}
+
+	// without transaction, all statements of query run as one
+	err := db.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer db.unlock()
+	err = db.begin()
+	if err != nil {
+		return nil, err
+	}
+	res, err := s.execAll(args)
+	if err != nil {
+		db.rollback()
+		return nil, err
+	}
+	err = db.commit()
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// execAll executes statements one after another
+func (s *FuryStmt) execAll(args []driver.Value) (*results, error) {
+	var res *results
+	var err error
+	for _, stmt := range s.statements {
+		if res != nil {
+			res.Close()
+		}
+		res, err = s.conn.exec(stmt, args)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// Close implements driver.Stmt interface
+func (s *FuryStmt) Close() error {
+	return nil
+}
+
+// NumInput implements driver.Stmt interface
+func (s *FuryStmt) NumInput() int {
+	return s.numInput
+}
+
+// Exec implements driver.Stmt interface
+func (s *FuryStmt) Exec(args []driver.Value) (driver.Result, error) {
+	res, err := s.exec(args)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+	return driver.RowsAffected(len(res.rows)), nil
+}
+
+// Query implements driver.Stmt interface
+func (s *FuryStmt) Query(args []driver.Value) (driver.Rows, error) {
+	res, err := s.exec(args)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
@@ -1,16 +1,16 @@
 package furydb
 
 import (
-	"database/sql"
 	"database/sql/driver"
 	"fmt"
 	"io"
+	"os"
 	"time"
 )
 
 // Note:
-// Table rows are stored separately to make things easier, it may change in the future,
-// but for now, the data will just sits in the filesystem not to save memory.
+// Table rows are stored in pages of heap file per table, see heap.go.
+// The data sits in the filesystem not to use much memory, only recently used pages are cached.
 // So data recall or search are all done base on the hard drive, it will be slow on disk hdd,
 // but should be quick enough base on SSD and OS caching
 
@@ -21,6 +21,13 @@ type Database struct {
 	Tables       []*Table
 	VersionMajor int
 	VersionMinor int
+
+	conns int                // number of driver connections using the database
+	sem   chan struct{}      // exclusive lock, held by one transaction at a time
+	tx    *transaction       // pending writes of running transaction
+	cache map[pageKey][]byte // committed pages read from disk
+	wal   *os.File           // write ahead log
+	dirty map[string]bool    // files changed since last checkpoint
 }
 
 // Table holds schema of individual table
@@ -28,6 +35,17 @@ type Table struct {
 	Name        string
 	Columns     []*Column
 	Constraints []*Constraint
+	Indexes     []*Index
+}
+
+// Index holds schema of table index
+type Index struct {
+	Name     string   // name of index, unique in database
+	Columns  []string // indexed columns in order
+	IsUnique bool     // rows cannot have same values in the columns
+
+	isPrimary    bool // index of primary key, not part of schema
+	isConstraint bool // index of unique constraint, not part of schema
 }
 
 // Constraint holds table column constraint
@@ -41,6 +59,8 @@ type Constraint struct {
 	IsForeignKey      bool       // is this a foreign key?
 	ForeignTable      string     // foreign key table
 	ForeignColumn     string     // foreign key column
+	OnDelete          string     // foreign key action when referenced row is deleted, e.g. CASCADE
+	OnUpdate          string     // foreign key action when referenced row is updated, e.g. SET NULL
 	UseDefaultData    bool       // does it have default value
 	DefaultDataBool   bool       // default value in type bool
 	DefaultDataInt    int64      // default value in type int64
@@ -86,7 +106,8 @@ type Column struct {
 type Row struct {
 	TableName string    // name of the table row refers to
 	Columns   []*Column // holds column data
-	Deleted   bool      // if deleted, will be skipped during scan
+
+	id rowID // where the row is stored
 }
 
 // results implements driver.Rows
@@ -95,11 +116,20 @@ type results struct {
 	rows        []*Row
 	cursor      int // increment after each Next()
 	columns     []string
+	nullable    []bool // tells if column can be null, by position
+
+	more  func() (*Row, error) // gives rows after rows one by one, nil row when no more, e.g. sorted rows
+	close func() error         // releases what more uses
 }
 
 // Close implements driver.Rows
 func (r *results) Close() error {
-	// return fmt.Errorf("not implemented")
+	r.more = nil
+	if r.close != nil {
+		fn := r.close
+		r.close = nil
+		return fn()
+	}
 	return nil
 }
 
@@ -112,7 +142,19 @@ func (r *results) Columns() []string {
 func (r *results) Next(dest []driver.Value) error {
 	// eod of record
 	if r.cursor >= len(r.rows) {
-		return io.EOF
+		if r.more == nil {
+			return io.EOF
+		}
+		row, err := r.more()
+		if err != nil {
+			return err
+		}
+		if row == nil {
+			r.more = nil
+			return io.EOF
+		}
+		r.rows = append(r.rows[:0], row)
+		r.cursor = 0
 	}
 
 	if Verbose >= 2 {
@@ -120,101 +162,32 @@ func (r *results) Next(dest []driver.Value) error {
 		fmt.Printf("next (%d) []driver.Value %+v %+v\n", r.cursor, r.Columns(), dest)
 	}
 
-	constraints := r.tableSchema.Constraints
-
 	row := r.rows[r.cursor]
 	if Verbose >= 2 {
 		fmt.Printf("next (%d) row %+v\n", r.cursor, row)
 	}
 	for i, col := range row.Columns {
-		// figure out constraints
-		var isNullable bool
-		for _, cstr := range constraints {
-			if cstr.ColumnName != col.Name {
-				continue
-			}
-			if !cstr.IsNotNull {
-				isNullable = true
-			}
+		// null is nil, so it can be scanned to sql.NullString etc
+		if col.DataIsNull {
+			dest[i] = nil
+			continue
 		}
-		// todo implement rest of the nullable support
-		// sql.RowsColumnTypeNullable
-		// sql.ColumnTypeNullable
-		// etc
-		isNullable = false
 
 		switch col.Type {
 		case ColumnTypeBool:
-			if isNullable {
-				dest[i] = sql.NullBool{
-					Bool: col.DataBool,
-					// todo valid for now
-					Valid: true,
-				}
-			} else {
-				dest[i] = driver.Value(col.DataBool)
-			}
+			dest[i] = driver.Value(col.DataBool)
 		case ColumnTypeInt:
-			if isNullable {
-				dest[i] = sql.NullInt64{
-					Int64: col.DataInt,
-					// todo valid for now
-					Valid: true,
-				}
-			} else {
-				dest[i] = driver.Value(col.DataInt)
-			}
+			dest[i] = driver.Value(col.DataInt)
 		case ColumnTypeFloat:
-			if isNullable {
-				dest[i] = sql.NullFloat64{
-					Float64: col.DataFloat,
-					// todo valid for now
-					Valid: true,
-				}
-			} else {
-				dest[i] = driver.Value(col.DataFloat)
-			}
+			dest[i] = driver.Value(col.DataFloat)
 		case ColumnTypeString:
-			if isNullable {
-				fmt.Println(".......................")
-				dest[i] = driver.Value(sql.NullString{
-					String: col.DataString,
-					// todo valid for now
-					Valid: true,
-				})
-			} else {
-				dest[i] = driver.Value(col.DataString)
-			}
+			dest[i] = driver.Value(col.DataString)
 		case ColumnTypeTime:
-			if isNullable {
-				dest[i] = sql.NullTime{
-					Time: col.DataTime,
-					// todo valid for now
-					Valid: true,
-				}
-			} else {
-				dest[i] = driver.Value(col.DataTime)
-			}
+			dest[i] = driver.Value(col.DataTime)
 		case ColumnTypeBytes:
-			if isNullable {
-				dest[i] = NullBytes{
-					Bytes: col.DataBytes,
-					// todo valid for now
-					Valid: true,
-				}
-			} else {
-				dest[i] = driver.Value(col.DataBytes)
-			}
+			dest[i] = driver.Value(col.DataBytes)
 		case ColumnTypeUUID:
-			if isNullable {
-				dest[i] = NullUUID{
-					UUID: col.DataUUID,
-					// todo valid for now
-					Valid: true,
-				}
-			} else {
-				dest[i] = driver.Value(UUIDBinToStr(col.DataUUID))
-			}
+			dest[i] = driver.Value(UUIDBinToStr(col.DataUUID))
 		default:
 			return ErrUnknownColumnType
 		}
@@ -225,6 +198,14 @@ func (r *results) Next(dest []driver.Value) error {
 	return nil
 }
 
+// ColumnTypeNullable implements driver.RowsColumnTypeNullable
+func (r *results) ColumnTypeNullable(index int) (nullable, ok bool) {
+	if index >= len(r.nullable) {
+		return false, false
+	}
+	return r.nullable[index], true
+}
+
 // NullBytes for nullable bytes
 type NullBytes struct {
 	Bytes []byte
@@ -234,23 +215,15 @@ type NullBytes struct {
 // Scan implements the Scanner interface
 func (n *NullBytes) Scan(value interface{}) error {
 	if value == nil {
-		n.Bytes, n.Valid = []byte{}, false
+		n.Bytes, n.Valid = nil, false
 		return nil
 	}
 	n.Valid = true
-	// return convertAssign(&n.Bytes, value)
-
-	// see if this will work
-	dat, ok := value.([]byte)
-	if !ok {
-		return fmt.Errorf("cannot Scan NullBytes value")
-	}
-	copy(n.Bytes, dat)
-	return nil
+	return convertAssign(&n.Bytes, value)
 }
 
 // Value implements the Valuer interface
-func (n *NullBytes) Value() (driver.Value, error) {
+func (n NullBytes) Value() (driver.Value, error) {
 	if !n.Valid {
 		return nil, nil
 	}
@@ -269,34 +242,35 @@ func (n *NullUUID) Scan(value interface{}) error {
 		n.UUID, n.Valid = [16]byte{}, false
 		return nil
 	}
-	n.Valid = true
-	// return convertAssign(&n.UUID, value)
 
 	// convert hex string (uuid) to byte
-	dat, ok := value.(string)
-	if !ok {
-		return fmt.Errorf("not a string")
+	var dat string
+	switch v := value.(type) {
+	case string:
+		dat = v
+	case []byte:
+		dat = string(v)
+	default:
+		return fmt.Errorf("cannot Scan NullUUID value %T", value)
 	}
 	b, err := UUIDStrToBin(dat)
 	if err != nil {
 		return err
 	}
 
-	// in-place replace
-	copy(n.UUID[:], b[:])
+	n.UUID, n.Valid = b, true
 	return nil
 }
 
 // Value implements the Valuer interface
-func (n *NullUUID) Value() (driver.Value, error) {
+func (n NullUUID) Value() (driver.Value, error) {
 	if !n.Valid {
-		return "00000000-0000-0000-0000-000000000000", nil
+		return nil, nil
 	}
-
 	return UUIDBinToStr(n.UUID), nil
 }
 
 // String display UUID in string format
-func (n *NullUUID) String() string {
+func (n NullUUID) String() string {
 	return UUIDBinToStr(n.UUID)
 }
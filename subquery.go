@@ -0,0 +1,397 @@
+package furydb
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strings"
+)
+
+// Note:
+// Subquery is resolved against its own FROM tables first, then against tables of the query it is in,
+// column of outer query makes the subquery correlated. Correlated subquery is run again for every row
+// of outer query, the row is put in scope of outer query so the column reads its value from there.
+// Subquery that is not correlated is run once per statement and its rows are reused,
+// IN looks values up by hash when they are all of same type.
+// Column of outer query is constant while subquery runs, so it can limit index range like a placeholder.
+// Derived table, FROM (SELECT ...) AS t, is run when its rows are walked and kept in memory.
+
+// Subquery is SELECT used as value, e.g. (SELECT MAX(price) FROM items)
+type Subquery struct {
+	Select *SelectStatement
+	query  *selectQuery
+	outer  *scope // scope of query the subquery is in
+	cache  []*Row // rows of subquery that is not correlated, nil until run
+	set    *valueSet
+}
+
+// String implements Expr
+func (e *Subquery) String() string {
+	return "(" + e.Select.String() + ")"
+}
+
+func (e *Subquery) bind(s *scope) error {
+	err := e.prepare(s)
+	if err != nil {
+		return err
+	}
+	if len(e.query.columns) != 1 {
+		return ErrSubqueryColumns
+	}
+	return nil
+}
+
+// prepare resolves columns of subquery, subquery can give any number of columns
+func (e *Subquery) prepare(s *scope) error {
+	q, err := s.db.prepareSelect(e.Select, s)
+	if err != nil {
+		return err
+	}
+	e.query, e.outer, e.cache, e.set = q, s, nil, nil
+	return nil
+}
+
+func (e *Subquery) eval(ctx *evalContext) (*Column, error) {
+	rows, err := e.rows(ctx)
+	if err != nil {
+		return nil, err
+	}
+	switch len(rows) {
+	case 0:
+		return &Column{DataIsNull: true}, nil
+	case 1:
+		return rows[0].Columns[0], nil
+	}
+	return nil, ErrSubqueryRows
+}
+
+// rows runs subquery for row being evaluated
+func (e *Subquery) rows(ctx *evalContext) ([]*Row, error) {
+	if e.cache != nil {
+		return e.cache, nil
+	}
+	e.outer.row = ctx.row
+	rows, err := e.query.rows(ctx.args)
+	if err != nil {
+		return nil, err
+	}
+	if !e.query.scope.correlated {
+		e.cache = rows
+	}
+	return rows, nil
+}
+
+// parseSubquery parses SELECT after the opening (, e.g. SELECT id FROM users)
+func (p *Parser) parseSubquery() (*SelectStatement, error) {
+	stmt, err := p.parseQuery()
+	if err != nil {
+		return nil, err
+	}
+	if tok, lit := p.scanIgnoreWhitespace(); tok != RIGHTPAR {
+		return nil, fmt.Errorf("found %q, expected )", lit)
+	}
+	return stmt, nil
+}
+
+// ExistsExpr tells if subquery gives any row, e.g. EXISTS (SELECT 1 FROM orders WHERE user_id = users.id)
+type ExistsExpr struct {
+	Subquery *Subquery
+}
+
+// String implements Expr
+func (e *ExistsExpr) String() string {
+	return "EXISTS " + e.Subquery.String()
+}
+
+func (e *ExistsExpr) bind(s *scope) error {
+	return e.Subquery.prepare(s)
+}
+
+func (e *ExistsExpr) eval(ctx *evalContext) (*Column, error) {
+	rows, err := e.Subquery.rows(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &Column{Type: ColumnTypeBool, DataBool: len(rows) > 0}, nil
+}
+
+// InExpr tells if value is one of values given by subquery or list,
+// e.g. id NOT IN (SELECT user_id FROM orders), kind IN ('cat', 'dog')
+type InExpr struct {
+	Expr     Expr
+	Not      bool
+	Subquery *Subquery // nil if values are list
+	List     []Expr
+}
+
+// String implements Expr
+func (e *InExpr) String() string {
+	op := " IN "
+	if e.Not {
+		op = " NOT IN "
+	}
+	if e.Subquery == nil {
+		return "(" + e.Expr.String() + op + (&ListExpr{Items: e.List}).String() + ")"
+	}
+	return "(" + e.Expr.String() + op + e.Subquery.String() + ")"
+}
+
+func (e *InExpr) bind(s *scope) error {
+	err := e.Expr.bind(s)
+	if err != nil {
+		return err
+	}
+	if e.Subquery == nil {
+		return (&ListExpr{Items: e.List}).bind(s)
+	}
+	return e.Subquery.bind(s)
+}
+
+func (e *InExpr) eval(ctx *evalContext) (*Column, error) {
+	val, err := e.Expr.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if e.Subquery == nil {
+		values := make([]*Column, len(e.List))
+		for i, item := range e.List {
+			values[i], err = item.eval(ctx)
+			if err != nil {
+				return nil, err
+			}
+		}
+		res, err := inValues(val, values)
+		return e.negate(res, err)
+	}
+	rows, err := e.Subquery.rows(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var res *Column
+	if set := e.Subquery.valueSet(); set != nil && set.typ == val.Type && !val.DataIsNull {
+		res, err = set.lookup(val)
+	} else {
+		values := make([]*Column, len(rows))
+		for i, row := range rows {
+			values[i] = row.Columns[0]
+		}
+		res, err = inValues(val, values)
+	}
+	return e.negate(res, err)
+}
+
+// negate negates result of IN for NOT IN, null stays null
+func (e *InExpr) negate(res *Column, err error) (*Column, error) {
+	if err != nil || !e.Not || res.DataIsNull {
+		return res, err
+	}
+	return &Column{Type: ColumnTypeBool, DataBool: !res.DataBool}, nil
+}
+
+// parseIn parses IN after value, e.g. IN (SELECT user_id FROM orders) or IN (1, 2, 3)
+func (p *Parser) parseIn(lhs Expr, not bool) (Expr, error) {
+	if tok, lit := p.scanIgnoreWhitespace(); tok != LEFTPAR {
+		return nil, fmt.Errorf("found %q, expected (", lit)
+	}
+	if tok, _ := p.scanIgnoreWhitespace(); tok != SELECT {
+		p.unscan()
+		list, err := p.parseArgs()
+		if err != nil {
+			return nil, err
+		}
+		if len(list) == 0 {
+			return nil, fmt.Errorf("found \")\", expected value")
+		}
+		return &InExpr{Expr: lhs, Not: not, List: list}, nil
+	}
+	p.unscan()
+	stmt, err := p.parseSubquery()
+	if err != nil {
+		return nil, err
+	}
+	return &InExpr{Expr: lhs, Not: not, Subquery: &Subquery{Select: stmt}}, nil
+}
+
+// inValues tells if value equals one of values, null if value is null
+// or if no value equals and one of values is null
+func inValues(val *Column, values []*Column) (*Column, error) {
+	if len(values) == 0 {
+		return &Column{Type: ColumnTypeBool, DataBool: false}, nil
+	}
+	if val.DataIsNull {
+		return nullBool(), nil
+	}
+
+	hasNull := false
+	for _, v := range values {
+		if v.DataIsNull {
+			hasNull = true
+			continue
+		}
+		cmp, err := compareColumns(val, v)
+		if err != nil {
+			return nil, err
+		}
+		if cmp == 0 {
+			return &Column{Type: ColumnTypeBool, DataBool: true}, nil
+		}
+	}
+	if hasNull {
+		return nullBool(), nil
+	}
+	return &Column{Type: ColumnTypeBool, DataBool: false}, nil
+}
+
+// valueSet is values of subquery by key, values are all of one type
+type valueSet struct {
+	typ     ColumnType
+	keys    map[string]bool
+	hasNull bool
+}
+
+// valueSet gives values of subquery that is not correlated, nil if values are of more than one type
+func (e *Subquery) valueSet() *valueSet {
+	if e.set != nil || e.cache == nil || len(e.cache) == 0 {
+		return e.set
+	}
+
+	set := &valueSet{keys: map[string]bool{}}
+	for _, row := range e.cache {
+		val := row.Columns[0]
+		if val.DataIsNull {
+			set.hasNull = true
+			continue
+		}
+		if set.typ != 0 && set.typ != val.Type {
+			return nil
+		}
+		set.typ = val.Type
+		key, err := encodeKey(val)
+		if err != nil {
+			return nil
+		}
+		set.keys[string(key)] = true
+	}
+	e.set = set
+	return set
+}
+
+// lookup tells if non-null value of type of the set is in set, with same result as inValues
+func (set *valueSet) lookup(val *Column) (*Column, error) {
+	key, err := encodeKey(val)
+	if err != nil {
+		return nil, err
+	}
+	if set.keys[string(key)] {
+		return &Column{Type: ColumnTypeBool, DataBool: true}, nil
+	}
+	if set.hasNull {
+		return nullBool(), nil
+	}
+	return &Column{Type: ColumnTypeBool, DataBool: false}, nil
+}
+
+// rows runs the query and gives all rows
+func (q *selectQuery) rows(args []driver.Value) ([]*Row, error) {
+	res, err := q.run(args)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+
+	rows := append([]*Row{}, res.rows...)
+	for res.more != nil {
+		row, err := res.more()
+		if err != nil {
+			return nil, err
+		}
+		if row == nil {
+			break
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// table gives schema of rows given by query, for derived table,
+// column that is not table column has no type
+func (q *selectQuery) table(name string) *Table {
+	table := &Table{Name: name}
+	for i, field := range q.fields {
+		col := &Column{Name: q.columns[i]}
+		if ref, ok := field.(*ColumnRef); ok && ref.outer == nil {
+			col.Type = q.scope.column(ref.index).Type
+		}
+		table.Columns = append(table.Columns, col)
+	}
+	return table
+}
+
+// String returns the statement in sql form
+func (stmt *SelectStatement) String() string {
+	var b strings.Builder
+	b.WriteString("SELECT ")
+	if stmt.Distinct {
+		b.WriteString("DISTINCT ")
+	}
+	if stmt.FieldsAll {
+		b.WriteString("*")
+	}
+	for i, item := range stmt.Fields {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(item.Expr.String())
+		if item.Alias != "" {
+			b.WriteString(" AS " + item.Alias)
+		}
+	}
+
+	b.WriteString(" FROM " + tableRefString(stmt.TableName, stmt.Subquery, stmt.TableAlias))
+	for _, join := range stmt.Joins {
+		b.WriteString(" " + join.Type + " JOIN " + tableRefString(join.TableName, join.Subquery, join.Alias))
+		if join.On != nil {
+			b.WriteString(" ON " + join.On.String())
+		}
+	}
+	if stmt.Where != nil {
+		b.WriteString(" WHERE " + stmt.Where.String())
+	}
+	for i, expr := range stmt.GroupBy {
+		if i == 0 {
+			b.WriteString(" GROUP BY ")
+		} else {
+			b.WriteString(", ")
+		}
+		b.WriteString(expr.String())
+	}
+	if stmt.Having != nil {
+		b.WriteString(" HAVING " + stmt.Having.String())
+	}
+	for i, item := range stmt.OrderBy {
+		if i == 0 {
+			b.WriteString(" ORDER BY ")
+		} else {
+			b.WriteString(", ")
+		}
+		b.WriteString(item.String())
+	}
+	if stmt.Limit != nil {
+		b.WriteString(" LIMIT " + stmt.Limit.String())
+	}
+	if stmt.Offset != nil {
+		b.WriteString(" OFFSET " + stmt.Offset.String())
+	}
+	return b.String()
+}
+
+// tableRefString gives table of FROM in sql form
+func tableRefString(name string, sub *SelectStatement, alias string) string {
+	if sub != nil {
+		name = "(" + sub.String() + ")"
+	}
+	if alias != "" {
+		return name + " AS " + alias
+	}
+	return name
+}
@@ -10,8 +10,12 @@ const (
 	WS
 
 	// Literals
-	IDENT // main
-	VALUE // sql value; 'bla', 1, 1.23
+	IDENT  // main
+	VALUE  // sql value; 'bla', 1, 1.23
+	NUMBER // 1, 1.23
+	TEXT   // 'bla'
+
+	PLACEHOLDER // ? or $1
 
 	// Misc characters
 	ASTERISK  // *
@@ -21,6 +25,21 @@ const (
 	SINGLEQUO // '
 	DOUBLEQUO // "
 	SEMICOL   // ;
+	DOT       // .
+
+	// Operators
+	EQ  // =
+	NEQ // <> or !=
+	LT  // <
+	LTE // <=
+	GT  // >
+	GTE // >=
+
+	PLUS    // +
+	MINUS   // -
+	SLASH   // /
+	PERCENT // %
+	CONCAT  // ||
 
 	// Keywords
 	// sql create table
@@ -33,6 +52,51 @@ const (
 	// sql select
 	SELECT
 	FROM
+	WHERE
+	ORDER
+	BY
+	ASC
+	DESC
+	NULLS
+	LIMIT
+	OFFSET
+	TOP
+	DISTINCT
+	GROUP
+	HAVING
+	AS
+	JOIN
+	INNER
+	LEFT
+	RIGHT
+	CROSS
+	OUTER
+	IN
+	EXISTS
+	CASE
+	WHEN
+	THEN
+	ELSE
+	END
+	CAST
+	IS
+	LIKE
+	ILIKE
+	BETWEEN
+	ESCAPE
+	// sql update
+	UPDATE
+	SET
+	// sql delete
+	DELETE
+	// sql index
+	INDEX
+	ON
+	DROP
+	AND
+	OR
+	TRUE
+	FALSE
 
 	// Column Types
 	BOOL
@@ -44,7 +108,13 @@ const (
 	UUID
 
 	// Constraints
-	NOTNULL
-	PRIMARYKEY
-	FOREIGNKEY
+	CONSTRAINT
+	PRIMARY
+	FOREIGN
+	KEY
+	REFERENCES
+	UNIQUE
+	NOT
+	NULL
+	DEFAULT
 )
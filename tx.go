@@ -0,0 +1,223 @@
+package furydb
+
+import (
+	"bytes"
+	"encoding/gob"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"time"
+)
+
+// Note:
+// Transaction keeps all the writes in memory until commit, reads go through the pending writes
+// so the transaction sees its own changes. On commit the writes are put into write ahead log
+// together with commit record, see wal.go, so either all or none of the changes are kept.
+
+// transaction holds pending writes, keyed by path relative to database folder and page
+type transaction struct {
+	files map[pageKey]*walEntry
+	dirs  []string   // folders made by transaction, removed if it is rolled back
+	start *savepoint // state before transaction
+}
+
+// savepoint is a state of transaction that can be gone back to
+type savepoint struct {
+	files  map[pageKey]*walEntry
+	tables []byte // encoded schema tables
+	dirs   int    // number of folders made before savepoint
+}
+
+// lock waits for exclusive access to the database
+func (db *Database) lock() error {
+	select {
+	case db.sem <- struct{}{}:
+		return nil
+	case <-time.After(LockTimeout):
+		return ErrDatabaseLocked
+	}
+}
+
+// unlock gives up exclusive access to the database
+func (db *Database) unlock() {
+	<-db.sem
+}
+
+// begin starts transaction, database must be locked
+func (db *Database) begin() error {
+	if db.tx != nil {
+		return ErrTransactionExist
+	}
+	db.tx = &transaction{files: map[pageKey]*walEntry{}}
+	sp, err := db.savepoint()
+	if err != nil {
+		db.tx = nil
+		return err
+	}
+	db.tx.start = sp
+	return nil
+}
+
+// savepoint saves current state of transaction
+func (db *Database) savepoint() (*savepoint, error) {
+	if db.tx == nil {
+		return nil, ErrTransactionNotExist
+	}
+	tables, err := encode(db.Tables)
+	if err != nil {
+		return nil, err
+	}
+	sp := &savepoint{
+		files:  map[pageKey]*walEntry{},
+		tables: tables,
+		dirs:   len(db.tx.dirs),
+	}
+	for k, v := range db.tx.files {
+		sp.files[k] = v
+	}
+	return sp, nil
+}
+
+// rollbackTo goes back to state of savepoint
+func (db *Database) rollbackTo(sp *savepoint) error {
+	if db.tx == nil {
+		return ErrTransactionNotExist
+	}
+	err := db.restoreTables(sp)
+	if err != nil {
+		return err
+	}
+	db.tx.files = sp.files
+	removeDirs(db.tx.dirs[sp.dirs:])
+	db.tx.dirs = db.tx.dirs[:sp.dirs]
+	return nil
+}
+
+// restoreTables puts back schema tables saved in savepoint
+func (db *Database) restoreTables(sp *savepoint) error {
+	tables := []*Table{}
+	dec := gob.NewDecoder(bytes.NewReader(sp.tables))
+	err := dec.Decode(&tables)
+	if err != nil {
+		return err
+	}
+	db.Tables = tables
+	return nil
+}
+
+// commit makes pending writes of transaction permanent
+func (db *Database) commit() error {
+	if db.tx == nil {
+		return ErrTransactionNotExist
+	}
+	tx := db.tx
+	db.tx = nil
+
+	err := db.writeLog(tx)
+	if err != nil {
+		// in memory schema back to what is on disk
+		db.restoreTables(tx.start)
+		removeDirs(tx.dirs)
+		return err
+	}
+	return nil
+}
+
+// writeLog writes pending writes to log, then applies them to the files
+func (db *Database) writeLog(tx *transaction) error {
+	// write in stable order
+	entries := []*walEntry{}
+	for _, entry := range tx.files {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Path != entries[j].Path {
+			return entries[i].Path < entries[j].Path
+		}
+		return entries[i].Page < entries[j].Page
+	})
+
+	return db.logCommit(entries)
+}
+
+// rollback throws away pending writes of transaction
+func (db *Database) rollback() error {
+	if db.tx == nil {
+		return ErrTransactionNotExist
+	}
+	// schema may have been changed in memory
+	err := db.rollbackTo(db.tx.start)
+	db.tx = nil
+	return err
+}
+
+// writeFile encodes data into file relative to database folder, returns written size
+func (db *Database) writeFile(relpath string, dat interface{}) (int, error) {
+	data, err := encode(dat)
+	if err != nil {
+		return 0, err
+	}
+	entry := &walEntry{Path: relpath, Page: -1, Data: data}
+	if db.tx == nil {
+		return len(data), db.logCommit([]*walEntry{entry})
+	}
+	db.tx.files[pageKey{relpath, -1}] = entry
+	return len(data), nil
+}
+
+// readFile reads file relative to database folder
+func (db *Database) readFile(relpath string) ([]byte, error) {
+	if db.tx != nil {
+		if entry, ok := db.tx.files[pageKey{relpath, -1}]; ok {
+			if entry.Remove {
+				return nil, os.ErrNotExist
+			}
+			return entry.Data, nil
+		}
+	}
+	return ioutil.ReadFile(path.Join(db.Folderpath, relpath))
+}
+
+// removeFile removes file relative to database folder
+func (db *Database) removeFile(relpath string) error {
+	entry := &walEntry{Path: relpath, Page: -1, Remove: true}
+	if db.tx == nil {
+		return db.logCommit([]*walEntry{entry})
+	}
+	// pending pages of the file are gone too
+	for key := range db.tx.files {
+		if key.path == relpath {
+			delete(db.tx.files, key)
+		}
+	}
+	db.tx.files[pageKey{relpath, -1}] = entry
+	return nil
+}
+
+// makeDir makes folder relative to database folder, folder made in transaction is removed on rollback
+func (db *Database) makeDir(relpath string) error {
+	dirpath := path.Join(db.Folderpath, relpath)
+	_, err := os.Stat(dirpath)
+	if err == nil {
+		return nil
+	}
+	if !os.IsNotExist(err) {
+		return err
+	}
+	err = os.MkdirAll(dirpath, 0755)
+	if err != nil {
+		return err
+	}
+	if db.tx != nil {
+		db.tx.dirs = append(db.tx.dirs, dirpath)
+	}
+	return nil
+}
+
+// removeDirs removes folders made by transaction, folder that got files is kept
+func removeDirs(dirs []string) {
+	for i := len(dirs) - 1; i >= 0; i-- {
+		os.Remove(dirs[i])
+	}
+}
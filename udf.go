@@ -0,0 +1,343 @@
+package furydb
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Note:
+// Go function registered by RegisterFunc is scalar function and aggregate registered by
+// RegisterAggregate is used same as built-in aggregate, they are shared by all databases of the driver.
+// Arguments and results are mapped by reflection, go type gives column type:
+// bool is BOOL, int and uint types are INT, float types are FLOAT, string is STRING,
+// time.Time is TIME, []byte is BYTES and [16]byte is UUID, named types of them too.
+// Pointer of them takes or gives null, function with other argument gives null for null argument.
+// Name cannot be of built-in function and function cannot be registered again.
+
+// registered functions by upper case name
+var (
+	userFuncsMu      sync.RWMutex
+	userFuncs        = map[string]*scalarFunc{}
+	userAggregates   = map[string]*userAggregate{}
+	reservedFuncs    = map[string]bool{"COALESCE": true, "NULLIF": true, "EXTRACT": true}
+	timeType         = reflect.TypeOf(time.Time{})
+	bytesType        = reflect.TypeOf([]byte{})
+	uuidType         = reflect.TypeOf([16]byte{})
+	errorType        = reflect.TypeOf((*error)(nil)).Elem()
+	errInvalidResult = fmt.Errorf("%w: must give one value, optionally followed by error", ErrInvalidFunc)
+)
+
+// userAggregate is aggregate made of go type, new value is made for every group,
+// Step is called with every value and Done gives result
+type userAggregate struct {
+	newAgg  reflect.Value // func() T
+	argType ColumnType    // type of value of Step
+	ret     ColumnType    // type of result of Done
+}
+
+// RegisterFunc makes go function callable in sql by name, it can give error as last result, e.g.
+//	furydb.RegisterFunc("slugify", func(s string) string { ... })
+//	furydb.RegisterFunc("distance", func(lat1, lng1, lat2, lng2 float64) (float64, error) { ... })
+func RegisterFunc(name string, fn interface{}) error {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func {
+		return fmt.Errorf("%w: %T is not function", ErrInvalidFunc, fn)
+	}
+	t := v.Type()
+
+	// variadic function can be called without the last argument
+	sf := &scalarFunc{variadic: t.IsVariadic()}
+	params := make([]reflect.Type, t.NumIn())
+	for i := range params {
+		params[i] = t.In(i)
+		if sf.variadic && i == len(params)-1 {
+			params[i] = params[i].Elem()
+			sf.optional = 1
+		}
+		typ, ok := goColumnType(params[i])
+		if !ok {
+			return fmt.Errorf("%w: argument %d of type %s", ErrInvalidFunc, i+1, params[i])
+		}
+		if params[i].Kind() == reflect.Ptr {
+			sf.takeNull = true
+		}
+		sf.args = append(sf.args, typ)
+	}
+	ret, err := resultType(t)
+	if err != nil {
+		return err
+	}
+	sf.ret = ret
+
+	sf.call = func(args []*Column) (*Column, error) {
+		in := make([]reflect.Value, len(args))
+		for i, arg := range args {
+			param := params[len(params)-1]
+			if i < len(params) {
+				param = params[i]
+			}
+			if arg.DataIsNull && param.Kind() != reflect.Ptr {
+				return &Column{Type: sf.ret, DataIsNull: true}, nil
+			}
+			val, err := columnToGo(arg, param)
+			if err != nil {
+				return nil, err
+			}
+			in[i] = val
+		}
+		out, err := callFunc(v, in)
+		if err != nil {
+			return nil, err
+		}
+		return resultColumn(out, sf.ret)
+	}
+
+	return addUserFunc(name, sf, nil)
+}
+
+// RegisterAggregate makes aggregate callable in sql by name, newAgg is func() T that gives new
+// aggregate for every group, T has methods Step(value) that can give error,
+// and Done() that gives result, optionally followed by error, e.g.
+//	furydb.RegisterAggregate("product", func() *Product { return &Product{value: 1} })
+// Null is not aggregated, same as built-in aggregates.
+func RegisterAggregate(name string, newAgg interface{}) error {
+	v := reflect.ValueOf(newAgg)
+	if v.Kind() != reflect.Func || v.Type().NumIn() != 0 || v.Type().NumOut() != 1 {
+		return fmt.Errorf("%w: %T is not func() T", ErrInvalidFunc, newAgg)
+	}
+	t := v.Type().Out(0)
+
+	step, ok := t.MethodByName("Step")
+	if !ok || step.Type.NumIn() != 2 || step.Type.NumOut() > 1 ||
+		step.Type.NumOut() == 1 && step.Type.Out(0) != errorType {
+		return fmt.Errorf("%w: %s has no method Step(value) [error]", ErrInvalidFunc, t)
+	}
+	argType, ok := goColumnType(step.Type.In(1))
+	if !ok || step.Type.In(1).Kind() == reflect.Ptr {
+		return fmt.Errorf("%w: argument of Step of type %s", ErrInvalidFunc, step.Type.In(1))
+	}
+	done, ok := t.MethodByName("Done")
+	if !ok || done.Type.NumIn() != 1 {
+		return fmt.Errorf("%w: %s has no method Done()", ErrInvalidFunc, t)
+	}
+	ret, err := resultType(done.Type)
+	if err != nil {
+		return err
+	}
+
+	return addUserFunc(name, nil, &userAggregate{newAgg: v, argType: argType, ret: ret})
+}
+
+// addUserFunc adds registered function or aggregate, name must not be used by other function
+func addUserFunc(name string, sf *scalarFunc, agg *userAggregate) error {
+	// name must be read as function name, not keyword
+	tok, lit := NewScanner(strings.NewReader(name)).Scan()
+	if tok != IDENT || lit != name {
+		return fmt.Errorf("%w: name %q", ErrInvalidFunc, name)
+	}
+
+	userFuncsMu.Lock()
+	defer userFuncsMu.Unlock()
+
+	fn := strings.ToUpper(name)
+	if reservedFuncs[fn] || aggregateFuncs[fn] || scalarFuncs[fn] != nil || userFuncs[fn] != nil || userAggregates[fn] != nil {
+		return ErrFuncExist
+	}
+	if sf != nil {
+		userFuncs[fn] = sf
+	} else {
+		userAggregates[fn] = agg
+	}
+	return nil
+}
+
+// lookupFunc gives scalar function or user aggregate by upper case name, both nil if there is none
+func lookupFunc(fn string) (*scalarFunc, *userAggregate) {
+	if sf, ok := scalarFuncs[fn]; ok {
+		return sf, nil
+	}
+	userFuncsMu.RLock()
+	defer userFuncsMu.RUnlock()
+	return userFuncs[fn], userAggregates[fn]
+}
+
+// step aggregates value to aggregate made by newAgg
+func (ua *userAggregate) step(agg reflect.Value, val *Column) error {
+	val, err := convertArg(val, ua.argType)
+	if err != nil {
+		return err
+	}
+	arg, err := columnToGo(val, agg.MethodByName("Step").Type().In(0))
+	if err != nil {
+		return err
+	}
+	out, err := callFunc(agg.MethodByName("Step"), []reflect.Value{arg})
+	if err != nil {
+		return err
+	}
+	if len(out) > 0 && !out[0].IsNil() {
+		return out[0].Interface().(error)
+	}
+	return nil
+}
+
+// done gives result of aggregate made by newAgg
+func (ua *userAggregate) done(agg reflect.Value) (*Column, error) {
+	out, err := callFunc(agg.MethodByName("Done"), nil)
+	if err != nil {
+		return nil, err
+	}
+	return resultColumn(out, ua.ret)
+}
+
+// callFunc calls registered go function, its panic is given as error,
+// so the statement fails and is rolled back instead of the process crashing with the lock held
+func callFunc(fn reflect.Value, in []reflect.Value) (out []reflect.Value, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w: %s panicked: %v", ErrInvalidFunc, fn.Type(), r)
+		}
+	}()
+	return fn.Call(in), nil
+}
+
+// resultType gives column type of value given by function, that can be followed by error
+func resultType(t reflect.Type) (ColumnType, error) {
+	if t.NumOut() < 1 || t.NumOut() > 2 || t.NumOut() == 2 && t.Out(1) != errorType {
+		return 0, errInvalidResult
+	}
+	typ, ok := goColumnType(t.Out(0))
+	if !ok {
+		return 0, fmt.Errorf("%w: result of type %s", ErrInvalidFunc, t.Out(0))
+	}
+	return typ, nil
+}
+
+// resultColumn converts results of function call to value, or gives error of the call
+func resultColumn(out []reflect.Value, typ ColumnType) (*Column, error) {
+	if len(out) == 2 && !out[1].IsNil() {
+		return nil, out[1].Interface().(error)
+	}
+	return goToColumn(out[0], typ)
+}
+
+// goColumnType gives column type of go type, pointer is of its element type
+func goColumnType(t reflect.Type) (ColumnType, bool) {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch {
+	case t.ConvertibleTo(timeType) && t.Kind() == reflect.Struct:
+		return ColumnTypeTime, true
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8:
+		return ColumnTypeBytes, true
+	case t.Kind() == reflect.Array && t.ConvertibleTo(uuidType):
+		return ColumnTypeUUID, true
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return ColumnTypeBool, true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return ColumnTypeInt, true
+	case reflect.Float32, reflect.Float64:
+		return ColumnTypeFloat, true
+	case reflect.String:
+		return ColumnTypeString, true
+	}
+	return 0, false
+}
+
+// columnToGo converts value of column type of go type to go value, null is nil pointer
+func columnToGo(col *Column, t reflect.Type) (reflect.Value, error) {
+	if t.Kind() == reflect.Ptr {
+		if col.DataIsNull {
+			return reflect.Zero(t), nil
+		}
+		v, err := columnToGo(col, t.Elem())
+		if err != nil {
+			return v, err
+		}
+		ptr := reflect.New(t.Elem())
+		ptr.Elem().Set(v)
+		return ptr, nil
+	}
+
+	v := reflect.New(t).Elem()
+	switch col.Type {
+	case ColumnTypeBool:
+		v.SetBool(col.DataBool)
+	case ColumnTypeInt:
+		switch t.Kind() {
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			if col.DataInt < 0 || v.OverflowUint(uint64(col.DataInt)) {
+				return v, ErrIntegerOverflow
+			}
+			v.SetUint(uint64(col.DataInt))
+		default:
+			if v.OverflowInt(col.DataInt) {
+				return v, ErrIntegerOverflow
+			}
+			v.SetInt(col.DataInt)
+		}
+	case ColumnTypeFloat:
+		v.SetFloat(col.DataFloat)
+	case ColumnTypeString:
+		v.SetString(col.DataString)
+	case ColumnTypeTime:
+		v.Set(reflect.ValueOf(col.DataTime).Convert(t))
+	case ColumnTypeBytes:
+		v.SetBytes(append([]byte{}, col.DataBytes...))
+	case ColumnTypeUUID:
+		v.Set(reflect.ValueOf(col.DataUUID).Convert(t))
+	default:
+		return v, ErrUnknownColumnType
+	}
+	return v, nil
+}
+
+// goToColumn converts go value to value of column type, nil pointer is null
+func goToColumn(v reflect.Value, typ ColumnType) (*Column, error) {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return &Column{Type: typ, DataIsNull: true}, nil
+		}
+		v = v.Elem()
+	}
+
+	col := &Column{Type: typ}
+	switch typ {
+	case ColumnTypeBool:
+		col.DataBool = v.Bool()
+	case ColumnTypeInt:
+		switch v.Kind() {
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			if v.Uint() > math.MaxInt64 {
+				return nil, ErrIntegerOverflow
+			}
+			col.DataInt = int64(v.Uint())
+		default:
+			col.DataInt = v.Int()
+		}
+	case ColumnTypeFloat:
+		col.DataFloat = v.Float()
+	case ColumnTypeString:
+		col.DataString = v.String()
+	case ColumnTypeTime:
+		col.DataTime = v.Convert(timeType).Interface().(time.Time)
+	case ColumnTypeBytes:
+		if v.IsNil() {
+			return &Column{Type: typ, DataIsNull: true}, nil
+		}
+		col.DataBytes = append([]byte{}, v.Bytes()...)
+	case ColumnTypeUUID:
+		col.DataUUID = v.Convert(uuidType).Interface().([16]byte)
+	default:
+		return nil, ErrUnknownColumnType
+	}
+	return col, nil
+}
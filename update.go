@@ -1,9 +1,178 @@
 package furydb
 
-import "fmt"
+import (
+	"database/sql/driver"
+	"fmt"
+)
 
-// queryUpdate executes a SQL UPDATE statement
-func (c *FuryConn) queryUpdate(query string) (*results, error) {
+// execUpdate executes a SQL UPDATE statement
+func (c *FuryConn) execUpdate(stmt *UpdateStatement, args []driver.Value) (*results, error) {
+	var err error
 	res := &results{}
-	return res, fmt.Errorf("not implemented")
+
+	// sanity check find if table exists
+	_, table := c.db.findTable(stmt.TableName)
+	if table == nil {
+		return nil, ErrTableNotExist
+	}
+	res.tableSchema = table
+
+	for _, field := range stmt.Fields {
+		if table.findColumn(field) == nil {
+			return nil, ErrColumnNotExist
+		}
+	}
+
+	// resolve columns used by where and values
+	s := c.db.tableScope(table)
+	if stmt.Where != nil {
+		err = stmt.Where.bind(s)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, value := range stmt.Values {
+		err = value.bind(s)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// all columns, so row can be written back as whole
+	for _, col := range table.Columns {
+		res.columns = append(res.columns, col.Name)
+	}
+
+	rows, err := c.db.scanRows(table, res.columns, stmt.Where, args)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		// foreign key action of earlier row can change or remove the row
+		row, err = c.db.reloadRow(table, row)
+		if err != nil {
+			return nil, err
+		}
+		ok, err := matchRow(row, stmt.Where, args)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+
+		// values are evaluated against the row before update
+		values, err := evalValues(table, stmt.Fields, stmt.Values, &evalContext{row: row, args: args})
+		if err != nil {
+			return nil, err
+		}
+		// sanity check and get formatted columns values
+		columns, err := sanityCheckQuery(stmt.Fields, values, table)
+		if err != nil {
+			return nil, err
+		}
+
+		// replace updated columns
+		newRow := &Row{
+			TableName: table.Name,
+			Columns:   make([]*Column, len(row.Columns)),
+		}
+		copy(newRow.Columns, row.Columns)
+		for i, col := range table.Columns {
+			for _, newCol := range columns {
+				if newCol.Name == col.Name {
+					newRow.Columns[i] = newCol
+				}
+			}
+		}
+
+		newRow.id, err = c.db.updateRow(table, row.id, row, newRow)
+		if err != nil {
+			return nil, err
+		}
+
+		res.rows = append(res.rows, newRow)
+	}
+
+	return res, nil
+}
+
+// UpdateStatement represents a SQL UPDATE statement.
+type UpdateStatement struct {
+	TableName string
+	Fields    []string // columns to update
+	Values    []Expr   // new value of each column
+	Where     Expr     // condition rows must match, nil matches all
+}
+
+// parseUpdate parses a SQL UPDATE statement
+func (p *Parser) parseUpdate() (*UpdateStatement, error) {
+	var err error
+	stmt := &UpdateStatement{}
+
+	// First token should be a "UPDATE" keyword.
+	if tok, lit := p.scanIgnoreWhitespace(); tok != UPDATE {
+		return nil, fmt.Errorf("found %q, expected UPDATE", lit)
+	}
+
+	// Next we should read the table name.
+	tok, lit := p.scanIgnoreWhitespace()
+	if tok != IDENT {
+		return nil, fmt.Errorf("found %q, expected table name", lit)
+	}
+	stmt.TableName = lit
+
+	// Next we should see the "SET" keyword.
+	if tok, lit = p.scanIgnoreWhitespace(); tok != SET {
+		return nil, fmt.Errorf("found %q, expected SET", lit)
+	}
+
+	// loop over all our comma-delimited assignments
+	for {
+		tok, lit = p.scanIgnoreWhitespace()
+		if tok != IDENT {
+			return nil, fmt.Errorf("found %q, expected field", lit)
+		}
+		for _, field := range stmt.Fields {
+			if field == lit {
+				return nil, fmt.Errorf("found %q, column assigned more than once", lit)
+			}
+		}
+		stmt.Fields = append(stmt.Fields, lit)
+
+		if tok, lit = p.scanIgnoreWhitespace(); tok != EQ {
+			return nil, fmt.Errorf("found %q, expected =", lit)
+		}
+
+		value, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Values = append(stmt.Values, value)
+
+		// If the next token is not a comma then break the loop.
+		if tok, _ = p.scanIgnoreWhitespace(); tok != COMMA {
+			p.unscan()
+			break
+		}
+	}
+
+	// optional WHERE condition
+	if tok, _ = p.scanIgnoreWhitespace(); tok == WHERE {
+		stmt.Where, err = p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		p.unscan()
+	}
+
+	// statement may end with ;
+	if err = p.scanEnd(); err != nil {
+		return nil, err
+	}
+
+	// Return the successfully parsed statement.
+	return stmt, nil
 }
@@ -0,0 +1,359 @@
+package furydb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path"
+)
+
+// Note:
+// Every change is first appended to write ahead log <folder>/wal and the log is flushed to disk,
+// only then the change is applied to the files. Changes of transaction are followed by commit
+// record, so the transaction is durable as soon as its commit record is on disk.
+// The files are not flushed on every change, on checkpoint they are flushed and the log is emptied.
+// After unclean shutdown the log is replayed when the database is loaded, transactions without
+// commit record and records that fail checksum (partially written) are thrown away.
+//
+// Record layout
+//   [0:4] payload length
+//   [4:8] crc32 of payload
+//   [8:]  payload, kind byte followed by
+//         page   path length uvarint, path, page number varint, page data
+//         file   path length uvarint, path, file data
+//         remove path length uvarint, path
+//         commit nothing
+
+const (
+	walName           = "wal"
+	walHeaderSize     = 8
+	walCheckpointSize = 4 << 20 // log size that triggers checkpoint
+)
+
+// kinds of log record
+const (
+	walRecordPage   byte = 1
+	walRecordFile   byte = 2
+	walRecordRemove byte = 3
+	walRecordCommit byte = 4
+)
+
+// walEntry is a single file or page change
+type walEntry struct {
+	Path   string // relative to database folder
+	Page   int64  // page number, -1 is whole file
+	Data   []byte // file or page content
+	Remove bool   // file is removed instead
+}
+
+// logCommit appends changes and commit record to log, flushes log, then applies changes to the files
+func (db *Database) logCommit(entries []*walEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	buf := []byte{}
+	for _, entry := range entries {
+		buf = appendWALRecord(buf, encodeWALEntry(entry))
+	}
+	buf = appendWALRecord(buf, []byte{walRecordCommit})
+
+	if db.wal == nil {
+		err := os.MkdirAll(db.Folderpath, 0755)
+		if err != nil {
+			return err
+		}
+		db.wal, err = os.OpenFile(path.Join(db.Folderpath, walName), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+	}
+	_, err := db.wal.Write(buf)
+	if err != nil {
+		return err
+	}
+	err = db.wal.Sync()
+	if err != nil {
+		return err
+	}
+
+	// changes are durable, crash from here on is recovered on load
+	paths, err := applyWAL(db.Folderpath, entries)
+	if db.dirty == nil {
+		db.dirty = map[string]bool{}
+	}
+	for _, p := range paths {
+		db.dirty[p] = true
+	}
+	if err != nil {
+		db.cache = nil
+		return err
+	}
+	for _, entry := range entries {
+		if entry.Remove {
+			db.uncacheFile(entry.Path)
+		}
+		if entry.Page >= 0 {
+			db.cachePage(pageKey{entry.Path, entry.Page}, entry.Data)
+		}
+	}
+
+	info, err := db.wal.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() >= walCheckpointSize {
+		return db.checkpoint()
+	}
+	return nil
+}
+
+// checkpoint flushes changed files to disk and empties the log
+func (db *Database) checkpoint() error {
+	err := syncFiles(db.Folderpath, db.dirty)
+	if err != nil {
+		return err
+	}
+	db.dirty = nil
+
+	if db.wal == nil {
+		return nil
+	}
+	err = db.wal.Truncate(0)
+	if err != nil {
+		return err
+	}
+	return db.wal.Sync()
+}
+
+// closeWAL does checkpoint and closes the log
+func (db *Database) closeWAL() error {
+	err := db.checkpoint()
+	if err != nil {
+		return err
+	}
+	if db.wal == nil {
+		return nil
+	}
+	err = db.wal.Close()
+	db.wal = nil
+	return err
+}
+
+// encodeWALEntry converts change to record payload
+func encodeWALEntry(entry *walEntry) []byte {
+	kind := walRecordPage
+	if entry.Remove {
+		kind = walRecordRemove
+	} else if entry.Page < 0 {
+		kind = walRecordFile
+	}
+
+	buf := []byte{kind}
+	buf = appendUvarint(buf, uint64(len(entry.Path)))
+	buf = append(buf, entry.Path...)
+	switch kind {
+	case walRecordPage:
+		tmp := make([]byte, binary.MaxVarintLen64)
+		n := binary.PutVarint(tmp, entry.Page)
+		buf = append(buf, tmp[:n]...)
+		buf = append(buf, entry.Data...)
+	case walRecordFile:
+		buf = append(buf, entry.Data...)
+	}
+	return buf
+}
+
+// decodeWALEntry converts record payload back to change
+func decodeWALEntry(payload []byte) (*walEntry, error) {
+	errCorrupt := fmt.Errorf("log record corrupted")
+
+	kind := payload[0]
+	size, n := binary.Uvarint(payload[1:])
+	if n <= 0 || uint64(len(payload)-1-n) < size {
+		return nil, errCorrupt
+	}
+	dat := payload[1+n:]
+	entry := &walEntry{Path: string(dat[:size]), Page: -1}
+	dat = dat[size:]
+
+	switch kind {
+	case walRecordPage:
+		entry.Page, n = binary.Varint(dat)
+		if n <= 0 || len(dat)-n != pageSize {
+			return nil, errCorrupt
+		}
+		entry.Data = append([]byte{}, dat[n:]...)
+	case walRecordFile:
+		entry.Data = append([]byte{}, dat...)
+	case walRecordRemove:
+		entry.Remove = true
+	default:
+		return nil, errCorrupt
+	}
+	return entry, nil
+}
+
+// appendWALRecord appends record with header to buf
+func appendWALRecord(buf []byte, payload []byte) []byte {
+	header := make([]byte, walHeaderSize)
+	binary.LittleEndian.PutUint32(header[0:], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(header[4:], crc32.ChecksumIEEE(payload))
+	buf = append(buf, header...)
+	return append(buf, payload...)
+}
+
+// applyWAL writes changes to the files without flushing them, gives changed paths
+func applyWAL(folderpath string, entries []*walEntry) ([]string, error) {
+	paths := []string{}
+
+	// page files are opened once
+	files := map[string]*os.File{}
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+
+	for _, entry := range entries {
+		filepath := path.Join(folderpath, entry.Path)
+		paths = append(paths, entry.Path)
+
+		if entry.Remove {
+			err := os.Remove(filepath)
+			if err != nil && !os.IsNotExist(err) {
+				return paths, err
+			}
+			continue
+		}
+		if entry.Page < 0 {
+			err := writeBytes(filepath, entry.Data)
+			if err != nil {
+				return paths, err
+			}
+			continue
+		}
+
+		f, ok := files[filepath]
+		if !ok {
+			err := os.MkdirAll(path.Dir(filepath), 0755)
+			if err != nil {
+				return paths, err
+			}
+			f, err = os.OpenFile(filepath, os.O_RDWR|os.O_CREATE, 0644)
+			if err != nil {
+				return paths, err
+			}
+			files[filepath] = f
+		}
+		_, err := f.WriteAt(entry.Data, entry.Page*pageSize)
+		if err != nil {
+			return paths, err
+		}
+	}
+	return paths, nil
+}
+
+// syncFiles flushes files and their dirs to disk
+func syncFiles(folderpath string, paths map[string]bool) error {
+	dirs := map[string]bool{}
+	for p := range paths {
+		filepath := path.Join(folderpath, p)
+		dirs[path.Dir(filepath)] = true
+
+		f, err := os.Open(filepath)
+		if err != nil && os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		err = f.Sync()
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	for dir := range dirs {
+		err := syncDir(dir)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// recoverWAL replays committed changes in log after unclean shutdown
+func recoverWAL(folderpath string) error {
+	pathWAL := path.Join(folderpath, walName)
+	dat, err := ioutil.ReadFile(pathWAL)
+	if err != nil && os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if len(dat) == 0 {
+		return nil
+	}
+
+	dirty := map[string]bool{}
+	pending := []*walEntry{}
+	numTx := 0
+	for len(dat) >= walHeaderSize {
+		size := int(binary.LittleEndian.Uint32(dat[0:]))
+		sum := binary.LittleEndian.Uint32(dat[4:])
+		if size == 0 || len(dat)-walHeaderSize < size {
+			break
+		}
+		payload := dat[walHeaderSize : walHeaderSize+size]
+		if crc32.ChecksumIEEE(payload) != sum {
+			break
+		}
+		dat = dat[walHeaderSize+size:]
+
+		if payload[0] == walRecordCommit {
+			paths, err := applyWAL(folderpath, pending)
+			if err != nil {
+				return err
+			}
+			for _, p := range paths {
+				dirty[p] = true
+			}
+			pending = []*walEntry{}
+			numTx++
+			continue
+		}
+		entry, err := decodeWALEntry(payload)
+		if err != nil {
+			break
+		}
+		pending = append(pending, entry)
+	}
+
+	if Verbose >= 1 {
+		fmt.Printf("replay log %s   transactions: %d\n", pathWAL, numTx)
+	}
+
+	err = syncFiles(folderpath, dirty)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(pathWAL)
+	if err != nil {
+		return err
+	}
+	return syncDir(folderpath)
+}
+
+// syncDir flushes dir entries to disk, so new file stays after crash
+func syncDir(dirpath string) error {
+	f, err := os.Open(dirpath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	// not all systems support syncing dir
+	f.Sync()
+	return nil
+}